@@ -1,20 +1,29 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
+	"image"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
 	"runtime/pprof"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	_ "net/http/pprof"
 
+	"github.com/Solidsilver/go-ray-march/pkg/cluster"
+	"github.com/Solidsilver/go-ray-march/pkg/postfx"
 	"github.com/Solidsilver/go-ray-march/pkg/renderer"
+	"github.com/Solidsilver/go-ray-march/pkg/utils"
+	"github.com/schollz/progressbar/v3"
 )
 
 func main() {
@@ -24,6 +33,50 @@ func main() {
 	dimensionsOpt := flag.String("d", "1920x1080", "The dimensions of the image to render")
 	fov := flag.Float64("fov", 20, "The field of view of the camera")
 	outDir := flag.String("o", "./rend_out_0", "The directory to output the image to")
+	aaModeOpt := flag.String("aa", "none", "The anti-aliasing mode: none, grid, jitter or adaptive")
+	aaSamples := flag.Int("samples", renderer.DefaultAntiAliasOpts().Samples, "The number of anti-aliasing samples along each pixel axis (NxN per pixel)")
+	aaFilterOpt := flag.String("filter", "box", "The anti-aliasing reconstruction filter: box, tent or mitchell")
+	aperture := flag.Float64("aperture", 0, "The lens aperture radius for depth of field (0 for a pinhole camera)")
+	focusDist := flag.Float64("focus", 15, "The distance of the plane in focus")
+	blades := flag.Int("blades", 0, "The number of aperture blades for polygonal bokeh (0 for round)")
+	bladeRot := flag.Float64("blade-rot", 0, "The rotation of the aperture blades in degrees")
+	lensSamples := flag.Int("lens-samples", renderer.DefaultLensOpts().Samples, "The number of lens samples averaged per pixel for depth of field when pixels aren't supersampled")
+	autoFocus := flag.Bool("autofocus", false, "Focus on whatever is under the center pixel")
+	focalLength := flag.Float64("focal-length", 0, "The focal length of the lens in mm, deriving the field of view, aperture and exposure from the physical camera settings (0 to use -fov and -aperture)")
+	sensorOpt := flag.String("sensor", "36x24", "The width and height of the camera sensor in mm")
+	fStop := flag.Float64("fstop", renderer.DefaultPhysicalCameraOpts().FStop, "The f-stop of the lens of the physical camera")
+	shutterSpeedOpt := flag.String("shutter-speed", "1/60", "The exposure time of the physical camera in seconds, e.g. 1/250")
+	iso := flag.Float64("iso", renderer.DefaultPhysicalCameraOpts().ISO, "The ISO sensitivity of the physical camera")
+	unitScale := flag.Float64("unit-scale", renderer.DefaultPhysicalCameraOpts().UnitScale, "The length of a world unit in meters for the physical camera")
+	projectionOpt := flag.String("projection", "perspective", "The camera projection: perspective, orthographic, fisheye, equirect or cubemap (6:1 image)")
+	viewWidth := flag.Float64("view-width", renderer.DefaultProjectionOpts().ViewWidth, "The width of the view in world units for the orthographic projection")
+	stereoOpt := flag.String("stereo", "none", "Render a stereo pair combined as: none, sbs, over-under or anaglyph")
+	interocular := flag.Float64("interocular", renderer.DefaultStereoOpts().Interocular, "The distance between the eyes of a stereo pair in world units")
+	convergence := flag.Float64("convergence", renderer.DefaultStereoOpts().Convergence, "The distance at which both eyes of a stereo pair see the same image")
+	fisheyeFov := flag.Float64("fisheye-fov", renderer.DefaultProjectionOpts().FisheyeFov, "The field of view across the image circle of the fisheye projection, up to 360 degrees")
+	exposure := flag.Float64("exposure", 0, "The exposure in stops (exposure compensation with -auto-exposure or -focal-length)")
+	toneMapOpt := flag.String("tonemap", "clamp", "The tone mapping operator: clamp, reinhard, aces or hable")
+	srgb := flag.Bool("srgb", false, "Encode the output with the sRGB transfer function")
+	autoExposure := flag.Bool("auto-exposure", false, "Set the exposure from the luminance histogram of each frame")
+	aovOpt := flag.String("aovs", "", "Comma separated AOV passes to write next to each image: depth, normal, albedo, objectid, steps, shadow, position")
+	denoiseOpt := flag.Bool("denoise", false, "Run the edge-aware denoiser on each finished image")
+	denoiseIter := flag.Int("denoise-iter", renderer.DefaultDenoiseOpts().Filter.Iterations, "The number of denoiser passes, each doubling its reach")
+	tileSize := flag.Int("tile", renderer.DefaultTileOpts().Size, "The width and height of a render tile in pixels")
+	tileOrderOpt := flag.String("tile-order", "spiral", "The order tiles are rendered in: scanline, spiral or hilbert")
+	shadingOpt := flag.String("shading", "angle", "The shading model: angle or lambert")
+	postOpt := flag.String("post", "", "The post-processing chain, run in order with bloom and chromatic before the other effects, e.g. \"bloom:threshold=1;grade:lut=film.cube;vignette:strength=0.3\"")
+	statsOpt := flag.Bool("stats", false, "Print render statistics as JSON once the image is done")
+	heatmapOpt := flag.String("heatmap", "none", "Write a heatmap of the march steps or time spent per pixel: none, steps or cost")
+	serveAddr := flag.String("serve", "", "Run as a worker serving tile jobs on this address, e.g. :8080")
+	nodesOpt := flag.String("nodes", "", "Comma separated worker URLs to render the tiles on, e.g. http://host1:8080,http://host2:8080")
+	tileTimeout := flag.Duration("tile-timeout", cluster.DefaultCoordinatorOpts().TileTimeout, "How long a worker has to render a tile before it is sent elsewhere")
+	checkpointDir := flag.String("checkpoint", "", "Save the progress of the run to this directory so it can be resumed")
+	checkpointEvery := flag.Duration("checkpoint-every", 30*time.Second, "How often to save the progress of the frame being rendered")
+	resume := flag.Bool("resume", false, "Resume the run saved in the -checkpoint directory")
+	cropOpt := flag.String("crop", "", "Only render the window x0,y0,x1,y1 of the frame, in pixels or fractions of the frame size, e.g. 0.25,0.25,0.75,0.75")
+	cropCanvas := flag.Bool("crop-canvas", false, "Write the whole frame with only the crop window rendered, instead of just the window")
+	stream := flag.Bool("stream", false, "Render in bands of tiles and stream them to the output PNG, for images too large to fit in memory. Memory grows with width x tile size")
+	seed := flag.Uint64("seed", 0, "The seed of the random numbers used for sampling")
 	cpuprofile := flag.String("cpuprofile", "", "write cpu profile to file")
 	memprofile := flag.String("memprofile", "", "write memory profile to this file")
 	flag.Parse()
@@ -54,22 +107,222 @@ func main() {
 		log.Fatal(errors.Join(err1, err2))
 	}
 
+	aaMode, err := renderer.ParseAAMode(*aaModeOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+	aaFilter, err := renderer.ParseAAFilter(*aaFilterOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+	toneMapOp, err := renderer.ParseToneMapOperator(*toneMapOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+	toneMapOpts := renderer.DefaultToneMapOpts()
+	toneMapOpts.Exposure = *exposure
+	toneMapOpts.Operator = toneMapOp
+	toneMapOpts.SRGB = *srgb
+	toneMapOpts.AutoExposure = *autoExposure
+
+	postChain, err := postfx.ParseChain(*postOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	aovs, err := renderer.ParseAOVs(*aovOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	aaOpts := renderer.DefaultAntiAliasOpts()
+	aaOpts.Mode = aaMode
+	aaOpts.Samples = *aaSamples
+	aaOpts.Filter = aaFilter
+
+	tileOrder, err := renderer.ParseTileOrder(*tileOrderOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	shading, err := renderer.ParseShadingModel(*shadingOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	heatmap, err := renderer.ParseHeatmapMode(*heatmapOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	projection, err := renderer.ParseProjection(*projectionOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	stereoLayout, err := renderer.ParseStereoLayout(*stereoOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cropWindow, err := renderer.ParseCropWindow(*cropOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	denoiseOpts := renderer.DefaultDenoiseOpts()
+	denoiseOpts.Enabled = *denoiseOpt
+	denoiseOpts.Filter.Iterations = *denoiseIter
+
 	rOps := renderer.RenderOpts{
 		Workers: *workersOpt,
 		DimX:    dimXInt,
 		DimY:    dimYInt,
 		Fov:     *fov,
 		OutPath: *outDir,
+		AA:      aaOpts,
+		Lens: renderer.LensOpts{
+			Aperture:      *aperture,
+			FocusDist:     *focusDist,
+			Blades:        *blades,
+			BladeRotation: *bladeRot,
+			AutoFocus:     *autoFocus,
+			Samples:       *lensSamples,
+		},
+		Projection: renderer.ProjectionOpts{
+			Mode:       projection,
+			ViewWidth:  *viewWidth,
+			FisheyeFov: *fisheyeFov,
+		},
+		Stereo: renderer.StereoOpts{
+			Layout:      stereoLayout,
+			Interocular: *interocular,
+			Convergence: *convergence,
+		},
+		ToneMap: toneMapOpts,
+		Post:    postChain,
+		AOVs:    aovs,
+		Denoise: denoiseOpts,
+		Tiles:   renderer.TileOpts{Size: *tileSize, Order: tileOrder},
+		Shading: shading,
+		Crop:    renderer.CropOpts{Window: cropWindow, Canvas: *cropCanvas},
+		Seed:    *seed,
+		Stats:   renderer.StatsOpts{Enabled: *statsOpt, Heatmap: heatmap},
+	}
+
+	if *focalLength > 0 {
+		if *aperture > 0 {
+			log.Fatal("-aperture can't be used with a physical camera, set -fstop instead")
+		}
+		physical, err := renderer.ParsePhysicalCamera(*focalLength, *sensorOpt, *fStop, *shutterSpeedOpt, *iso, *unitScale)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Deriving the camera from: ", physical.String())
+		physical.Apply(&rOps)
 	}
 
 	log.Println("Rendering with options: ", rOps.String())
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *serveAddr != "" {
+		worker := cluster.NewWorker(renderer.NewDefaultRenderScene, *workersOpt)
+		srv := &http.Server{Addr: *serveAddr, Handler: worker.Handler()}
+		go func() {
+			<-ctx.Done()
+			srv.Close()
+		}()
+		log.Println("Serving tile jobs on", *serveAddr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if stereoLayout != renderer.StereoNone && (*stream || *checkpointDir != "" || *nodesOpt != "") {
+		log.Fatal("stereo renders can't be streamed, checkpointed or distributed")
+	}
+
+	if *stream {
+		if *checkpointDir != "" || *nodesOpt != "" {
+			log.Fatal("streamed renders can't be checkpointed or distributed")
+		}
+		startTime := time.Now()
+		if err := renderStream(ctx, rOps); err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Rendered in: ", time.Since(startTime).String())
+		return
+	}
+
 	r := renderer.NewDefaultRenderScene(rOps)
-	// renderer.Render3(r, rOps.Workers)
+	var checkpoint *renderer.Checkpoint
+	if *checkpointDir != "" {
+		cp, err := renderer.OpenCheckpoint(*checkpointDir, *checkpointEvery, r, rOps, *resume)
+		if err != nil {
+			log.Fatal(err)
+		}
+		checkpoint = cp
+		r.SetCheckpoint(cp)
+		r.GetCamera().SetFrame(cp.Frames())
+	} else if *resume {
+		log.Fatal("-resume needs the -checkpoint directory to resume from")
+	}
+	if checkpoint != nil && checkpoint.Frames() > 0 {
+		log.Println("The image was already rendered in", *checkpointDir)
+		return
+	}
+
 	startTime := time.Now()
-	r.RenderStatic(rOps.Workers, &sync.WaitGroup{})
+	if *nodesOpt != "" {
+		if checkpoint != nil {
+			log.Fatal("distributed renders can't be checkpointed")
+		}
+		coordOpts := cluster.DefaultCoordinatorOpts()
+		coordOpts.TileTimeout = *tileTimeout
+		coord := cluster.NewCoordinator(strings.Split(*nodesOpt, ","), coordOpts)
+		coord.SetObserver(newProgressObserver())
+		hdr, err := coord.RenderFrame(ctx, r.GetCamera(), rOps)
+		if err != nil {
+			log.Fatal(err)
+		}
+		r.GetCamera().HDR = hdr
+		r.Resolve()
+	} else {
+		r.SetObserver(newProgressObserver())
+		render := r.Render
+		if stereoLayout != renderer.StereoNone {
+			render = r.RenderStereo
+		}
+		if _, err := render(ctx, rOps); err != nil {
+			log.Fatal(err)
+		}
+	}
 	log.Println("Rendered in: ", time.Since(startTime).String())
 	r.GetCamera().FlushToDisk()
+	if checkpoint != nil {
+		if err := checkpoint.FrameDone(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if heatmap != renderer.HeatmapNone {
+		heatmapPath := fmt.Sprintf("%s/render000_heatmap.png", *outDir)
+		if err := utils.EncodePNGToPath(heatmapPath, r.HeatmapImage()); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *statsOpt {
+		stats := r.Stats()
+		log.Print(stats.String())
+		out, err := json.MarshalIndent(stats, "", "  ")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(string(out))
+	}
 
 	if *memprofile != "" {
 		f, err := os.Create(*memprofile)
@@ -81,3 +334,68 @@ func main() {
 		return
 	}
 }
+
+// renderStream renders the image a band of tiles at a time, writing
+// every band to the output PNG as soon as it is finished
+func renderStream(ctx context.Context, opts renderer.RenderOpts) error {
+	bandHeight := opts.Tiles.Size
+	// the camera only needs to hold a single band
+	sceneOpts := opts
+	sceneOpts.DimY = min(bandHeight, opts.DimY)
+	r := renderer.NewDefaultRenderScene(sceneOpts)
+	r.SetObserver(newProgressObserver())
+
+	if err := os.MkdirAll(opts.OutPath, os.ModePerm); err != nil {
+		return err
+	}
+	out, err := os.Create(fmt.Sprintf("%s/render000.png", opts.OutPath))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	enc, err := utils.NewPNGStreamWriter(out, opts.DimX, opts.DimY)
+	if err != nil {
+		return err
+	}
+	err = r.RenderBands(ctx, opts, bandHeight, func(band image.Rectangle, img *image.RGBA) error {
+		return enc.WriteRows(img)
+	})
+	if err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// newProgressObserver shows the tile pass as a terminal
+// progress bar and logs how long every pass took
+func newProgressObserver() renderer.Observer {
+	var pb *progressbar.ProgressBar
+	return renderer.ObserverFunc(func(e renderer.Event) {
+		switch e.Kind {
+		case renderer.EventStarted:
+			pb = progressbar.NewOptions64(e.Total,
+				progressbar.OptionSetDescription("Rendering Image..."),
+				progressbar.OptionThrottle(65*time.Millisecond),
+				progressbar.OptionShowIts(),
+				progressbar.OptionSetItsString("px"),
+				progressbar.OptionSpinnerType(14),
+				progressbar.OptionFullWidth(),
+				progressbar.OptionSetRenderBlankState(true),
+				progressbar.OptionSetPredictTime(true),
+				progressbar.OptionShowElapsedTimeOnFinish(),
+				progressbar.OptionUseANSICodes(true),
+			)
+		case renderer.EventTileDone:
+			pb.Set64(e.Done)
+		case renderer.EventPassDone:
+			if e.Pass == renderer.PassTiles {
+				pb.Finish()
+				fmt.Println()
+			}
+			log.Printf("Finished %s pass in %s", e.Pass, e.Duration)
+		}
+	})
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"image"
 	"log"
 	"math"
 	"net/http"
@@ -12,15 +14,17 @@ import (
 	"runtime/pprof"
 	"strconv"
 	"strings"
-	"sync"
 	"sync/atomic"
+	"time"
 
 	_ "net/http/pprof"
 
 	"github.com/Solidsilver/go-ray-march/pkg/drawables"
+	"github.com/Solidsilver/go-ray-march/pkg/postfx"
 	"github.com/Solidsilver/go-ray-march/pkg/renderer"
 	"github.com/fstanis/screenresolution"
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/pkg/profile"
 	"golang.org/x/exp/slices"
@@ -31,25 +35,117 @@ type Game struct {
 	renderer         *renderer.Renderer
 	windowHeight     int
 	windowWidth      int
-	renderWG         *sync.WaitGroup
 	rops             renderer.RenderOpts
+	cancelRender     context.CancelFunc
+	renderDone       chan struct{}
 	keys             []ebiten.Key
 	isProcessingMove atomic.Bool
+	// status is the render progress drawn over the frame
+	status atomic.Value
+	scaler *resolutionScaler
+	// renderScale is the scale of the frame being rendered
+	renderScale float64
+	// lastFrame is the timing of the last finished frame
+	lastFrame   atomic.Pointer[frameTiming]
+	lastMove    time.Time
+	renderStart time.Time
+	// lookSensitivity is how many degrees the view turns per
+	// pixel the mouse is dragged
+	lookSensitivity float64
+	// lastCursor is where the cursor was while dragging to look around
+	lastCursor image.Point
 }
 
-func NewGame(opts renderer.RenderOpts) *Game {
+type frameTiming struct {
+	duration time.Duration
+	scale    float64
+}
+
+// settleTime is how long the camera has to stay still
+// before the frame is rendered again at full resolution
+const settleTime = 250 * time.Millisecond
+
+// rollStep is how many degrees Q and E roll the camera by
+const rollStep = 5.0
+
+func NewGame(opts renderer.RenderOpts, targetFPS, minScale, lookSensitivity float64) *Game {
 	height, width := getWindowSize(opts)
 	g := &Game{
-		offscreen:    ebiten.NewImage(opts.DimX, opts.DimY),
-		renderer:     renderer.NewDefaultRenderScene(opts),
-		windowWidth:  width,
-		windowHeight: height,
-		renderWG:     &sync.WaitGroup{},
-		rops:         opts,
+		offscreen:       ebiten.NewImage(opts.DimX, opts.DimY),
+		renderer:        renderer.NewDefaultRenderScene(opts),
+		windowWidth:     width,
+		windowHeight:    height,
+		rops:            opts,
+		scaler:          newResolutionScaler(opts.DimX, opts.DimY, targetFPS, minScale),
+		renderScale:     1,
+		lookSensitivity: lookSensitivity,
 	}
+	g.status.Store("")
+	g.renderer.SetObserver(renderer.ObserverFunc(g.onRenderEvent))
 	return g
 }
 
+// startRender renders a new frame in the background at the given
+// fraction of the full resolution, which stopRender can cancel
+func (g *Game) startRender(scale float64) {
+	g.renderScale = scale
+	g.rops.DimX, g.rops.DimY = g.scaler.dims(scale)
+	cam := g.renderer.GetCamera()
+	if cam.SizeX != g.rops.DimX || cam.SizeY != g.rops.DimY {
+		cam.Resize(g.rops.DimX, g.rops.DimY)
+	}
+
+	g.renderStart = time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	g.cancelRender = cancel
+	g.renderDone = done
+	go func() {
+		defer close(done)
+		_, err := g.renderer.Render(ctx, g.rops)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Println("Render failed: ", err)
+		}
+	}()
+}
+
+// onRenderEvent keeps the status overlay up to date
+func (g *Game) onRenderEvent(e renderer.Event) {
+	switch e.Kind {
+	case renderer.EventStarted, renderer.EventTileDone:
+		g.status.Store(fmt.Sprintf("Rendering %3.0f%%", e.Progress()*100))
+	case renderer.EventFinished:
+		if e.Err == nil {
+			scale := float64(g.renderer.GetCamera().SizeX) / float64(g.scaler.fullX)
+			g.lastFrame.Store(&frameTiming{duration: e.Duration, scale: scale})
+			g.status.Store(fmt.Sprintf("Frame took %s at %0.0f%%", e.Duration.Round(time.Millisecond), scale*100))
+		}
+	}
+}
+
+// isRendering reports whether a frame is still being rendered
+func (g *Game) isRendering() bool {
+	if g.renderDone == nil {
+		return false
+	}
+	select {
+	case <-g.renderDone:
+		return false
+	default:
+		return true
+	}
+}
+
+// stopRender cancels the frame being rendered and waits for it to stop
+func (g *Game) stopRender() {
+	if g.cancelRender == nil {
+		return
+	}
+	g.cancelRender()
+	<-g.renderDone
+	g.cancelRender = nil
+}
+
 func getWindowSize(opts renderer.RenderOpts) (height, width int) {
 	renderHeight := float64(opts.DimY)
 	renderWidth := float64(opts.DimX)
@@ -84,7 +180,11 @@ func getWindowSize(opts renderer.RenderOpts) (height, width int) {
 func (gm *Game) updateOffscreen() {
 	// if !gm.renderer.GetStatus() {
 	// atomic.StoreUint32(&gm.isUpdating, 1)
-	gm.offscreen.WritePixels(gm.renderer.GetCamera().Image.Pix)
+	img := gm.renderer.GetCamera().Image
+	if gm.offscreen.Bounds() != img.Bounds() {
+		gm.offscreen = ebiten.NewImage(img.Bounds().Dx(), img.Bounds().Dy())
+	}
+	gm.offscreen.WritePixels(img.Pix)
 	// atomic.StoreUint32(&gm.isUpdating, 0)
 	// }
 }
@@ -98,6 +198,8 @@ var validKeys = []ebiten.Key{
 	ebiten.KeyS,
 	ebiten.KeyA,
 	ebiten.KeyD,
+	ebiten.KeyQ,
+	ebiten.KeyE,
 }
 
 func isMvtKeyInList(keys []ebiten.Key) bool {
@@ -109,6 +211,22 @@ func isMvtKeyInList(keys []ebiten.Key) bool {
 	return false
 }
 
+// mouseLook returns how far the cursor moved since the last update
+// while the left mouse button is held down
+func (g *Game) mouseLook() image.Point {
+	if !ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		return image.Point{}
+	}
+	cursor := image.Pt(ebiten.CursorPosition())
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		g.lastCursor = cursor
+		return image.Point{}
+	}
+	delta := cursor.Sub(g.lastCursor)
+	g.lastCursor = cursor
+	return delta
+}
+
 func (g *Game) Update() error {
 	g.keys = inpututil.AppendJustPressedKeys(g.keys[:0])
 	// if ebiten.IsKeyPressed(ebiten.KeyP) {
@@ -118,14 +236,22 @@ func (g *Game) Update() error {
 		go g.renderer.GetCamera().FlushToDisk()
 	}
 
-	if !g.isProcessingMove.Load() /* && !g.renderer.Reset.Load() */ && isMvtKeyInList(g.keys) {
+	look := g.mouseLook()
+	if !g.isProcessingMove.Load() && (isMvtKeyInList(g.keys) || look != image.Point{}) {
 		g.isProcessingMove.Store(true)
 
-		if !g.renderer.IsDone() {
-			g.renderer.Reset.Store(true)
-			g.renderWG.Wait()
+		timing := g.lastFrame.Load()
+		if g.isRendering() {
+			// a frame that is still running took at least this long,
+			// which matters when moving faster than frames finish
+			timing = &frameTiming{duration: time.Since(g.renderStart), scale: g.renderScale}
+		}
+		g.stopRender()
+		// progressive passes paint over the old frame, so only
+		// clear it when pixels would otherwise come in one by one
+		if !g.rops.Progressive.Enabled {
+			g.renderer.GetCamera().Reset()
 		}
-		g.renderer.GetCamera().Reset()
 
 		moveAmt := 0.05
 
@@ -146,6 +272,8 @@ func (g *Game) Update() error {
 			bulb.Power += 0.1
 			fmt.Printf("Power: %f\n", bulb.Power)
 			scene.Drawables[0] = bulb
+			// the last frame shows the old bulb
+			g.renderer.InvalidateHistory()
 		}
 		if ebiten.IsKeyPressed(ebiten.KeyArrowRight) {
 			scene := g.renderer.GetScene()
@@ -153,6 +281,8 @@ func (g *Game) Update() error {
 			bulb.Power -= 0.1
 			fmt.Printf("Power: %f\n", bulb.Power)
 			scene.Drawables[0] = bulb
+			// the last frame shows the old bulb
+			g.renderer.InvalidateHistory()
 		}
 		if ebiten.IsKeyPressed(ebiten.KeyA) {
 			g.renderer.GetCamera().MoveLeft(moveAmt)
@@ -166,12 +296,31 @@ func (g *Game) Update() error {
 		if ebiten.IsKeyPressed(ebiten.KeyS) {
 			g.renderer.GetCamera().MoveBackward(moveAmt)
 		}
+		if ebiten.IsKeyPressed(ebiten.KeyQ) {
+			cam := g.renderer.GetCamera()
+			cam.SetRoll(cam.Roll() - rollStep)
+		}
+		if ebiten.IsKeyPressed(ebiten.KeyE) {
+			cam := g.renderer.GetCamera()
+			cam.SetRoll(cam.Roll() + rollStep)
+		}
+		if look != (image.Point{}) {
+			// dragging right turns the view right and dragging down tilts it down
+			g.renderer.GetCamera().Turn(float64(look.X)*g.lookSensitivity, float64(look.Y)*g.lookSensitivity)
+		}
 
-		// g.renderer.Reset = false
-
-		go g.renderer.Render2(g.rops.Workers, g.renderWG)
+		scale := 1.0
+		if timing != nil {
+			scale = g.scaler.next(timing.duration, timing.scale)
+		}
+		g.lastMove = time.Now()
+		g.startRender(scale)
 		g.isProcessingMove.Store(false)
 
+	} else if g.renderScale < 1 && time.Since(g.lastMove) > settleTime {
+		// the camera stopped, so go back to full resolution
+		g.stopRender()
+		g.startRender(1)
 	} else {
 		g.updateOffscreen()
 	}
@@ -181,11 +330,16 @@ func (g *Game) Update() error {
 
 func (g *Game) Draw(screen *ebiten.Image) {
 	screen.Clear()
-	screen.DrawImage(g.offscreen, nil)
+	// upscale frames rendered below full resolution to the window
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(float64(g.scaler.fullX)/float64(g.offscreen.Bounds().Dx()), float64(g.scaler.fullY)/float64(g.offscreen.Bounds().Dy()))
+	op.Filter = ebiten.FilterLinear
+	screen.DrawImage(g.offscreen, op)
+	ebitenutil.DebugPrint(screen, g.status.Load().(string))
 }
 
 func (g *Game) Layout(outsideWidth, outsideHeight int) (int, int) {
-	return g.renderer.GetCamera().SizeX, g.renderer.GetCamera().SizeY
+	return g.scaler.fullX, g.scaler.fullY
 }
 
 func main() {
@@ -197,6 +351,13 @@ func main() {
 	fov := flag.Float64("fov", 20, "The field of view of the camera")
 	outDir := flag.String("o", "./rend_out_0", "The directory to output the image to")
 	scaling := flag.Int("s", 1, "Scale to render at")
+	postOpt := flag.String("post", "", "The post-processing chain, run in order with bloom and chromatic before the other effects, e.g. \"bloom:threshold=1;vignette:strength=0.3\"")
+	targetFPS := flag.Float64("target-fps", 0, "Lower the resolution while moving to hold this frame rate (0 to always render at full size)")
+	minScale := flag.Float64("min-scale", 0.25, "The smallest fraction of the full resolution -target-fps may render at")
+	progressiveOpt := flag.Bool("progressive", true, "Render each frame coarse to fine, refining blocks of 16, 8, 4 and 2 pixels")
+	temporalOpt := flag.Bool("temporal", false, "Reproject the previous frame to reuse or seed pixels of the next one")
+	denoiseOpt := flag.Bool("denoise", false, "Denoise each finished frame for a cleaner preview")
+	lookSensitivity := flag.Float64("mouse-sensitivity", 0.1, "Degrees the view turns per pixel the mouse is dragged with the left button held")
 	cpuprofile := flag.String("cpuprofile", "", "write cpu profile to file")
 	flag.Parse()
 
@@ -232,24 +393,48 @@ func main() {
 		dimYInt = dimYInt * *scaling
 	}
 
+	postChain, err := postfx.ParseChain(*postOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	progressiveOpts := renderer.DefaultProgressiveOpts()
+	progressiveOpts.Enabled = *progressiveOpt
+
+	temporalOpts := renderer.DefaultTemporalOpts()
+	temporalOpts.Enabled = *temporalOpt
+
+	denoiseOpts := renderer.DefaultDenoiseOpts()
+	denoiseOpts.Enabled = *denoiseOpt
+
 	rOps := renderer.RenderOpts{
-		Workers: *workersOpt,
-		DimX:    dimXInt,
-		DimY:    dimYInt,
-		Fov:     *fov,
-		OutPath: *outDir,
+		Workers:     *workersOpt,
+		DimX:        dimXInt,
+		DimY:        dimYInt,
+		Fov:         *fov,
+		OutPath:     *outDir,
+		AA:          renderer.DefaultAntiAliasOpts(),
+		Lens:        renderer.DefaultLensOpts(),
+		Motion:      renderer.DefaultMotionOpts(),
+		ToneMap:     renderer.DefaultToneMapOpts(),
+		Post:        postChain,
+		Denoise:     denoiseOpts,
+		Tiles:       renderer.DefaultTileOpts(),
+		Shading:     renderer.ShadeLambert,
+		Progressive: progressiveOpts,
+		Temporal:    temporalOpts,
 	}
 
 	log.Println("Rendering with options: ", rOps.String())
 
-	game := NewGame(rOps)
+	game := NewGame(rOps, *targetFPS, *minScale, *lookSensitivity)
 	ebiten.SetWindowSize(game.windowWidth, game.windowHeight)
 	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeOnlyFullscreenEnabled)
 	ebiten.SetScreenClearedEveryFrame(false)
 	ebiten.SetTPS(ebiten.SyncWithFPS)
 	ebiten.SetWindowTitle("Ray Marcher")
 
-	go game.renderer.Render2(rOps.Workers, game.renderWG)
+	game.startRender(1)
 	if err := ebiten.RunGame(game); err != nil {
 		log.Fatal(err)
 	}
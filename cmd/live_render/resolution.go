@@ -0,0 +1,55 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// resolutionScaler picks the render resolution that keeps frames
+// close to a target frame time while the camera is moving
+type resolutionScaler struct {
+	fullX, fullY int
+	// target is the frame time to aim for, 0 to always render at full size
+	target   time.Duration
+	minScale float64
+	scale    float64
+}
+
+func newResolutionScaler(fullX, fullY int, targetFPS, minScale float64) *resolutionScaler {
+	s := &resolutionScaler{
+		fullX:    fullX,
+		fullY:    fullY,
+		minScale: math.Max(math.Min(minScale, 1), 0.01),
+		scale:    1,
+	}
+	if targetFPS > 0 {
+		s.target = time.Duration(float64(time.Second) / targetFPS)
+	}
+	return s
+}
+
+func (s *resolutionScaler) enabled() bool {
+	return s.target > 0
+}
+
+// next returns the scale for the next moving frame, given how long the
+// last frame took and the scale it was rendered at. Render time grows
+// with the pixel count, so with the square of the scale.
+func (s *resolutionScaler) next(frameTime time.Duration, frameScale float64) float64 {
+	if !s.enabled() {
+		return 1
+	}
+	if frameTime > 0 && frameScale > 0 {
+		fullTime := float64(frameTime) / (frameScale * frameScale)
+		s.scale = math.Sqrt(float64(s.target) / fullTime)
+		s.scale = math.Max(math.Min(s.scale, 1), s.minScale)
+	}
+	return s.scale
+}
+
+// dims returns the render size for the given scale
+func (s *resolutionScaler) dims(scale float64) (int, int) {
+	x := max(int(math.Round(float64(s.fullX)*scale)), 1)
+	y := max(int(math.Round(float64(s.fullY)*scale)), 1)
+	return x, y
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestResolutionScaler(t *testing.T) {
+	// 800x600 aiming for 20 frames per second, a 50ms frame
+	tests := []struct {
+		name       string
+		frameTime  time.Duration
+		frameScale float64
+		want       float64
+	}{
+		{"slow frame", 200 * time.Millisecond, 1, 0.5},
+		{"fast frame", 5 * time.Millisecond, 0.5, 1},
+		{"on target", 50 * time.Millisecond, 0.8, 0.8},
+		{"scaled slow frame", 50 * time.Millisecond, 0.5, 0.5},
+		{"clamped to the minimum", 10 * time.Second, 1, 0.25},
+		{"no frame time keeps the scale", 0, 1, 1},
+	}
+	for _, tt := range tests {
+		s := newResolutionScaler(800, 600, 20, 0.25)
+		if got := s.next(tt.frameTime, tt.frameScale); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: expected a scale of %f. Got %f", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestResolutionScalerSettles(t *testing.T) {
+	s := newResolutionScaler(800, 600, 20, 0.1)
+	// a frame takes 200ms at full size and a quarter of that at half size
+	scale := 1.0
+	for range 5 {
+		frameTime := time.Duration(float64(200*time.Millisecond) * scale * scale)
+		scale = s.next(frameTime, scale)
+	}
+	if math.Abs(scale-0.5) > 1e-9 {
+		t.Errorf("Expected to settle at half size. Got %f", scale)
+	}
+	if x, y := s.dims(scale); x != 400 || y != 300 {
+		t.Errorf("Expected 400x300. Got %dx%d", x, y)
+	}
+}
+
+func TestResolutionScalerLimits(t *testing.T) {
+	if s := newResolutionScaler(800, 600, 0, 0.5); s.enabled() || s.next(time.Second, 1) != 1 {
+		t.Error("Expected a scaler without a target to keep the full size")
+	}
+	if s := newResolutionScaler(800, 600, 20, 0); s.minScale != 0.01 {
+		t.Errorf("Expected the minimum scale to be clamped to 0.01. Got %f", s.minScale)
+	}
+	if s := newResolutionScaler(800, 600, 20, 2); s.minScale != 1 {
+		t.Errorf("Expected the minimum scale to be clamped to 1. Got %f", s.minScale)
+	}
+	s := newResolutionScaler(800, 600, 20, 0.01)
+	if x, y := s.dims(0.0001); x != 1 || y != 1 {
+		t.Errorf("Expected at least 1x1. Got %dx%d", x, y)
+	}
+}
@@ -1,18 +1,21 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"math"
 	"os"
+	"os/signal"
 	"runtime"
 	"runtime/pprof"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/Solidsilver/go-ray-march/pkg/postfx"
 	"github.com/Solidsilver/go-ray-march/pkg/renderer"
 	"github.com/Solidsilver/go-ray-march/pkg/utils"
 	"github.com/Solidsilver/go-ray-march/pkg/vec3"
@@ -25,6 +28,45 @@ func main() {
 	dimensionsOpt := flag.String("d", "1920x1080", "The dimensions of the image to render")
 	fov := flag.Float64("fov", 20, "The field of view of the camera")
 	outDir := flag.String("o", "./rend_out_0", "The directory to output the image to")
+	aaModeOpt := flag.String("aa", "none", "The anti-aliasing mode: none, grid, jitter or adaptive")
+	aaSamples := flag.Int("samples", renderer.DefaultAntiAliasOpts().Samples, "The number of anti-aliasing samples along each pixel axis (NxN per pixel)")
+	aaFilterOpt := flag.String("filter", "box", "The anti-aliasing reconstruction filter: box, tent or mitchell")
+	aperture := flag.Float64("aperture", 0, "The lens aperture radius for depth of field (0 for a pinhole camera)")
+	focusDist := flag.Float64("focus", 15, "The distance of the plane in focus")
+	blades := flag.Int("blades", 0, "The number of aperture blades for polygonal bokeh (0 for round)")
+	bladeRot := flag.Float64("blade-rot", 0, "The rotation of the aperture blades in degrees")
+	lensSamples := flag.Int("lens-samples", renderer.DefaultLensOpts().Samples, "The number of lens samples averaged per pixel for depth of field when pixels aren't supersampled")
+	autoFocus := flag.Bool("autofocus", false, "Focus on whatever is under the center pixel")
+	focalLength := flag.Float64("focal-length", 0, "The focal length of the lens in mm, deriving the field of view, aperture and exposure from the physical camera settings (0 to use -fov and -aperture)")
+	sensorOpt := flag.String("sensor", "36x24", "The width and height of the camera sensor in mm")
+	fStop := flag.Float64("fstop", renderer.DefaultPhysicalCameraOpts().FStop, "The f-stop of the lens of the physical camera")
+	shutterSpeedOpt := flag.String("shutter-speed", "1/60", "The exposure time of the physical camera in seconds, e.g. 1/250")
+	iso := flag.Float64("iso", renderer.DefaultPhysicalCameraOpts().ISO, "The ISO sensitivity of the physical camera")
+	unitScale := flag.Float64("unit-scale", renderer.DefaultPhysicalCameraOpts().UnitScale, "The length of a world unit in meters for the physical camera")
+	exposure := flag.Float64("exposure", 0, "The exposure in stops (exposure compensation with -auto-exposure or -focal-length)")
+	toneMapOpt := flag.String("tonemap", "clamp", "The tone mapping operator: clamp, reinhard, aces or hable")
+	srgb := flag.Bool("srgb", false, "Encode the output with the sRGB transfer function")
+	autoExposure := flag.Bool("auto-exposure", false, "Set the exposure from the luminance histogram of each frame")
+	aovOpt := flag.String("aovs", "", "Comma separated AOV passes to write next to each image: depth, normal, albedo, objectid, steps, shadow, position")
+	temporalOpt := flag.Bool("temporal", false, "Reproject the previous frame to reuse or seed pixels of the next one")
+	denoiseOpt := flag.Bool("denoise", false, "Run the edge-aware denoiser on each finished image")
+	denoiseIter := flag.Int("denoise-iter", renderer.DefaultDenoiseOpts().Filter.Iterations, "The number of denoiser passes, each doubling its reach")
+	tileSize := flag.Int("tile", renderer.DefaultTileOpts().Size, "The width and height of a render tile in pixels")
+	tileOrderOpt := flag.String("tile-order", "spiral", "The order tiles are rendered in: scanline, spiral or hilbert")
+	shadingOpt := flag.String("shading", "lambert", "The shading model: angle or lambert")
+	postOpt := flag.String("post", "", "The post-processing chain, run in order with bloom and chromatic before the other effects, e.g. \"bloom:threshold=1;grade:lut=film.cube;vignette:strength=0.3\"")
+	shutterAngle := flag.Float64("shutter", 0, "The shutter angle in degrees for motion blur (0 to disable, 180 is half a frame)")
+	timeSamples := flag.Int("time-samples", 8, "The number of instants across the shutter interval to sample for motion blur")
+	checkpointDir := flag.String("checkpoint", "", "Save the progress of the run to this directory so it can be resumed")
+	checkpointEvery := flag.Duration("checkpoint-every", 30*time.Second, "How often to save the progress of the frame being rendered")
+	resume := flag.Bool("resume", false, "Resume the run saved in the -checkpoint directory")
+	seed := flag.Uint64("seed", 0, "The seed of the random numbers used for sampling")
+	stereoOpt := flag.String("stereo", "none", "Render stereo pairs combined as: none, sbs, over-under or anaglyph")
+	interocular := flag.Float64("interocular", renderer.DefaultStereoOpts().Interocular, "The distance between the eyes of a stereo pair in world units")
+	convergence := flag.Float64("convergence", renderer.DefaultStereoOpts().Convergence, "The distance at which both eyes of a stereo pair see the same image")
+	pathOpt := flag.String("path", "", "A JSON file with the keyframed camera path to render instead of orbiting the origin")
+	fps := flag.Float64("fps", 30, "The frame rate to render the camera path at")
+	duration := flag.Float64("duration", 0, "The length of the camera path to render in seconds (0 for the whole path)")
 	cpuprofile := flag.String("cpuprofile", "", "write cpu profile to file")
 	flag.Parse()
 
@@ -51,23 +93,173 @@ func main() {
 		log.Fatal(errors.Join(err1, err2))
 	}
 
+	aaMode, err := renderer.ParseAAMode(*aaModeOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+	aaFilter, err := renderer.ParseAAFilter(*aaFilterOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+	toneMapOp, err := renderer.ParseToneMapOperator(*toneMapOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+	toneMapOpts := renderer.DefaultToneMapOpts()
+	toneMapOpts.Exposure = *exposure
+	toneMapOpts.Operator = toneMapOp
+	toneMapOpts.SRGB = *srgb
+	toneMapOpts.AutoExposure = *autoExposure
+
+	postChain, err := postfx.ParseChain(*postOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	aovs, err := renderer.ParseAOVs(*aovOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	aaOpts := renderer.DefaultAntiAliasOpts()
+	aaOpts.Mode = aaMode
+	aaOpts.Samples = *aaSamples
+	aaOpts.Filter = aaFilter
+
+	tileOrder, err := renderer.ParseTileOrder(*tileOrderOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	shading, err := renderer.ParseShadingModel(*shadingOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	stereoLayout, err := renderer.ParseStereoLayout(*stereoOpt)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var cameraPath *renderer.CameraPath
+	if *pathOpt != "" {
+		cameraPath, err = renderer.LoadCameraPath(*pathOpt)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *fps <= 0 || *duration < 0 {
+			log.Fatalf("the frame rate must be positive and the duration not negative, got %f and %f", *fps, *duration)
+		}
+	}
+
+	temporalOpts := renderer.DefaultTemporalOpts()
+	temporalOpts.Enabled = *temporalOpt
+
+	denoiseOpts := renderer.DefaultDenoiseOpts()
+	denoiseOpts.Enabled = *denoiseOpt
+	denoiseOpts.Filter.Iterations = *denoiseIter
+
 	rOps := renderer.RenderOpts{
 		Workers: *workersOpt,
 		DimX:    dimXInt,
 		DimY:    dimYInt,
 		Fov:     *fov,
 		OutPath: *outDir,
+		AA:      aaOpts,
+		Lens: renderer.LensOpts{
+			Aperture:      *aperture,
+			FocusDist:     *focusDist,
+			Blades:        *blades,
+			BladeRotation: *bladeRot,
+			AutoFocus:     *autoFocus,
+			Samples:       *lensSamples,
+		},
+		Stereo: renderer.StereoOpts{
+			Layout:      stereoLayout,
+			Interocular: *interocular,
+			Convergence: *convergence,
+		},
+		Motion: renderer.MotionOpts{
+			Shutter:     renderer.ShutterFromAngle(*shutterAngle),
+			TimeSamples: *timeSamples,
+		},
+		ToneMap:  toneMapOpts,
+		Post:     postChain,
+		AOVs:     aovs,
+		Denoise:  denoiseOpts,
+		Temporal: temporalOpts,
+		Tiles:    renderer.TileOpts{Size: *tileSize, Order: tileOrder},
+		Shading:  shading,
+		Seed:     *seed,
+	}
+
+	if *focalLength > 0 {
+		if *aperture > 0 {
+			log.Fatal("-aperture can't be used with a physical camera, set -fstop instead")
+		}
+		if cameraPath != nil && cameraPath.HasFov() {
+			log.Fatal("-focal-length sets the field of view, so it can't be used with a -path that has one")
+		}
+		physical, err := renderer.ParsePhysicalCamera(*focalLength, *sensorOpt, *fStop, *shutterSpeedOpt, *iso, *unitScale)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("Deriving the camera from: ", physical.String())
+		physical.Apply(&rOps)
 	}
 
 	log.Println("Rendering with options: ", rOps.String())
 
-	r := renderer.NewDefaultRenderScene(rOps)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
 	degrees := 360.0
 	radius := 5.0
 	degIncrements := 0.5
 
-	pb := progressbar.NewOptions64(int64(degrees/degIncrements),
+	// rotate camera around center at a radius of 5, one frame every half degree
+	frames := int(degrees / degIncrements)
+	sampleAt := func(frame int) renderer.PathSample {
+		deg := float64(frame) * degIncrements
+		posX := radius * math.Cos(utils.DegToRad(deg))
+		posY := radius * math.Sin(utils.DegToRad(deg))
+		pos := vec3.New(posX, posY, 0)
+		return renderer.PathSample{Pos: pos, Dir: vec3.DirFromPos(vec3.Zero, pos)}
+	}
+	if cameraPath != nil {
+		length := *duration
+		if length == 0 {
+			length = cameraPath.Duration()
+		}
+		// frames run from the start of the path up to and including its end
+		frames = int(math.Floor(*fps*length+1e-9)) + 1
+		sampleAt = func(frame int) renderer.PathSample {
+			return cameraPath.At(float64(frame) / *fps)
+		}
+	}
+
+	r := renderer.NewDefaultRenderScene(rOps)
+	if cameraPath != nil {
+		// the checkpoint remembers where the path starts
+		r.UpdateCamera(sampleAt(0).Apply)
+	}
+	var checkpoint *renderer.Checkpoint
+	if *checkpointDir != "" && stereoLayout != renderer.StereoNone {
+		log.Fatal("stereo renders can't be checkpointed")
+	}
+	if *checkpointDir != "" {
+		cp, err := renderer.OpenCheckpoint(*checkpointDir, *checkpointEvery, r, rOps, *resume)
+		if err != nil {
+			log.Fatal(err)
+		}
+		checkpoint = cp
+		r.SetCheckpoint(cp)
+		r.GetCamera().SetFrame(cp.Frames())
+	} else if *resume {
+		log.Fatal("-resume needs the -checkpoint directory to resume from")
+	}
+
+	pb := progressbar.NewOptions64(int64(frames),
 		progressbar.OptionSetDescription("Rendering Frames..."),
 		progressbar.OptionThrottle(65*time.Millisecond),
 		progressbar.OptionShowIts(),
@@ -80,28 +272,48 @@ func main() {
 		progressbar.OptionUseANSICodes(true),
 	)
 
-	// rotate camera around center at a radius of 10, taking 360 frames
-	for i := 0.0; i < degrees; i += degIncrements {
-
-		// log.Println("Rendering frame: ", i)
-		// startTime := time.Now()
-
-		posX := radius * math.Cos(utils.DegToRad(i))
-		posY := radius * math.Sin(utils.DegToRad(i))
-		pos := vec3.New(posX, posY, 0)
-		dirVec := vec3.DirFromPos(vec3.Zero, pos)
+	// show how far along the current frame is next to the frame count
+	frame := 0
+	r.SetObserver(renderer.ObserverFunc(func(e renderer.Event) {
+		if e.Kind == renderer.EventTileDone || e.Kind == renderer.EventStarted {
+			pb.Describe(fmt.Sprintf("Rendering Frame %d (%3.0f%%)...", frame, e.Progress()*100))
+		}
+	}))
 
-		// log.Printf("Setting camera pos: (%0.2f,%0.2f) | dir %v\n", posX, posY, dirVec)
+	for frame < frames {
+		if checkpoint != nil && frame < checkpoint.Frames() {
+			// finished before the run was interrupted
+			pb.Add(1)
+			frame++
+			continue
+		}
 
+		sample := sampleAt(frame)
 		r.UpdateCamera(func(c *renderer.Camera) {
-			c.Pos = pos
-			c.Dir = dirVec
+			sample.Apply(c)
+			// the shutter interval interpolates towards the pose of the next
+			// frame, rolling and zooming along with the path
+			c.SetMotion(sampleAt(frame + 1).Pose())
 		})
+		if rOps.Lens.AutoFocus {
+			r.AutoFocus()
+		}
 
-		r.Render2(rOps.Workers, &sync.WaitGroup{})
+		render := r.Render
+		if stereoLayout != renderer.StereoNone {
+			render = r.RenderStereo
+		}
+		if _, err := render(ctx, rOps); err != nil {
+			log.Fatal(err)
+		}
 		pb.Add(1)
-		// log.Printf("Frame %f took: %s\n", i, time.Since(startTime).String())
+		frame++
 		r.GetCamera().FlushToDisk()
+		if checkpoint != nil {
+			if err := checkpoint.FrameDone(); err != nil {
+				log.Fatal(err)
+			}
+		}
 
 	}
 
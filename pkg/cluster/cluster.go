@@ -0,0 +1,102 @@
+// Package cluster spreads the tiles of a frame over renderer processes
+// on other machines. Workers serve tile jobs over HTTP and a coordinator
+// hands the tiles of a frame out to them, retrying any tile a worker
+// fails or is too slow to render, and reassembles the frame.
+package cluster
+
+import (
+	"encoding/gob"
+	"fmt"
+	"image"
+	"io"
+	"math"
+
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+	"github.com/Solidsilver/go-ray-march/pkg/renderer"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+// TilePath is the path workers serve tile jobs on
+const TilePath = "/tile"
+
+// RejectedHeader is set by a worker on the 400 response to a job whose
+// options no worker can render, so the coordinator can tell a rejected
+// job from a request that never reached a worker
+const RejectedHeader = "X-Tile-Rejected"
+
+// TileJob asks a worker to render one tile of a frame. The worker builds
+// the same scene as the coordinator and sets its camera up from the job.
+type TileJob struct {
+	// Opts are the options of the frame. Post processing runs on the
+	// coordinator, so the chain is never sent.
+	Opts renderer.RenderOpts
+	Pose renderer.CameraPose
+	// Up orients the camera around the direction of the pose
+	Up vec3.Vec3
+	// Motion is the pose of the camera at the end of the frame, if it moves
+	Motion     *renderer.CameraPose
+	Lens       renderer.LensOpts
+	Projection renderer.ProjectionOpts
+	Tile       image.Rectangle
+}
+
+// TileResult is the linear radiance of a rendered tile
+type TileResult struct {
+	Tile     image.Rectangle
+	Radiance *framebuffer.Buffer
+}
+
+// newTileJob describes the tile of a frame seen by cam
+func newTileJob(cam *renderer.Camera, opts renderer.RenderOpts, tile image.Rectangle) TileJob {
+	opts.Post = nil
+	// the coordinator has already focused the lens
+	opts.Lens.AutoFocus = false
+	job := TileJob{Opts: opts, Pose: cam.Pose(), Up: cam.Up(), Lens: cam.Lens(), Projection: cam.Projection(), Tile: tile}
+	job.Lens.AutoFocus = false
+	if end, ok := cam.Motion(); ok {
+		job.Motion = &end
+	}
+	return job
+}
+
+// validate reports why no worker could render the job
+func (job TileJob) validate() error {
+	if err := job.Opts.Validate(); err != nil {
+		return err
+	}
+	if err := job.Opts.ValidateTile(); err != nil {
+		return fmt.Errorf("can't render a lone tile: %w", err)
+	}
+	if job.Tile.Empty() || !job.Tile.In(image.Rect(0, 0, job.Opts.DimX, job.Opts.DimY)) {
+		return fmt.Errorf("tile %v is outside the %dx%d frame", job.Tile, job.Opts.DimX, job.Opts.DimY)
+	}
+	return nil
+}
+
+// check makes sure a worker sent back the tile that was asked for
+// and that every pixel of it holds a radiance
+func (res TileResult) check(tile image.Rectangle) error {
+	if res.Tile != tile {
+		return fmt.Errorf("got tile %v instead of %v", res.Tile, tile)
+	}
+	buf := res.Radiance
+	if buf == nil || buf.Width != tile.Dx() || buf.Height != tile.Dy() || len(buf.Pix) != buf.Width*buf.Height {
+		return fmt.Errorf("tile %v has the wrong size", tile)
+	}
+	for _, px := range buf.Pix {
+		for _, c := range []float64{px.X, px.Y, px.Z} {
+			if math.IsNaN(c) || math.IsInf(c, 0) {
+				return fmt.Errorf("tile %v has invalid radiance %v", tile, px)
+			}
+		}
+	}
+	return nil
+}
+
+func encode(w io.Writer, v any) error {
+	return gob.NewEncoder(w).Encode(v)
+}
+
+func decode(r io.Reader, v any) error {
+	return gob.NewDecoder(r).Decode(v)
+}
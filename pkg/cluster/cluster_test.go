@@ -0,0 +1,181 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Solidsilver/go-ray-march/pkg/drawables"
+	"github.com/Solidsilver/go-ray-march/pkg/renderer"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+func newTestScene(opts renderer.RenderOpts) *renderer.Renderer {
+	scene := renderer.NewBlankScene()
+	scene.AddDrawables(drawables.NewSphere(vec3.Zero, 1, color.RGBA{255, 255, 255, 255}, false))
+	scene.AddLights(drawables.NewLight(vec3.New(-5, -5, 5), 0.001, color.RGBA{255, 255, 255, 255}, false))
+	cam := renderer.NewCameraFOV(vec3.New(-5, 0, 0), opts.DimX, opts.DimY, opts.Fov, "./rend_test")
+	r := renderer.NewRendererOpts(scene, cam, opts)
+	return &r
+}
+
+func testOpts() renderer.RenderOpts {
+	opts := renderer.DefaultRenderOpts()
+	opts.Workers = 2
+	opts.DimX = 32
+	opts.DimY = 24
+	opts.Seed = 3
+	opts.AA.Mode = renderer.AAJitter
+	opts.AA.Samples = 2
+	opts.Tiles.Size = 8
+	return opts
+}
+
+func testCoordinatorOpts() CoordinatorOpts {
+	return CoordinatorOpts{
+		TileTimeout: 500 * time.Millisecond,
+		MaxAttempts: 4,
+		MaxFailures: 2,
+		Retry:       time.Millisecond,
+	}
+}
+
+// failing fails the first n jobs it is sent
+func failing(n int64, next http.Handler) http.Handler {
+	var count atomic.Int64
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if count.Add(1) <= n {
+			http.Error(rw, "worker unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(rw, req)
+	})
+}
+
+// stalled never answers before the request is given up on
+func stalled() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		// the server only notices the client leaving once the body is read
+		io.Copy(io.Discard, req.Body)
+		<-req.Context().Done()
+	})
+}
+
+func startWorkers(t *testing.T, handlers ...http.Handler) []string {
+	t.Helper()
+	urls := make([]string, len(handlers))
+	for i, h := range handlers {
+		srv := httptest.NewServer(h)
+		t.Cleanup(srv.Close)
+		urls[i] = srv.URL
+	}
+	return urls
+}
+
+func TestRenderFrameMatchesLocalRender(t *testing.T) {
+	opts := testOpts()
+	local := newTestScene(opts)
+	if _, err := local.Render(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	worker := NewWorker(newTestScene, 2).Handler()
+	urls := startWorkers(t, worker, failing(2, worker), stalled())
+	coord := NewCoordinator(urls, testCoordinatorOpts())
+	var tilesDone atomic.Int64
+	coord.SetObserver(renderer.ObserverFunc(func(e renderer.Event) {
+		if e.Kind == renderer.EventTileDone {
+			tilesDone.Add(1)
+		}
+	}))
+
+	remote := newTestScene(opts)
+	hdr, err := coord.RenderFrame(context.Background(), remote.GetCamera(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(len(renderer.MakeTiles(opts.DimX, opts.DimY, opts.Tiles))); tilesDone.Load() != want {
+		t.Errorf("got %d tiles done, want %d", tilesDone.Load(), want)
+	}
+	// tiles jitter their samples from the tile's corner, which rounds differently
+	for i, px := range local.GetCamera().HDR.Pix {
+		if d := hdr.Pix[i].Sub(px).Norm(); d > 1e-9 {
+			t.Fatalf("Expected the distributed render to match the local render. Got %v, want %v at %d", hdr.Pix[i], px, i)
+		}
+	}
+}
+
+func TestRenderFrameFailsWithoutWorkers(t *testing.T) {
+	opts := testOpts()
+	urls := startWorkers(t, failing(1000, nil), failing(1000, nil))
+	coord := NewCoordinator(urls, testCoordinatorOpts())
+	if _, err := coord.RenderFrame(context.Background(), newTestScene(opts).GetCamera(), opts); err == nil {
+		t.Fatal("expected failing workers to fail the frame")
+	}
+}
+
+func TestWorkerRejectsWholeFrameOptions(t *testing.T) {
+	opts := testOpts()
+	opts.Denoise.Enabled = true
+	urls := startWorkers(t, NewWorker(newTestScene, 2).Handler())
+	coord := NewCoordinator(urls, testCoordinatorOpts())
+	if _, err := coord.RenderFrame(context.Background(), newTestScene(opts).GetCamera(), opts); !errors.Is(err, renderer.ErrNeedsWholeFrame) {
+		t.Fatalf("Expected the denoiser to be rejected before dispatching. Got %v", err)
+	}
+}
+
+func TestRenderFrameDoesNotRetryRejectedJobs(t *testing.T) {
+	opts := testOpts()
+	var calls atomic.Int64
+	rejecting := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls.Add(1)
+		reject(rw, errors.New("bad job"))
+	})
+	urls := startWorkers(t, rejecting)
+	coord := NewCoordinator(urls, testCoordinatorOpts())
+	if _, err := coord.RenderFrame(context.Background(), newTestScene(opts).GetCamera(), opts); !errors.Is(err, ErrRejected) {
+		t.Fatalf("Expected the rejected job to fail the frame. Got %v", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected the rejected job to be sent once. Got %d", n)
+	}
+}
+
+func TestRenderFrameDropsWorkersThatAreNotFound(t *testing.T) {
+	opts := testOpts()
+	var calls atomic.Int64
+	notFound := http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls.Add(1)
+		http.NotFound(rw, req)
+	})
+	urls := startWorkers(t, notFound, NewWorker(newTestScene, 2).Handler())
+	coord := NewCoordinator(urls, testCoordinatorOpts())
+	if _, err := coord.RenderFrame(context.Background(), newTestScene(opts).GetCamera(), opts); err != nil {
+		t.Fatalf("Expected the frame to be rendered by the other worker. Got %v", err)
+	}
+	if n, limit := calls.Load(), int64(testCoordinatorOpts().MaxFailures); n > limit {
+		t.Errorf("Expected the missing worker to be dropped after %d jobs. Got %d", limit, n)
+	}
+}
+
+func TestWorkerRejectsTilesOutsideTheFrame(t *testing.T) {
+	opts := testOpts()
+	job := newTileJob(newTestScene(opts).GetCamera(), opts, image.Rect(24, 16, 40, 24))
+	body := bytes.Buffer{}
+	if err := encode(&body, job); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	NewWorker(newTestScene, 2).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, TilePath, &body))
+	if rec.Code != http.StatusBadRequest || rec.Header().Get(RejectedHeader) == "" {
+		t.Errorf("Expected the job to be rejected. Got %d %q", rec.Code, rec.Header().Get(RejectedHeader))
+	}
+}
@@ -0,0 +1,270 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+	"github.com/Solidsilver/go-ray-march/pkg/renderer"
+)
+
+// ErrNoWorkers is returned when a frame can't be rendered
+// because every worker has failed too often
+var ErrNoWorkers = errors.New("no workers left")
+
+// ErrRejected is returned when a worker refuses the options of a tile job,
+// which no other worker or retry would render either. Any other error
+// response counts as a failure of the worker.
+var ErrRejected = errors.New("tile job rejected")
+
+type CoordinatorOpts struct {
+	// TileTimeout is how long a worker has to render a tile
+	// before it is given to another one
+	TileTimeout time.Duration
+	// MaxAttempts is how many times a tile is tried before
+	// the frame is given up on
+	MaxAttempts int
+	// MaxFailures is how many times in a row a worker can fail
+	// before no more tiles are sent to it
+	MaxFailures int
+	// Retry is how long a worker rests after a failure
+	Retry time.Duration
+}
+
+func DefaultCoordinatorOpts() CoordinatorOpts {
+	return CoordinatorOpts{
+		TileTimeout: 2 * time.Minute,
+		MaxAttempts: 4,
+		MaxFailures: 3,
+		Retry:       time.Second,
+	}
+}
+
+func (co CoordinatorOpts) String() string {
+	return fmt.Sprintf("coordinator: {tileTimeout: %s, maxAttempts: %d, maxFailures: %d, retry: %s}", co.TileTimeout, co.MaxAttempts, co.MaxFailures, co.Retry)
+}
+
+// Coordinator renders frames by handing their tiles out to workers
+type Coordinator struct {
+	workers  []string
+	opts     CoordinatorOpts
+	client   *http.Client
+	observer renderer.Observer
+}
+
+// NewCoordinator returns a coordinator for the workers at the given
+// base URLs, such as http://host:8080
+func NewCoordinator(workers []string, opts CoordinatorOpts) *Coordinator {
+	urls := make([]string, len(workers))
+	for i, w := range workers {
+		urls[i] = strings.TrimSuffix(w, "/") + TilePath
+	}
+	return &Coordinator{workers: urls, opts: opts, client: &http.Client{}}
+}
+
+// SetObserver sets the observer told about the progress of every frame.
+// Only the started, tile done, tiles pass done and finished events are sent.
+func (c *Coordinator) SetObserver(o renderer.Observer) {
+	c.observer = o
+}
+
+// tileTask is a tile waiting to be rendered
+type tileTask struct {
+	tile     image.Rectangle
+	attempts int
+}
+
+// RenderFrame renders the frame seen by cam on the workers and returns
+// its linear radiance, ready to be resolved by the local renderer
+func (c *Coordinator) RenderFrame(ctx context.Context, cam *renderer.Camera, opts renderer.RenderOpts) (*framebuffer.Buffer, error) {
+	if len(c.workers) == 0 {
+		return nil, ErrNoWorkers
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.ValidateTile(); err != nil {
+		return nil, fmt.Errorf("can't render a frame on workers: %w", err)
+	}
+	if !opts.Crop.Window.IsZero() {
+		return nil, errors.New("distributed renders can't be cropped")
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	tiles := renderer.MakeTiles(opts.DimX, opts.DimY, opts.Tiles)
+	queue := make(chan tileTask, len(tiles))
+	for _, tile := range tiles {
+		queue <- tileTask{tile: tile}
+	}
+	out := framebuffer.New(opts.DimX, opts.DimY)
+	remaining := atomic.Int64{}
+	remaining.Store(int64(len(tiles)))
+	alive := atomic.Int64{}
+	alive.Store(int64(len(c.workers)))
+
+	events := newFrameEvents(c.observer, int64(opts.DimX*opts.DimY))
+	var wg sync.WaitGroup
+	for _, url := range c.workers {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			failures := 0
+			for ctx.Err() == nil {
+				var task tileTask
+				select {
+				case <-ctx.Done():
+					return
+				case task = <-queue:
+				}
+				buf, err := c.renderTile(ctx, url, newTileJob(cam, opts, task.tile))
+				if err == nil {
+					copyTile(out, task.tile, buf)
+					events.tileDone(task.tile)
+					failures = 0
+					if remaining.Add(-1) == 0 {
+						cancel(nil)
+					}
+					continue
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				if errors.Is(err, ErrRejected) {
+					cancel(fmt.Errorf("tile %v: %w", task.tile, err))
+					return
+				}
+
+				task.attempts++
+				log.Printf("Worker %s failed tile %v (attempt %d): %v", url, task.tile, task.attempts, err)
+				if task.attempts >= c.opts.MaxAttempts {
+					cancel(fmt.Errorf("tile %v failed %d times: %w", task.tile, task.attempts, err))
+					return
+				}
+				queue <- task
+				failures++
+				if failures >= c.opts.MaxFailures {
+					log.Printf("Giving up on worker %s after %d failures", url, failures)
+					if alive.Add(-1) == 0 {
+						cancel(ErrNoWorkers)
+					}
+					return
+				}
+				select {
+				case <-ctx.Done():
+				case <-time.After(c.opts.Retry):
+				}
+			}
+		}(url)
+	}
+	wg.Wait()
+
+	if remaining.Load() > 0 {
+		err := context.Cause(ctx)
+		events.finished(err)
+		return nil, err
+	}
+	events.passDone()
+	events.finished(nil)
+	return out, nil
+}
+
+// renderTile posts a tile job to a worker and waits for its result
+func (c *Coordinator) renderTile(ctx context.Context, url string, job TileJob) (*framebuffer.Buffer, error) {
+	if c.opts.TileTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.TileTimeout)
+		defer cancel()
+	}
+	body := bytes.Buffer{}
+	if err := encode(&body, job); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		err := fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+		if resp.StatusCode == http.StatusBadRequest && resp.Header.Get(RejectedHeader) != "" {
+			err = fmt.Errorf("%w: %w", ErrRejected, err)
+		}
+		return nil, err
+	}
+	var res TileResult
+	if err := decode(resp.Body, &res); err != nil {
+		return nil, err
+	}
+	if err := res.check(job.Tile); err != nil {
+		return nil, err
+	}
+	return res.Radiance, nil
+}
+
+// copyTile writes the radiance of a tile into its place in the frame.
+// Tiles don't overlap, so workers can copy at the same time.
+func copyTile(dst *framebuffer.Buffer, tile image.Rectangle, src *framebuffer.Buffer) {
+	for y := tile.Min.Y; y < tile.Max.Y; y++ {
+		row := src.Pix[(y-tile.Min.Y)*src.Width : (y-tile.Min.Y+1)*src.Width]
+		copy(dst.Pix[dst.Index(tile.Min.X, y):], row)
+	}
+}
+
+// frameEvents sends the events of a distributed frame
+type frameEvents struct {
+	mtx      sync.Mutex
+	observer renderer.Observer
+	start    time.Time
+	done     int64
+	total    int64
+}
+
+func newFrameEvents(observer renderer.Observer, total int64) *frameEvents {
+	ev := &frameEvents{observer: observer, start: time.Now(), total: total}
+	ev.send(renderer.Event{Kind: renderer.EventStarted})
+	return ev
+}
+
+func (ev *frameEvents) send(e renderer.Event) {
+	if ev.observer == nil {
+		return
+	}
+	ev.mtx.Lock()
+	defer ev.mtx.Unlock()
+	if e.Kind == renderer.EventTileDone {
+		ev.done += int64(e.Tile.Dx() * e.Tile.Dy())
+	}
+	e.Done = ev.done
+	e.Total = ev.total
+	e.Elapsed = time.Since(ev.start)
+	ev.observer.OnEvent(e)
+}
+
+func (ev *frameEvents) tileDone(tile image.Rectangle) {
+	ev.send(renderer.Event{Kind: renderer.EventTileDone, Tile: tile})
+}
+
+func (ev *frameEvents) passDone() {
+	ev.send(renderer.Event{Kind: renderer.EventPassDone, Pass: renderer.PassTiles, Duration: time.Since(ev.start)})
+}
+
+func (ev *frameEvents) finished(err error) {
+	ev.send(renderer.Event{Kind: renderer.EventFinished, Duration: time.Since(ev.start), Err: err})
+}
@@ -0,0 +1,90 @@
+package cluster
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/Solidsilver/go-ray-march/pkg/renderer"
+)
+
+// SceneFunc builds the renderer a worker renders tiles with. It has to
+// build the same scene as the coordinator's for the tiles to fit together.
+type SceneFunc func(opts renderer.RenderOpts) *renderer.Renderer
+
+// Worker renders the tile jobs posted to it. Every job gets its own
+// renderer, so a worker can render several tiles at once.
+type Worker struct {
+	newScene SceneFunc
+	// threads is the number of goroutines each tile is rendered with,
+	// in place of the coordinator's worker count
+	threads int
+}
+
+func NewWorker(newScene SceneFunc, threads int) *Worker {
+	return &Worker{newScene: newScene, threads: max(threads, 1)}
+}
+
+// Handler returns the HTTP handler serving tile jobs on TilePath
+func (w *Worker) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(TilePath, w.serveTile)
+	return mux
+}
+
+func (w *Worker) serveTile(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(rw, "tile jobs have to be posted", http.StatusMethodNotAllowed)
+		return
+	}
+	var job TileJob
+	if err := decode(req.Body, &job); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := job.validate(); err != nil {
+		reject(rw, err)
+		return
+	}
+
+	res, err := w.render(req, job)
+	if err != nil {
+		log.Printf("Failed to render tile %v: %v", job.Tile, err)
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/octet-stream")
+	if err := encode(rw, res); err != nil {
+		log.Printf("Failed to send tile %v: %v", job.Tile, err)
+	}
+}
+
+// reject refuses a job whose options no worker can render
+func reject(rw http.ResponseWriter, err error) {
+	rw.Header().Set(RejectedHeader, "true")
+	http.Error(rw, err.Error(), http.StatusBadRequest)
+}
+
+func (w *Worker) render(req *http.Request, job TileJob) (TileResult, error) {
+	job.Opts.Workers = w.threads
+	// RenderTile only holds the tile, so the camera doesn't need
+	// to be the size of the frame
+	sceneOpts := job.Opts
+	sceneOpts.DimX, sceneOpts.DimY = job.Tile.Dx(), job.Tile.Dy()
+	r := w.newScene(sceneOpts)
+	r.UpdateCamera(func(c *renderer.Camera) {
+		c.SetPose(job.Pose)
+		c.SetUp(job.Up)
+		c.SetLens(job.Lens)
+		c.SetProjection(job.Projection)
+		if job.Motion != nil {
+			c.SetMotion(*job.Motion)
+		} else {
+			c.ClearMotion()
+		}
+	})
+	buf, err := r.RenderTile(req.Context(), job.Opts, job.Tile)
+	if err != nil {
+		return TileResult{}, err
+	}
+	return TileResult{Tile: job.Tile, Radiance: buf}, nil
+}
@@ -0,0 +1,152 @@
+// Package denoise removes sampling noise from rendered images with an
+// edge-avoiding à-trous wavelet filter, guided by the normal, depth and
+// albedo of each pixel so that geometric and texture edges stay sharp.
+package denoise
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+// Guides are per-pixel feature buffers used to find edges.
+// Any guide may be nil, in which case it is ignored.
+type Guides struct {
+	Normal *framebuffer.Buffer
+	// Depth holds the linear depth of each pixel in every channel
+	Depth  *framebuffer.Buffer
+	Albedo *framebuffer.Buffer
+}
+
+type Options struct {
+	// Iterations is the number of à-trous passes. Each pass doubles the
+	// spacing of the kernel taps, so the filter reaches 2^(Iterations+1)
+	// pixels in each direction.
+	Iterations int
+	// SigmaColor controls how different two colors can be and still be
+	// blended. It is halved every iteration.
+	SigmaColor float64
+	// SigmaNormal controls how different two normals can be
+	SigmaNormal float64
+	// SigmaDepth is the relative depth difference allowed per pixel of distance
+	SigmaDepth float64
+	// SigmaAlbedo controls how different two albedos can be
+	SigmaAlbedo float64
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Iterations:  5,
+		SigmaColor:  0.5,
+		SigmaNormal: 0.3,
+		SigmaDepth:  0.02,
+		SigmaAlbedo: 0.1,
+	}
+}
+
+func (o Options) String() string {
+	return fmt.Sprintf("{iterations: %d, sigmaColor: %0.3f, sigmaNormal: %0.3f, sigmaDepth: %0.3f, sigmaAlbedo: %0.3f}", o.Iterations, o.SigmaColor, o.SigmaNormal, o.SigmaDepth, o.SigmaAlbedo)
+}
+
+var kernel = [5]float64{1.0 / 16, 1.0 / 4, 3.0 / 8, 1.0 / 4, 1.0 / 16}
+
+// ATrous returns a denoised copy of img. The guides must be
+// the same size as img.
+func ATrous(img *framebuffer.Buffer, guides Guides, opts Options) *framebuffer.Buffer {
+	src := img.Copy()
+	dst := framebuffer.New(img.Width, img.Height)
+	sigmaColor := opts.SigmaColor
+	for i := range opts.Iterations {
+		step := 1 << i
+		parallelRows(img.Height, func(y int) {
+			for x := 0; x < img.Width; x++ {
+				dst.Set(x, y, filterPixel(src, guides, opts, sigmaColor, step, x, y))
+			}
+		})
+		src, dst = dst, src
+		sigmaColor /= 2
+	}
+	return src
+}
+
+func filterPixel(src *framebuffer.Buffer, guides Guides, opts Options, sigmaColor float64, step, x, y int) vec3.Vec3 {
+	center := src.At(x, y)
+	centerMapped := compress(center)
+	sum := vec3.Zero
+	weightSum := 0.0
+	for ky := -2; ky <= 2; ky++ {
+		for kx := -2; kx <= 2; kx++ {
+			qx, qy := x+kx*step, y+ky*step
+			if !src.InBounds(qx, qy) {
+				continue
+			}
+			sample := src.At(qx, qy)
+			weight := kernel[kx+2] * kernel[ky+2]
+			weight *= gaussian(compress(sample).Sub(centerMapped), sigmaColor)
+			if guides.Normal != nil {
+				weight *= gaussian(guides.Normal.At(qx, qy).Sub(guides.Normal.At(x, y)), opts.SigmaNormal)
+			}
+			if guides.Albedo != nil {
+				weight *= gaussian(guides.Albedo.At(qx, qy).Sub(guides.Albedo.At(x, y)), opts.SigmaAlbedo)
+			}
+			if guides.Depth != nil {
+				weight *= depthWeight(guides.Depth.At(x, y).X, guides.Depth.At(qx, qy).X, opts.SigmaDepth, step*max(abs(kx), abs(ky)))
+			}
+			sum = sum.Add(sample.Mult(weight))
+			weightSum += weight
+		}
+	}
+	if weightSum == 0 {
+		return center
+	}
+	return sum.Div(weightSum)
+}
+
+// compress maps HDR colors into [0, 1) so that very
+// bright pixels don't dominate the color distance
+func compress(c vec3.Vec3) vec3.Vec3 {
+	return vec3.New(c.X/(1+math.Abs(c.X)), c.Y/(1+math.Abs(c.Y)), c.Z/(1+math.Abs(c.Z)))
+}
+
+func gaussian(diff vec3.Vec3, sigma float64) float64 {
+	if sigma <= 0 {
+		return 1
+	}
+	return math.Exp(-vec3.Dot(diff, diff) / (sigma * sigma))
+}
+
+// depthWeight compares two depths relative to the center depth
+// and to how many pixels apart they are
+func depthWeight(center, other, sigma float64, pixels int) float64 {
+	if sigma <= 0 {
+		return 1
+	}
+	scale := sigma * math.Max(math.Abs(center), 1e-6) * float64(max(pixels, 1))
+	return math.Exp(-math.Abs(center-other) / scale)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func parallelRows(height int, f func(y int)) {
+	workers := runtime.NumCPU()
+	var wg sync.WaitGroup
+	for id := range workers {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for y := id; y < height; y += workers {
+				f(y)
+			}
+		}(id)
+	}
+	wg.Wait()
+}
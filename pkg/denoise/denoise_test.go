@@ -0,0 +1,60 @@
+package denoise
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+func variance(buf *framebuffer.Buffer, x0, x1 int) float64 {
+	sum, sumSq, n := 0.0, 0.0, 0.0
+	for y := 0; y < buf.Height; y++ {
+		for x := x0; x < x1; x++ {
+			v := buf.At(x, y).X
+			sum += v
+			sumSq += v * v
+			n++
+		}
+	}
+	mean := sum / n
+	return sumSq/n - mean*mean
+}
+
+func TestATrousReducesNoise(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	img := framebuffer.New(32, 32)
+	for i := range img.Pix {
+		img.Pix[i] = vec3.OfSize(0.5 + (rnd.Float64()-0.5)*0.2)
+	}
+	out := ATrous(img, Guides{}, DefaultOptions())
+	before, after := variance(img, 0, 32), variance(out, 0, 32)
+	if after >= before/4 {
+		t.Errorf("Expected variance to drop by at least 4x. Got %f -> %f", before, after)
+	}
+}
+
+func TestATrousKeepsNormalEdges(t *testing.T) {
+	img := framebuffer.New(32, 32)
+	normals := framebuffer.New(32, 32)
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			if x < 16 {
+				img.Set(x, y, vec3.OfSize(0.1))
+				normals.Set(x, y, vec3.UnitX)
+			} else {
+				img.Set(x, y, vec3.OfSize(0.9))
+				normals.Set(x, y, vec3.UnitZ)
+			}
+		}
+	}
+	out := ATrous(img, Guides{Normal: normals}, DefaultOptions())
+	if left := out.At(15, 16).X; math.Abs(left-0.1) > 0.01 {
+		t.Errorf("Expected the left side of the edge to stay at 0.1. Got %f", left)
+	}
+	if right := out.At(16, 16).X; math.Abs(right-0.9) > 0.01 {
+		t.Errorf("Expected the right side of the edge to stay at 0.9. Got %f", right)
+	}
+}
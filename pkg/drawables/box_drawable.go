@@ -3,7 +3,6 @@ package drawables
 import (
 	"image/color"
 	"math"
-	"math/rand"
 
 	"github.com/Solidsilver/go-ray-march/pkg/utils"
 	"github.com/Solidsilver/go-ray-march/pkg/vec3"
@@ -17,7 +16,7 @@ type Box struct {
 }
 
 func NewBox(pos, bounds vec3.Vec3, color color.RGBA) Box {
-	id := rand.Int63()
+	id := nextID()
 	return Box{pos, bounds, color, id}
 }
 
@@ -3,6 +3,7 @@ package drawables
 import (
 	"image/color"
 	"math"
+	"sync/atomic"
 
 	"github.com/Solidsilver/go-ray-march/pkg/vec3"
 )
@@ -17,6 +18,15 @@ type Drawable interface {
 	IsLight() bool
 }
 
+// lastID is the ID of the most recently created drawable
+var lastID atomic.Int64
+
+// nextID returns a new drawable ID. IDs tell drawables apart but depend
+// on everything built before, so scenes number their own objects.
+func nextID() int64 {
+	return lastID.Add(1)
+}
+
 func Equals(d1, d2 Drawable) bool {
 	if d1 != nil && d2 != nil {
 		return d1.ID() == d2.ID()
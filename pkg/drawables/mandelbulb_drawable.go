@@ -3,7 +3,6 @@ package drawables
 import (
 	"image/color"
 	"math"
-	"math/rand"
 
 	"github.com/Solidsilver/go-ray-march/pkg/utils"
 	"github.com/Solidsilver/go-ray-march/pkg/vec3"
@@ -23,7 +22,7 @@ type MandelBulb struct {
 }
 
 func NewMandelB(iter int, bail float64, pow float64, pos vec3.Vec3, color color.RGBA, repeating bool) MandelBulb {
-	id := rand.Int63()
+	id := nextID()
 	return MandelBulb{
 		iter,
 		bail,
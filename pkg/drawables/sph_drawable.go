@@ -2,7 +2,6 @@ package drawables
 
 import (
 	"image/color"
-	"math/rand"
 
 	"github.com/Solidsilver/go-ray-march/pkg/vec3"
 )
@@ -18,12 +17,12 @@ type Sphere struct {
 }
 
 func NewSphere(pos vec3.Vec3, rad float64, color color.RGBA, repeating bool) Sphere {
-	id := rand.Int63()
+	id := nextID()
 	return Sphere{pos, rad, color, id, repeating, false, vec3.RGBAToVec3(color)}
 }
 
 func NewLight(pos vec3.Vec3, rad float64, color color.RGBA, repeating bool) Sphere {
-	id := rand.Int63()
+	id := nextID()
 	return Sphere{pos, rad, color, id, repeating, true, vec3.RGBAToVec3(color)}
 }
 
@@ -2,7 +2,6 @@ package drawables
 
 import (
 	"image/color"
-	"math/rand"
 
 	"github.com/Solidsilver/go-ray-march/pkg/utils"
 	"github.com/Solidsilver/go-ray-march/pkg/vec3"
@@ -21,7 +20,7 @@ func NewTorus(pos vec3.Vec3, majorD, minorD float64, color color.RGBA) Torus {
 		Center:    pos,
 		Diameters: utils.NewVec2(majorD, minorD),
 		color:     color,
-		id:        rand.Int63(),
+		id:        nextID(),
 	}
 }
 
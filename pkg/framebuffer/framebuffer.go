@@ -0,0 +1,70 @@
+// Package framebuffer provides a floating point RGB image used to
+// accumulate linear radiance before it is tone mapped for display.
+package framebuffer
+
+import (
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+// A Buffer is a Width x Height grid of linear RGB values,
+// stored row by row
+type Buffer struct {
+	Width  int
+	Height int
+	Pix    []vec3.Vec3
+}
+
+// New creates a black buffer of the given size
+func New(width, height int) *Buffer {
+	return &Buffer{
+		Width:  width,
+		Height: height,
+		Pix:    make([]vec3.Vec3, width*height),
+	}
+}
+
+// Index returns the position of pixel (x, y) in Pix
+func (b *Buffer) Index(x, y int) int {
+	return y*b.Width + x
+}
+
+// InBounds checks if (x, y) is inside the buffer
+func (b *Buffer) InBounds(x, y int) bool {
+	return x >= 0 && y >= 0 && x < b.Width && y < b.Height
+}
+
+// At returns the value of pixel (x, y)
+func (b *Buffer) At(x, y int) vec3.Vec3 {
+	return b.Pix[b.Index(x, y)]
+}
+
+// AtClamped returns the value of pixel (x, y), with coordinates
+// outside the buffer clamped to its nearest edge
+func (b *Buffer) AtClamped(x, y int) vec3.Vec3 {
+	x = min(max(x, 0), b.Width-1)
+	y = min(max(y, 0), b.Height-1)
+	return b.Pix[b.Index(x, y)]
+}
+
+// Set sets the value of pixel (x, y)
+func (b *Buffer) Set(x, y int, c vec3.Vec3) {
+	b.Pix[b.Index(x, y)] = c
+}
+
+// Clear sets every pixel to black
+func (b *Buffer) Clear() {
+	clear(b.Pix)
+}
+
+// Copy returns a deep copy of the buffer
+func (b *Buffer) Copy() *Buffer {
+	cp := New(b.Width, b.Height)
+	copy(cp.Pix, b.Pix)
+	return cp
+}
+
+// Luminance returns the relative luminance of a linear
+// Rec. 709 color
+func Luminance(c vec3.Vec3) float64 {
+	return 0.2126*c.X + 0.7152*c.Y + 0.0722*c.Z
+}
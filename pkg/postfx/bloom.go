@@ -0,0 +1,87 @@
+package postfx
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+)
+
+// Bloom makes bright areas glow by blurring everything above a
+// luminance threshold at several scales and adding it back
+type Bloom struct {
+	// Threshold is the luminance above which pixels bloom
+	Threshold float64
+	// Intensity scales the glow added to the image
+	Intensity float64
+	// Levels is the number of successively halved scales the glow is blurred at
+	Levels int
+}
+
+func DefaultBloom() Bloom {
+	return Bloom{
+		Threshold: 1.0,
+		Intensity: 0.3,
+		Levels:    5,
+	}
+}
+
+func parseBloom(params Params) (Effect, error) {
+	b := DefaultBloom()
+	var err error
+	if b.Threshold, err = params.float("threshold", b.Threshold); err != nil {
+		return nil, err
+	}
+	if b.Intensity, err = params.float("intensity", b.Intensity); err != nil {
+		return nil, err
+	}
+	if b.Levels, err = params.int("levels", b.Levels); err != nil {
+		return nil, err
+	}
+	// a negative threshold would bloom black pixels, dividing by their luminance
+	err = errors.Join(
+		atLeast("threshold", b.Threshold, 0),
+		atLeast("intensity", b.Intensity, 0),
+		atLeast("levels", float64(b.Levels), 1),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b Bloom) Name() string {
+	return fmt.Sprintf("bloom{threshold: %0.2f, intensity: %0.2f, levels: %d}", b.Threshold, b.Intensity, b.Levels)
+}
+
+func (b Bloom) Stage() Stage {
+	return SceneReferred
+}
+
+func (b Bloom) Apply(buf *framebuffer.Buffer) {
+	bright := framebuffer.New(buf.Width, buf.Height)
+	for i, px := range buf.Pix {
+		lum := framebuffer.Luminance(px)
+		if lum > b.Threshold {
+			bright.Pix[i] = px.Mult((lum - b.Threshold) / lum)
+		}
+	}
+
+	glow := framebuffer.New(buf.Width, buf.Height)
+	level := bright
+	for range b.Levels {
+		level = blur(downsample(level))
+		scaled := upsample(level, buf.Width, buf.Height)
+		for i, px := range scaled.Pix {
+			glow.Pix[i] = glow.Pix[i].Add(px)
+		}
+		if level.Width == 1 && level.Height == 1 {
+			break
+		}
+	}
+
+	weight := b.Intensity / float64(max(b.Levels, 1))
+	for i := range buf.Pix {
+		buf.Pix[i] = buf.Pix[i].Add(glow.Pix[i].Mult(weight))
+	}
+}
@@ -0,0 +1,204 @@
+package postfx
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+// ColorGrade adjusts the shadows, midtones and highlights with
+// lift/gamma/gain and then optionally looks the result up in a 3D LUT
+type ColorGrade struct {
+	// Lift raises the shadows while leaving white unchanged
+	Lift vec3.Vec3
+	// Gamma bends the midtones; values above 1 brighten them
+	Gamma vec3.Vec3
+	// Gain scales the highlights while leaving black unchanged
+	Gain vec3.Vec3
+	LUT  *LUT3D
+}
+
+func DefaultColorGrade() ColorGrade {
+	return ColorGrade{
+		Lift:  vec3.Zero,
+		Gamma: vec3.One,
+		Gain:  vec3.One,
+	}
+}
+
+func parseColorGrade(params Params) (Effect, error) {
+	g := DefaultColorGrade()
+	var err error
+	if g.Lift, err = params.vec("lift", g.Lift); err != nil {
+		return nil, err
+	}
+	if g.Gamma, err = params.vec("gamma", g.Gamma); err != nil {
+		return nil, err
+	}
+	if g.Gain, err = params.vec("gain", g.Gain); err != nil {
+		return nil, err
+	}
+	if path, ok := params["lut"]; ok {
+		if g.LUT, err = LoadCubeLUT(path); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+func (g ColorGrade) Name() string {
+	lut := "none"
+	if g.LUT != nil {
+		lut = g.LUT.Title
+	}
+	return fmt.Sprintf("grade{lift: %s, gamma: %s, gain: %s, lut: %s}", g.Lift, g.Gamma, g.Gain, lut)
+}
+
+func (g ColorGrade) Stage() Stage {
+	return DisplayReferred
+}
+
+func (g ColorGrade) Apply(buf *framebuffer.Buffer) {
+	for i, px := range buf.Pix {
+		px = g.Grade(px)
+		if g.LUT != nil {
+			px = g.LUT.Lookup(px)
+		}
+		buf.Pix[i] = px
+	}
+}
+
+// Grade applies lift, gamma and gain to a single color
+func (g ColorGrade) Grade(c vec3.Vec3) vec3.Vec3 {
+	grade := func(x, lift, gamma, gain float64) float64 {
+		x = gain * (x + lift*(1-x))
+		if x <= 0 || gamma <= 0 {
+			return x
+		}
+		return math.Pow(x, 1/gamma)
+	}
+	return vec3.New(
+		grade(c.X, g.Lift.X, g.Gamma.X, g.Gain.X),
+		grade(c.Y, g.Lift.Y, g.Gamma.Y, g.Gain.Y),
+		grade(c.Z, g.Lift.Z, g.Gamma.Z, g.Gain.Z),
+	)
+}
+
+// LUT3D is a 3D color lookup table, as stored in .cube files
+type LUT3D struct {
+	Title     string
+	Size      int
+	DomainMin vec3.Vec3
+	DomainMax vec3.Vec3
+	// Table holds Size^3 entries with red changing fastest, then green, then blue
+	Table []vec3.Vec3
+}
+
+// LoadCubeLUT reads a 3D LUT in the Adobe/Resolve .cube format
+func LoadCubeLUT(path string) (*LUT3D, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lut := &LUT3D{Title: path, DomainMin: vec3.Zero, DomainMax: vec3.One}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		switch fields[0] {
+		case "TITLE":
+			lut.Title = strings.Trim(strings.TrimPrefix(text, "TITLE"), " \"")
+		case "LUT_3D_SIZE":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("%s:%d: malformed LUT_3D_SIZE", path, line)
+			}
+			if lut.Size, err = strconv.Atoi(fields[1]); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			lut.Table = make([]vec3.Vec3, 0, lut.Size*lut.Size*lut.Size)
+		case "DOMAIN_MIN", "DOMAIN_MAX":
+			v, err := parseCubeVec(fields[1:])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			if fields[0] == "DOMAIN_MIN" {
+				lut.DomainMin = v
+			} else {
+				lut.DomainMax = v
+			}
+		case "LUT_1D_SIZE":
+			return nil, fmt.Errorf("%s:%d: 1D LUTs are not supported", path, line)
+		default:
+			v, err := parseCubeVec(fields)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			lut.Table = append(lut.Table, v)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if lut.Size < 2 {
+		return nil, fmt.Errorf("%s: missing or invalid LUT_3D_SIZE", path)
+	}
+	if len(lut.Table) != lut.Size*lut.Size*lut.Size {
+		return nil, fmt.Errorf("%s: expected %d entries, got %d", path, lut.Size*lut.Size*lut.Size, len(lut.Table))
+	}
+	return lut, nil
+}
+
+func parseCubeVec(fields []string) (vec3.Vec3, error) {
+	if len(fields) != 3 {
+		return vec3.Zero, fmt.Errorf("expected 3 values, got %d", len(fields))
+	}
+	var nums [3]float64
+	for i, field := range fields {
+		num, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return vec3.Zero, err
+		}
+		nums[i] = num
+	}
+	return vec3.New(nums[0], nums[1], nums[2]), nil
+}
+
+func (lut *LUT3D) at(r, g, b int) vec3.Vec3 {
+	return lut.Table[(b*lut.Size+g)*lut.Size+r]
+}
+
+// Lookup maps a color through the LUT with trilinear interpolation
+func (lut *LUT3D) Lookup(c vec3.Vec3) vec3.Vec3 {
+	extent := lut.DomainMax.Sub(lut.DomainMin)
+	scale := float64(lut.Size - 1)
+	coord := func(x, lo, ext float64) (int, float64) {
+		pos := vec3.Clamp((x-lo)/ext, 0, 1) * scale
+		i := min(int(pos), lut.Size-2)
+		return i, pos - float64(i)
+	}
+	r, fr := coord(c.X, lut.DomainMin.X, extent.X)
+	g, fg := coord(c.Y, lut.DomainMin.Y, extent.Y)
+	b, fb := coord(c.Z, lut.DomainMin.Z, extent.Z)
+
+	lerp := func(a, b vec3.Vec3, t float64) vec3.Vec3 {
+		return a.Mult(1 - t).Add(b.Mult(t))
+	}
+	c00 := lerp(lut.at(r, g, b), lut.at(r+1, g, b), fr)
+	c10 := lerp(lut.at(r, g+1, b), lut.at(r+1, g+1, b), fr)
+	c01 := lerp(lut.at(r, g, b+1), lut.at(r+1, g, b+1), fr)
+	c11 := lerp(lut.at(r, g+1, b+1), lut.at(r+1, g+1, b+1), fr)
+	return lerp(lerp(c00, c10, fg), lerp(c01, c11, fg), fb)
+}
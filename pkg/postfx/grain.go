@@ -0,0 +1,69 @@
+package postfx
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+)
+
+// FilmGrain adds monochrome noise that is strongest in the midtones.
+// The noise is a hash of the pixel position and Seed, so the same
+// seed always gives the same grain.
+type FilmGrain struct {
+	Strength float64
+	Seed     uint32
+}
+
+func DefaultFilmGrain() FilmGrain {
+	return FilmGrain{Strength: 0.04}
+}
+
+func parseFilmGrain(params Params) (Effect, error) {
+	g := DefaultFilmGrain()
+	var err error
+	if g.Strength, err = params.float("strength", g.Strength); err != nil {
+		return nil, err
+	}
+	if err := atLeast("strength", g.Strength, 0); err != nil {
+		return nil, err
+	}
+	seed, err := params.int("seed", int(g.Seed))
+	if err != nil {
+		return nil, err
+	}
+	g.Seed = uint32(seed)
+	return g, nil
+}
+
+func (g FilmGrain) Name() string {
+	return fmt.Sprintf("grain{strength: %0.3f, seed: %d}", g.Strength, g.Seed)
+}
+
+func (g FilmGrain) Stage() Stage {
+	return DisplayReferred
+}
+
+func (g FilmGrain) Apply(buf *framebuffer.Buffer) {
+	for y := 0; y < buf.Height; y++ {
+		for x := 0; x < buf.Width; x++ {
+			idx := buf.Index(x, y)
+			px := buf.Pix[idx]
+			noise := hashNoise(uint32(x), uint32(y), g.Seed) - 0.5
+			lum := math.Max(0, math.Min(1, framebuffer.Luminance(px)))
+			// 4*l*(1-l) peaks at mid grey and fades out in the shadows and highlights
+			buf.Pix[idx] = px.Plus(noise * g.Strength * 4 * lum * (1 - lum))
+		}
+	}
+}
+
+// hashNoise returns a pseudo random value in [0, 1) for the given inputs
+func hashNoise(x, y, seed uint32) float64 {
+	h := x*0x8da6b343 ^ y*0xd8163841 ^ seed*0xcb1ab31f
+	h ^= h >> 16
+	h *= 0x7feb352d
+	h ^= h >> 15
+	h *= 0x846ca68b
+	h ^= h >> 16
+	return float64(h) / (1 << 32)
+}
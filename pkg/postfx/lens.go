@@ -0,0 +1,98 @@
+package postfx
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+// Vignette darkens the image towards its corners
+type Vignette struct {
+	// Strength in [0, 1); higher values darken more of the image
+	Strength float64
+}
+
+func DefaultVignette() Vignette {
+	return Vignette{Strength: 0.05}
+}
+
+func parseVignette(params Params) (Effect, error) {
+	v := DefaultVignette()
+	var err error
+	if v.Strength, err = params.float("strength", v.Strength); err != nil {
+		return nil, err
+	}
+	// at a strength of 1 the unvignetted radius shrinks to nothing
+	if !(v.Strength >= 0 && v.Strength < 1) {
+		return nil, fmt.Errorf("strength has to be in [0, 1), got %g", v.Strength)
+	}
+	return v, nil
+}
+
+func (v Vignette) Name() string {
+	return fmt.Sprintf("vignette{strength: %0.2f}", v.Strength)
+}
+
+func (v Vignette) Stage() Stage {
+	return DisplayReferred
+}
+
+func (v Vignette) Apply(buf *framebuffer.Buffer) {
+	centerX, centerY := buf.Width/2, buf.Height/2
+	maxNorm := math.Hypot(float64(buf.Width), float64(buf.Height)) * math.Min(1, 1-math.Min(1, v.Strength))
+	for y := 0; y < buf.Height; y++ {
+		for x := 0; x < buf.Width; x++ {
+			dist := math.Hypot(float64(x-centerX), float64(y-centerY))
+			amt := math.Max(0, 1-dist/maxNorm)
+			idx := buf.Index(x, y)
+			buf.Pix[idx] = buf.Pix[idx].Mult(amt)
+		}
+	}
+}
+
+// ChromaticAberration fringes the image by scaling the red and blue
+// channels away from and towards the image center
+type ChromaticAberration struct {
+	// Strength is the relative scale difference of the red and
+	// blue channels at the image edge
+	Strength float64
+}
+
+func DefaultChromaticAberration() ChromaticAberration {
+	return ChromaticAberration{Strength: 0.005}
+}
+
+func parseChromaticAberration(params Params) (Effect, error) {
+	ca := DefaultChromaticAberration()
+	var err error
+	if ca.Strength, err = params.float("strength", ca.Strength); err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+func (ca ChromaticAberration) Name() string {
+	return fmt.Sprintf("chromatic{strength: %0.4f}", ca.Strength)
+}
+
+func (ca ChromaticAberration) Stage() Stage {
+	return SceneReferred
+}
+
+func (ca ChromaticAberration) Apply(buf *framebuffer.Buffer) {
+	src := buf.Copy()
+	centerX := float64(buf.Width-1) / 2
+	centerY := float64(buf.Height-1) / 2
+	for y := 0; y < buf.Height; y++ {
+		for x := 0; x < buf.Width; x++ {
+			offX := float64(x) - centerX
+			offY := float64(y) - centerY
+			red := sampleBilinear(src, centerX+offX*(1-ca.Strength), centerY+offY*(1-ca.Strength))
+			blue := sampleBilinear(src, centerX+offX*(1+ca.Strength), centerY+offY*(1+ca.Strength))
+			green := src.At(x, y)
+			buf.Set(x, y, vec3.New(red.X, green.Y, blue.Z))
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Package postfx provides screen-space effects that run on a finished
+// framebuffer, such as bloom, color grading and film grain.
+package postfx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+// Stage is the point of the resolve step an effect runs at
+type Stage int
+
+const (
+	// SceneReferred effects run on exposed linear radiance,
+	// before it is tone mapped
+	SceneReferred Stage = iota
+	// DisplayReferred effects run on tone mapped and
+	// encoded values in [0, 1]
+	DisplayReferred
+)
+
+// An Effect modifies a framebuffer in place
+type Effect interface {
+	Name() string
+	Stage() Stage
+	Apply(buf *framebuffer.Buffer)
+}
+
+// A Chain is an ordered list of effects. They run in the order they
+// appear in the chain, so scene-referred effects have to come before
+// display-referred ones, with tone mapping running in between.
+type Chain []Effect
+
+// Validate reports a scene-referred effect that comes after a
+// display-referred one, which can't run in the order given
+func (c Chain) Validate() error {
+	for i, effect := range c {
+		if i > 0 && effect.Stage() < c[i-1].Stage() {
+			return fmt.Errorf("post effect %s runs before tone mapping, so it can't come after %s", effect.Name(), c[i-1].Name())
+		}
+	}
+	return nil
+}
+
+// Apply runs every effect of the given stage on buf
+func (c Chain) Apply(stage Stage, buf *framebuffer.Buffer) {
+	for _, effect := range c {
+		if effect.Stage() == stage {
+			effect.Apply(buf)
+		}
+	}
+}
+
+func (c Chain) String() string {
+	names := make([]string, len(c))
+	for i, effect := range c {
+		names[i] = effect.Name()
+	}
+	return fmt.Sprintf("post: [%s]", strings.Join(names, ", "))
+}
+
+// Params are the key=value settings of an effect in a chain spec
+type Params map[string]string
+
+type effectParser func(params Params) (Effect, error)
+
+var effectParsers = map[string]effectParser{
+	"vignette":  parseVignette,
+	"bloom":     parseBloom,
+	"grade":     parseColorGrade,
+	"chromatic": parseChromaticAberration,
+	"sharpen":   parseSharpen,
+	"grain":     parseFilmGrain,
+}
+
+// ParseChain builds a chain from a spec of the form
+//
+//	bloom:threshold=1,intensity=0.4;grade:lut=film.cube;vignette
+//
+// Effects are separated by semicolons and run in the order given, so
+// scene-referred effects (bloom, chromatic) have to come before
+// display-referred ones (grade, vignette, sharpen, grain). Settings
+// that are left out keep their defaults.
+func ParseChain(spec string) (Chain, error) {
+	chain := Chain{}
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, paramStr, _ := strings.Cut(part, ":")
+		parse, ok := effectParsers[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown post effect: %q", name)
+		}
+		params := Params{}
+		for _, kv := range strings.Split(paramStr, ",") {
+			kv = strings.TrimSpace(kv)
+			if kv == "" {
+				continue
+			}
+			key, val, found := strings.Cut(kv, "=")
+			if !found {
+				return nil, fmt.Errorf("post effect %s: expected key=value, got %q", name, kv)
+			}
+			params[strings.ToLower(key)] = val
+		}
+		effect, err := parse(params)
+		if err != nil {
+			return nil, fmt.Errorf("post effect %s: %w", name, err)
+		}
+		chain = append(chain, effect)
+	}
+	return chain, chain.Validate()
+}
+
+func (p Params) float(key string, def float64) (float64, error) {
+	val, ok := p[key]
+	if !ok {
+		return def, nil
+	}
+	return strconv.ParseFloat(val, 64)
+}
+
+func (p Params) int(key string, def int) (int, error) {
+	val, ok := p[key]
+	if !ok {
+		return def, nil
+	}
+	return strconv.Atoi(val)
+}
+
+// atLeast makes sure the setting key isn't below lo
+func atLeast(key string, val, lo float64) error {
+	if !(val >= lo) {
+		return fmt.Errorf("%s has to be at least %g, got %g", key, lo, val)
+	}
+	return nil
+}
+
+// vec reads either a single number used for every channel
+// or three numbers separated by slashes (r/g/b)
+func (p Params) vec(key string, def vec3.Vec3) (vec3.Vec3, error) {
+	val, ok := p[key]
+	if !ok {
+		return def, nil
+	}
+	parts := strings.Split(val, "/")
+	nums := make([]float64, len(parts))
+	for i, part := range parts {
+		num, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return def, err
+		}
+		nums[i] = num
+	}
+	switch len(nums) {
+	case 1:
+		return vec3.OfSize(nums[0]), nil
+	case 3:
+		return vec3.New(nums[0], nums[1], nums[2]), nil
+	default:
+		return def, fmt.Errorf("%s: expected 1 or 3 values, got %d", key, len(nums))
+	}
+}
@@ -0,0 +1,85 @@
+package postfx
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+func TestParseChain(t *testing.T) {
+	chain, err := ParseChain("bloom:threshold=2,levels=3; vignette ;grade:gain=1.1/1/0.9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != 3 {
+		t.Fatalf("Expected 3 effects. Got %d", len(chain))
+	}
+	bloom, ok := chain[0].(Bloom)
+	if !ok || bloom.Threshold != 2 || bloom.Levels != 3 {
+		t.Errorf("Expected bloom with threshold 2 and 3 levels. Got %v", chain[0].Name())
+	}
+	grade := chain[2].(ColorGrade)
+	if !grade.Gain.Eq(vec3.New(1.1, 1, 0.9)) {
+		t.Errorf("Expected gain (1.1, 1, 0.9). Got %v", grade.Gain)
+	}
+
+	if _, err := ParseChain("lensflare"); err == nil {
+		t.Errorf("Expected unknown effect to return an error")
+	}
+	if _, err := ParseChain("bloom:threshold"); err == nil {
+		t.Errorf("Expected a setting without a value to return an error")
+	}
+	if _, err := ParseChain("grain;bloom"); err == nil {
+		t.Errorf("Expected bloom after grain to return an error")
+	}
+	for _, spec := range []string{
+		"vignette:strength=1",
+		"vignette:strength=-0.1",
+		"bloom:threshold=-1",
+		"bloom:levels=0",
+		"bloom:intensity=NaN",
+		"sharpen:amount=-0.5",
+		"grain:strength=-0.1",
+	} {
+		if _, err := ParseChain(spec); err == nil {
+			t.Errorf("Expected %q to be out of range", spec)
+		}
+	}
+	if _, err := ParseChain("bloom:threshold=0; vignette:strength=0.99; sharpen:amount=0; grain:strength=0"); err != nil {
+		t.Errorf("Expected the edges of the ranges to be allowed. Got %v", err)
+	}
+}
+
+func TestIdentityCubeLUT(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("TITLE \"identity\"\nLUT_3D_SIZE 2\n")
+	for b := 0; b < 2; b++ {
+		for g := 0; g < 2; g++ {
+			for r := 0; r < 2; r++ {
+				fmt.Fprintf(&sb, "%d %d %d\n", r, g, b)
+			}
+		}
+	}
+	path := filepath.Join(t.TempDir(), "identity.cube")
+	if err := os.WriteFile(path, []byte(sb.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	lut, err := LoadCubeLUT(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lut.Title != "identity" {
+		t.Errorf("Expected title identity. Got %q", lut.Title)
+	}
+	in := vec3.New(0.25, 0.5, 0.75)
+	out := lut.Lookup(in)
+	if diff := out.Sub(in).Abs(); math.Max(diff.X, math.Max(diff.Y, diff.Z)) > 1e-9 {
+		t.Errorf("Expected identity LUT to return %v. Got %v", in, out)
+	}
+}
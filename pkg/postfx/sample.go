@@ -0,0 +1,79 @@
+package postfx
+
+import (
+	"math"
+
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+// sampleBilinear reads the buffer at the continuous pixel position (x, y),
+// where integer coordinates are pixel centers
+func sampleBilinear(buf *framebuffer.Buffer, x, y float64) vec3.Vec3 {
+	x0 := math.Floor(x)
+	y0 := math.Floor(y)
+	fx := x - x0
+	fy := y - y0
+	ix, iy := int(x0), int(y0)
+
+	top := buf.AtClamped(ix, iy).Mult(1 - fx).Add(buf.AtClamped(ix+1, iy).Mult(fx))
+	bottom := buf.AtClamped(ix, iy+1).Mult(1 - fx).Add(buf.AtClamped(ix+1, iy+1).Mult(fx))
+	return top.Mult(1 - fy).Add(bottom.Mult(fy))
+}
+
+// downsample halves the size of the buffer, averaging each 2x2 block
+func downsample(buf *framebuffer.Buffer) *framebuffer.Buffer {
+	out := framebuffer.New(max(buf.Width/2, 1), max(buf.Height/2, 1))
+	for y := 0; y < out.Height; y++ {
+		for x := 0; x < out.Width; x++ {
+			sum := buf.AtClamped(2*x, 2*y).
+				Add(buf.AtClamped(2*x+1, 2*y)).
+				Add(buf.AtClamped(2*x, 2*y+1)).
+				Add(buf.AtClamped(2*x+1, 2*y+1))
+			out.Set(x, y, sum.Div(4))
+		}
+	}
+	return out
+}
+
+// upsample resizes the buffer to width x height with bilinear filtering
+func upsample(buf *framebuffer.Buffer, width, height int) *framebuffer.Buffer {
+	out := framebuffer.New(width, height)
+	scaleX := float64(buf.Width) / float64(width)
+	scaleY := float64(buf.Height) / float64(height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			srcX := (float64(x)+0.5)*scaleX - 0.5
+			srcY := (float64(y)+0.5)*scaleY - 0.5
+			out.Set(x, y, sampleBilinear(buf, srcX, srcY))
+		}
+	}
+	return out
+}
+
+var blurKernel = [5]float64{1.0 / 16, 4.0 / 16, 6.0 / 16, 4.0 / 16, 1.0 / 16}
+
+// blur applies a separable 5-tap binomial blur
+func blur(buf *framebuffer.Buffer) *framebuffer.Buffer {
+	horizontal := framebuffer.New(buf.Width, buf.Height)
+	for y := 0; y < buf.Height; y++ {
+		for x := 0; x < buf.Width; x++ {
+			sum := vec3.Zero
+			for k, w := range blurKernel {
+				sum = sum.Add(buf.AtClamped(x+k-2, y).Mult(w))
+			}
+			horizontal.Set(x, y, sum)
+		}
+	}
+	out := framebuffer.New(buf.Width, buf.Height)
+	for y := 0; y < buf.Height; y++ {
+		for x := 0; x < buf.Width; x++ {
+			sum := vec3.Zero
+			for k, w := range blurKernel {
+				sum = sum.Add(horizontal.AtClamped(x, y+k-2).Mult(w))
+			}
+			out.Set(x, y, sum)
+		}
+	}
+	return out
+}
@@ -0,0 +1,45 @@
+package postfx
+
+import (
+	"fmt"
+
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+)
+
+// Sharpen applies an unsharp mask, boosting the difference
+// between each pixel and a blurred copy of the image
+type Sharpen struct {
+	Amount float64
+}
+
+func DefaultSharpen() Sharpen {
+	return Sharpen{Amount: 0.5}
+}
+
+func parseSharpen(params Params) (Effect, error) {
+	s := DefaultSharpen()
+	var err error
+	if s.Amount, err = params.float("amount", s.Amount); err != nil {
+		return nil, err
+	}
+	if err := atLeast("amount", s.Amount, 0); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s Sharpen) Name() string {
+	return fmt.Sprintf("sharpen{amount: %0.2f}", s.Amount)
+}
+
+func (s Sharpen) Stage() Stage {
+	return DisplayReferred
+}
+
+func (s Sharpen) Apply(buf *framebuffer.Buffer) {
+	blurred := blur(buf)
+	for i, px := range buf.Pix {
+		detail := px.Sub(blurred.Pix[i])
+		buf.Pix[i] = px.Add(detail.Mult(s.Amount))
+	}
+}
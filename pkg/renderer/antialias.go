@@ -0,0 +1,324 @@
+package renderer
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+// AAMode selects how many rays are traced per pixel
+type AAMode int
+
+const (
+	// AANone traces a single ray through the center of each pixel
+	AANone AAMode = iota
+	// AAGrid traces a fixed, regular NxN grid of rays per pixel
+	AAGrid
+	// AAJitter traces NxN stratified rays, each jittered inside its cell
+	AAJitter
+	// AAAdaptive traces one ray per pixel, then re-renders pixels whose
+	// neighbors differ in color, depth or object with NxN jittered rays
+	AAAdaptive
+)
+
+var aaModeNames = map[AAMode]string{
+	AANone:     "none",
+	AAGrid:     "grid",
+	AAJitter:   "jitter",
+	AAAdaptive: "adaptive",
+}
+
+func (m AAMode) String() string {
+	if name, ok := aaModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("AAMode(%d)", int(m))
+}
+
+// ParseAAMode converts a mode name (none, grid, jitter, adaptive)
+// into an AAMode
+func ParseAAMode(name string) (AAMode, error) {
+	for mode, modeName := range aaModeNames {
+		if strings.EqualFold(name, modeName) {
+			return mode, nil
+		}
+	}
+	return AANone, fmt.Errorf("unknown anti-aliasing mode: %q", name)
+}
+
+// AAFilter is the reconstruction filter used to weight the
+// samples of a pixel
+type AAFilter int
+
+const (
+	FilterBox AAFilter = iota
+	FilterTent
+	FilterMitchell
+)
+
+var aaFilterNames = map[AAFilter]string{
+	FilterBox:      "box",
+	FilterTent:     "tent",
+	FilterMitchell: "mitchell",
+}
+
+func (f AAFilter) String() string {
+	if name, ok := aaFilterNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("AAFilter(%d)", int(f))
+}
+
+// ParseAAFilter converts a filter name (box, tent, mitchell)
+// into an AAFilter
+func ParseAAFilter(name string) (AAFilter, error) {
+	for filter, filterName := range aaFilterNames {
+		if strings.EqualFold(name, filterName) {
+			return filter, nil
+		}
+	}
+	return FilterBox, fmt.Errorf("unknown reconstruction filter: %q", name)
+}
+
+// Radius returns the half-width of the filter footprint in pixels.
+// Samples for a pixel are spread over this footprint.
+func (f AAFilter) Radius() float64 {
+	switch f {
+	case FilterTent:
+		return 1.0
+	case FilterMitchell:
+		return 2.0
+	default:
+		return 0.5
+	}
+}
+
+// Weight returns the separable filter weight for a sample
+// offset (dx, dy) pixels from the pixel center
+func (f AAFilter) Weight(dx, dy float64) float64 {
+	return f.weight1D(dx) * f.weight1D(dy)
+}
+
+func (f AAFilter) weight1D(x float64) float64 {
+	x = math.Abs(x)
+	switch f {
+	case FilterTent:
+		return math.Max(0, 1-x)
+	case FilterMitchell:
+		return mitchell1D(x)
+	default:
+		if x <= 0.5 {
+			return 1
+		}
+		return 0
+	}
+}
+
+// mitchell1D evaluates the Mitchell-Netravali filter with B = C = 1/3
+func mitchell1D(x float64) float64 {
+	const b = 1.0 / 3.0
+	const c = 1.0 / 3.0
+	x2 := x * x
+	x3 := x2 * x
+	switch {
+	case x < 1:
+		return ((12-9*b-6*c)*x3 + (-18+12*b+6*c)*x2 + (6 - 2*b)) / 6
+	case x < 2:
+		return ((-b-6*c)*x3 + (6*b+30*c)*x2 + (-12*b-48*c)*x + (8*b + 24*c)) / 6
+	default:
+		return 0
+	}
+}
+
+type AntiAliasOpts struct {
+	Mode AAMode
+	// Samples is the number of rays along each pixel axis,
+	// so a pixel is sampled Samples*Samples times
+	Samples int
+	Filter  AAFilter
+	// Threshold is the color (or relative depth) difference between
+	// neighboring pixels above which adaptive mode supersamples
+	Threshold float64
+}
+
+func DefaultAntiAliasOpts() AntiAliasOpts {
+	return AntiAliasOpts{
+		Mode:      AANone,
+		Samples:   1,
+		Filter:    FilterBox,
+		Threshold: 0.1,
+	}
+}
+
+func (ao AntiAliasOpts) String() string {
+	return fmt.Sprintf("aa: {mode: %s, samples: %dx%d, filter: %s, threshold: %f}", ao.Mode, ao.Samples, ao.Samples, ao.Filter, ao.Threshold)
+}
+
+// superSample traces Samples*Samples rays stratified over the filter
+// footprint of the pixel and returns their filter-weighted average.
+func (r *Renderer) superSample(pt Point, shade pixelShader, regular bool, rng *RNG) pixelSample {
+	aa := r.opts.AA
+	n := max(aa.Samples, 1)
+	radius := aa.Filter.Radius()
+	cell := 2 * radius / float64(n)
+
+	sum := newSampleSum()
+	for sy := 0; sy < n; sy++ {
+		for sx := 0; sx < n; sx++ {
+			jx, jy := 0.5, 0.5
+			if !regular {
+				jx, jy = rng.Float64(), rng.Float64()
+			}
+			dx := (float64(sx)+jx)*cell - radius
+			dy := (float64(sy)+jy)*cell - radius
+			view := r.sliceFor(sy*n+sx, n*n, rng)
+			ray := view.camera.RayForSubPixel(float64(pt.X)+dx, float64(pt.Y)+dy, rng)
+			sum.add(shade(ray, view), aa.Filter.Weight(dx, dy))
+		}
+	}
+	return sum.average()
+}
+
+// averagePixel traces n rays through the center of the pixel, stratified
+// across the time slices of the shutter, and returns their average
+func (r *Renderer) averagePixel(pt Point, shade pixelShader, n int, rng *RNG) pixelSample {
+	sum := newSampleSum()
+	for i := range n {
+		view := r.sliceFor(i, n, rng)
+		sum.add(shade(view.camera.RayForPixel(pt, rng), view), 1)
+	}
+	return sum.average()
+}
+
+// sampleSum accumulates the weighted samples of a pixel. Values that
+// can't be blended, like the hit object, come from the nearest sample.
+type sampleSum struct {
+	nearest pixelSample
+	color   vec3.Vec3
+	normal  vec3.Vec3
+	albedo  vec3.Vec3
+	steps   float64
+	shadow  float64
+	weight  float64
+}
+
+func newSampleSum() sampleSum {
+	return sampleSum{nearest: pixelSample{depth: math.Inf(1)}}
+}
+
+func (s *sampleSum) add(sample pixelSample, weight float64) {
+	s.color = s.color.Add(sample.color.Mult(weight))
+	s.normal = s.normal.Add(sample.normal.Mult(weight))
+	s.albedo = s.albedo.Add(sample.albedo.Mult(weight))
+	s.steps += sample.steps * weight
+	s.shadow += sample.shadow * weight
+	s.weight += weight
+	if sample.depth < s.nearest.depth {
+		s.nearest = sample
+	}
+}
+
+// average returns the weighted average of the samples
+func (s *sampleSum) average() pixelSample {
+	out := pixelSample{
+		depth:       s.nearest.depth,
+		objID:       s.nearest.objID,
+		hit:         s.nearest.hit,
+		linearDepth: s.nearest.linearDepth,
+		position:    s.nearest.position,
+	}
+	if s.weight > 0 {
+		out.color = s.color.Div(s.weight)
+		out.albedo = s.albedo.Div(s.weight)
+		out.steps = s.steps / s.weight
+		out.shadow = s.shadow / s.weight
+	}
+	if s.normal.Norm() > 0 {
+		out.normal = s.normal.ToUnit()
+	}
+	return out
+}
+
+// beginAA prepares the per-pixel sample buffer that adaptive
+// anti-aliasing uses to find edges after the first pass
+func (r *Renderer) beginAA() {
+	if r.opts.AA.Mode == AAAdaptive && r.opts.AA.Samples > 1 {
+		r.aaSamples = make([]pixelSample, r.camera.Size())
+	} else {
+		r.aaSamples = nil
+	}
+}
+
+// finishAA runs the adaptive refinement pass, supersampling every
+// pixel that was marked as an edge in the first pass
+func (r *Renderer) finishAA(ctx context.Context, workers int, shade pixelShader) {
+	if r.aaSamples == nil || ctx.Err() != nil {
+		return
+	}
+	edges := r.findEdges()
+
+	var wg sync.WaitGroup
+	for id := range workers {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for i := id; i < len(edges); i += workers {
+				if ctx.Err() != nil {
+					return
+				}
+				pt := edges[i]
+				start := time.Now()
+				sample := r.superSample(pt, shade, false, r.pixelRNG(pt, streamRefine))
+				r.recordHeatmap(pt, sample, time.Since(start))
+				r.writeSample(pt, sample)
+			}
+		}(id)
+	}
+	wg.Wait()
+	r.aaSamples = nil
+}
+
+// findEdges returns the pixels whose color, depth or hit object differs
+// from one of their right or bottom neighbors. Both pixels of a
+// differing pair are returned.
+func (r *Renderer) findEdges() []Point {
+	sizeX := r.camera.SizeX
+	window := r.window()
+	threshold := r.opts.AA.Threshold
+	marked := make([]bool, len(r.aaSamples))
+	differs := func(a, b pixelSample) bool {
+		if a.objID != b.objID {
+			return true
+		}
+		colorDiff := a.color.Sub(b.color).Abs()
+		if math.Max(colorDiff.X, math.Max(colorDiff.Y, colorDiff.Z)) > threshold {
+			return true
+		}
+		return math.Abs(a.depth-b.depth) > threshold*math.Min(a.depth, b.depth)
+	}
+
+	for y := window.Min.Y; y < window.Max.Y; y++ {
+		for x := window.Min.X; x < window.Max.X; x++ {
+			idx := y*sizeX + x
+			if x+1 < window.Max.X && differs(r.aaSamples[idx], r.aaSamples[idx+1]) {
+				marked[idx], marked[idx+1] = true, true
+			}
+			if y+1 < window.Max.Y && differs(r.aaSamples[idx], r.aaSamples[idx+sizeX]) {
+				marked[idx], marked[idx+sizeX] = true, true
+			}
+		}
+	}
+
+	edges := []Point{}
+	for idx, isEdge := range marked {
+		if isEdge {
+			edges = append(edges, Point{idx % sizeX, idx / sizeX})
+		}
+	}
+	return edges
+}
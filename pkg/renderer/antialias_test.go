@@ -0,0 +1,73 @@
+package renderer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+)
+
+func TestParseAAMode(t *testing.T) {
+	for mode, name := range aaModeNames {
+		parsed, err := ParseAAMode(name)
+		if err != nil || parsed != mode {
+			t.Errorf("Expected %q to parse to %v. Got %v (%v)", name, mode, parsed, err)
+		}
+	}
+	if _, err := ParseAAMode("ssaa"); err == nil {
+		t.Errorf("Expected unknown mode to return an error")
+	}
+}
+
+func TestFilterWeights(t *testing.T) {
+	for filter := range aaFilterNames {
+		if w := filter.Weight(0, 0); w <= 0 {
+			t.Errorf("Expected %v to have a positive center weight. Got %f", filter, w)
+		}
+		r := filter.Radius()
+		if w := filter.Weight(r+0.01, 0); w != 0 {
+			t.Errorf("Expected %v to be zero outside its radius. Got %f", filter, w)
+		}
+	}
+}
+
+func TestAntiAliasingSmoothsEdges(t *testing.T) {
+	render := func(mode AAMode) *Renderer {
+		opts := testOpts()
+		opts.AA.Mode = mode
+		opts.AA.Samples = 4
+		r := newTestRenderer(opts)
+		if _, err := r.Render(context.Background(), opts); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	plain, aa := render(AANone), render(AAGrid)
+
+	// pixels on the silhouette of the sphere, whose center ray hits it
+	// while the one of the pixel to their left misses, should be blended
+	// between the sphere and the background
+	hit := func(x, y int) bool {
+		return shadeLighting2(plain.camera.RayForPixel(Point{x, y}, nil), plain).hit
+	}
+	edges, blended := 0, 0
+	for y := range plain.camera.SizeY {
+		for x := 1; x < plain.camera.SizeX; x++ {
+			if !hit(x, y) || hit(x-1, y) {
+				continue
+			}
+			sphere := framebuffer.Luminance(plain.camera.HDR.At(x, y))
+			bg := framebuffer.Luminance(plain.camera.HDR.At(x-1, y))
+			if sphere-bg < 0.05 {
+				continue
+			}
+			edges++
+			if got := framebuffer.Luminance(aa.camera.HDR.At(x, y)); got > bg && got < sphere {
+				blended++
+			}
+		}
+	}
+	if edges == 0 || blended < edges/2 {
+		t.Errorf("Expected anti-aliasing to blend the lit edges of the sphere. Got %d of %d blended", blended, edges)
+	}
+}
@@ -0,0 +1,197 @@
+package renderer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+	"github.com/Solidsilver/go-ray-march/pkg/utils"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+// An AOV (arbitrary output variable) is an extra pass
+// written alongside the beauty render for compositing
+type AOV string
+
+const (
+	// AOVDepth is the distance of the hit along the view direction
+	AOVDepth AOV = "depth"
+	// AOVNormal is the world space surface normal
+	AOVNormal AOV = "normal"
+	// AOVAlbedo is the unlit surface color
+	AOVAlbedo AOV = "albedo"
+	// AOVObjectID gives every drawable its own flat color
+	AOVObjectID AOV = "objectid"
+	// AOVSteps is the number of march steps taken
+	AOVSteps AOV = "steps"
+	// AOVShadow is the fraction of facing lights that are blocked
+	AOVShadow AOV = "shadow"
+	// AOVPosition is the world space hit position
+	AOVPosition AOV = "position"
+)
+
+var allAOVs = []AOV{AOVDepth, AOVNormal, AOVAlbedo, AOVObjectID, AOVSteps, AOVShadow, AOVPosition}
+
+// ParseAOVs converts a comma separated list of pass names into AOVs
+func ParseAOVs(list string) ([]AOV, error) {
+	aovs := []AOV{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		pass := AOV(name)
+		if !slices.Contains(allAOVs, pass) {
+			return nil, fmt.Errorf("unknown AOV pass: %q", name)
+		}
+		if !slices.Contains(aovs, pass) {
+			aovs = append(aovs, pass)
+		}
+	}
+	return aovs, nil
+}
+
+// aov returns the value of the given pass for this sample
+func (s pixelSample) aov(pass AOV) vec3.Vec3 {
+	switch pass {
+	case AOVDepth:
+		return vec3.OfSize(s.linearDepth)
+	case AOVNormal:
+		return s.normal
+	case AOVAlbedo:
+		return s.albedo
+	case AOVObjectID:
+		if !s.hit {
+			return vec3.Zero
+		}
+		return idColor(s.objID)
+	case AOVSteps:
+		return vec3.OfSize(s.steps)
+	case AOVShadow:
+		return vec3.OfSize(s.shadow)
+	case AOVPosition:
+		return s.position
+	}
+	return vec3.Zero
+}
+
+// idColor maps a drawable ID to a bright, stable color
+func idColor(id int64) vec3.Vec3 {
+	h := uint64(id)
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	channel := func(shift uint) float64 {
+		return 0.25 + 0.75*float64((h>>shift)&0xff)/255
+	}
+	return vec3.New(channel(0), channel(8), channel(16))
+}
+
+// beginAOVs makes sure there is a buffer for every requested pass and
+// every denoiser guide. Only the requested passes are given to the camera.
+func (r *Renderer) beginAOVs() {
+	passes := slices.Clone(r.opts.AOVs)
+	if r.opts.Denoise.Enabled {
+		for _, pass := range denoiseGuides {
+			if !slices.Contains(passes, pass) {
+				passes = append(passes, pass)
+			}
+		}
+	}
+	if len(passes) == 0 {
+		r.aovBufs = nil
+		r.camera.AOVs = nil
+		return
+	}
+
+	bufs := make(map[AOV]*framebuffer.Buffer, len(passes))
+	for _, pass := range passes {
+		buf, ok := r.aovBufs[pass]
+		if !ok || buf.Width != r.camera.SizeX || buf.Height != r.camera.SizeY {
+			buf = framebuffer.New(r.camera.SizeX, r.camera.SizeY)
+		}
+		bufs[pass] = buf
+	}
+	r.aovBufs = bufs
+
+	r.camera.AOVs = nil
+	if len(r.opts.AOVs) > 0 {
+		r.camera.AOVs = make(map[AOV]*framebuffer.Buffer, len(r.opts.AOVs))
+		for _, pass := range r.opts.AOVs {
+			r.camera.AOVs[pass] = bufs[pass]
+		}
+	}
+}
+
+// flushAOVs writes every AOV pass of the camera next
+// to the beauty image of the given frame
+func (c *Camera) flushAOVs(frame int) {
+	for pass, buf := range c.AOVs {
+		imgName := fmt.Sprintf("%s/render%03d_%s.png", c.flushDir, frame, pass)
+		utils.EncodePNGToPath(imgName, cropImage(EncodeAOV(pass, buf), c.output))
+	}
+}
+
+// EncodeAOV converts a pass into a 16 bit image. Depth and step counts are
+// normalized to the largest value in the frame, normals are mapped from
+// [-1, 1] to [0, 1] and positions are normalized to their bounding box.
+func EncodeAOV(pass AOV, buf *framebuffer.Buffer) image.Image {
+	bounds := image.Rect(0, 0, buf.Width, buf.Height)
+	switch pass {
+	case AOVDepth, AOVSteps, AOVShadow:
+		scale := 1.0
+		if pass != AOVShadow {
+			maxVal := 0.0
+			for _, px := range buf.Pix {
+				maxVal = math.Max(maxVal, px.X)
+			}
+			if maxVal > 0 {
+				scale = 1 / maxVal
+			}
+		}
+		img := image.NewGray16(bounds)
+		for y := 0; y < buf.Height; y++ {
+			for x := 0; x < buf.Width; x++ {
+				img.SetGray16(x, y, color.Gray16{Y: to16(buf.At(x, y).X * scale)})
+			}
+		}
+		return img
+	case AOVNormal:
+		return encodeRGB16(buf, func(v vec3.Vec3) vec3.Vec3 {
+			return v.Plus(1).Mult(0.5)
+		})
+	case AOVPosition:
+		lo := vec3.OfSize(math.Inf(1))
+		hi := vec3.OfSize(math.Inf(-1))
+		for _, px := range buf.Pix {
+			lo = vec3.Min(lo, px)
+			hi = vec3.Max(hi, px)
+		}
+		extent := vec3.Max(hi.Sub(lo), vec3.OfSize(1e-9))
+		return encodeRGB16(buf, func(v vec3.Vec3) vec3.Vec3 {
+			v = v.Sub(lo)
+			return vec3.New(v.X/extent.X, v.Y/extent.Y, v.Z/extent.Z)
+		})
+	default:
+		return encodeRGB16(buf, func(v vec3.Vec3) vec3.Vec3 { return v })
+	}
+}
+
+func encodeRGB16(buf *framebuffer.Buffer, mapping func(vec3.Vec3) vec3.Vec3) image.Image {
+	img := image.NewRGBA64(image.Rect(0, 0, buf.Width, buf.Height))
+	for y := 0; y < buf.Height; y++ {
+		for x := 0; x < buf.Width; x++ {
+			v := mapping(buf.At(x, y))
+			img.SetRGBA64(x, y, color.RGBA64{R: to16(v.X), G: to16(v.Y), B: to16(v.Z), A: 0xffff})
+		}
+	}
+	return img
+}
+
+func to16(x float64) uint16 {
+	return uint16(vec3.Clamp(x, 0, 1)*0xffff + 0.5)
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"sync"
 
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
 	"github.com/Solidsilver/go-ray-march/pkg/utils"
 	"github.com/Solidsilver/go-ray-march/pkg/vec3"
 )
@@ -17,6 +18,8 @@ type Camera struct {
 	SizeX        int
 	SizeY        int
 	Image        *image.RGBA
+	HDR          *framebuffer.Buffer
+	AOVs         map[AOV]*framebuffer.Buffer
 	frame        int
 	centerOffset Point
 	fov          float64
@@ -24,15 +27,34 @@ type Camera struct {
 	fov_hRad     float64
 	aspect       float64
 	up           vec3.Vec3
-	flushDir     string
-	flushMtx     sync.Mutex
+	// roll is the angle in degrees the image is rotated around Dir
+	roll       float64
+	lens       LensOpts
+	projection ProjectionOpts
+	shutter    Shutter
+	motionEnd  *CameraPose
+	// output is the part of the image written out, or the whole
+	// image if empty
+	output image.Rectangle
+	// offset is where the image of a band camera starts in the frame,
+	// and full the size of that frame
+	offset Point
+	full   Point
+	// shift moves the image of a perspective camera sideways, in
+	// pixels, to line up the views of a stereo rig
+	shift    float64
+	flushDir string
+	flushMtx *sync.Mutex
 }
 
 type CameraOpts struct {
-	Position vec3.Vec3
-	Size     utils.Vec2[float64]
-	Fov      float64
-	ImgDir   string
+	Position   vec3.Vec3
+	Size       utils.Vec2[float64]
+	Fov        float64
+	ImgDir     string
+	Lens       LensOpts
+	Projection ProjectionOpts
+	Shutter    Shutter
 }
 
 func NewCamera(pos vec3.Vec3, sizeX int, sizeY int, imgOut string) *Camera {
@@ -41,10 +63,10 @@ func NewCamera(pos vec3.Vec3, sizeX int, sizeY int, imgOut string) *Camera {
 
 func NewCameraFOV(pos vec3.Vec3, sizeX int, sizeY int, fov float64, imgOut string) *Camera {
 	opts := CameraOpts{
-		pos,
-		utils.NewVec2(float64(sizeX), float64(sizeY)),
-		fov,
-		imgOut,
+		Position: pos,
+		Size:     utils.NewVec2(float64(sizeX), float64(sizeY)),
+		Fov:      fov,
+		ImgDir:   imgOut,
 	}
 	return NewCameraOpts(opts)
 
@@ -65,13 +87,18 @@ func NewCameraOpts(opts CameraOpts) *Camera {
 	cam.aspect = float64(cam.SizeX) / float64(cam.SizeY)
 	cam.frame = 0
 	cam.Image = bgImg
+	cam.HDR = framebuffer.New(sizeX, sizeY)
 	cam.centerOffset = Point{cam.SizeX / 2, cam.SizeY / 2}
 
 	cam.fov = opts.Fov
 	cam.fov_vRad = utils.DegToRad(cam.fov)
 	cam.fov_hRad = math.Atan(math.Tan(cam.fov_vRad/2.0)*cam.aspect) * 2.0
 
+	cam.lens = opts.Lens
+	cam.projection = opts.Projection
+	cam.shutter = opts.Shutter
 	cam.flushDir = opts.ImgDir
+	cam.flushMtx = new(sync.Mutex)
 	return cam
 }
 
@@ -88,12 +115,22 @@ func (c *Camera) FlushToDisk() {
 	c.flushMtx.Unlock()
 	imgName := fmt.Sprintf("%s/render%03d.png", c.flushDir, curFrame)
 	// log.Info().Msgf("Encoding to path: %s", imgName)
-	utils.EncodePNGToPath(imgName, c.Image)
+	utils.EncodePNGToPath(imgName, cropImage(c.Image, c.output))
+	c.flushAOVs(curFrame)
 	// log.Info().Msgf("Encoded to path: %s", imgName)
 }
 
+// SetFrame sets the number of the next frame FlushToDisk writes
+func (c *Camera) SetFrame(frame int) {
+	c.flushMtx.Lock()
+	defer c.flushMtx.Unlock()
+	c.frame = frame
+}
+
 func (c *Camera) Reset() {
 	c.Image = image.NewRGBA(image.Rect(0, 0, c.SizeX, c.SizeY))
+	c.HDR = framebuffer.New(c.SizeX, c.SizeY)
+	c.AOVs = nil
 	// make the entire image black
 	// for x := 0; x < c.SizeX; x++ {
 	// 	for y := 0; y < c.SizeY; y++ {
@@ -102,32 +139,131 @@ func (c *Camera) Reset() {
 	// }
 }
 
+// Resize changes the dimensions of the camera, keeping its
+// vertical field of view, and clears its buffers
+func (c *Camera) Resize(sizeX, sizeY int) {
+	c.SizeX = sizeX
+	c.SizeY = sizeY
+	c.aspect = float64(c.SizeX) / float64(c.SizeY)
+	c.centerOffset = Point{c.SizeX / 2, c.SizeY / 2}
+	c.fov_hRad = math.Atan(math.Tan(c.fov_vRad/2.0)*c.aspect) * 2.0
+	c.Reset()
+}
+
+// Fov returns the vertical field of view of the camera in degrees
+func (c *Camera) Fov() float64 {
+	return c.fov
+}
+
+// SetFov sets the vertical field of view of the camera in degrees
+func (c *Camera) SetFov(fov float64) {
+	c.fov = fov
+	c.fov_vRad = utils.DegToRad(fov)
+	c.fov_hRad = math.Atan(math.Tan(c.fov_vRad/2.0)*c.aspect) * 2.0
+}
+
+// band returns a copy of the camera with an image covering only the
+// given part of a sizeX x sizeY frame, projecting it like the whole frame
+func (c *Camera) band(rect image.Rectangle, sizeX, sizeY int) *Camera {
+	band := *c
+	band.SizeX = rect.Dx()
+	band.SizeY = rect.Dy()
+	band.aspect = float64(sizeX) / float64(sizeY)
+	band.centerOffset = Point{sizeX / 2, sizeY / 2}
+	band.fov_hRad = math.Atan(math.Tan(c.fov_vRad/2.0)*band.aspect) * 2.0
+	band.offset = Point{rect.Min.X, rect.Min.Y}
+	band.full = Point{sizeX, sizeY}
+	band.output = image.Rectangle{}
+	band.Reset()
+	return &band
+}
+
 func (c *Camera) GetBytes() ([]byte, error) {
 	return utils.EncodeImageToBytes(c.Image, utils.IMG_PNG)
 }
 
-func (c *Camera) RayForPixel(px Point) Ray {
-	relPxPos := px.Sub(c.centerOffset)
+func (c *Camera) RayForPixel(px Point, rng *RNG) Ray {
+	return c.RayForSubPixel(float64(px.X), float64(px.Y), rng)
+}
+
+// RayForSubPixel returns the ray through the continuous image position (x, y),
+// where integer coordinates fall on the same rays as RayForPixel.
+// If a perspective camera has an aperture, the ray starts at a point on
+// the lens drawn from rng. Without an rng the pinhole ray is returned.
+func (c *Camera) RayForSubPixel(x, y float64, rng *RNG) Ray {
+	if rng != nil && c.hasAperture() {
+		return c.RayThroughLens(x, y, rng.Float64(), rng.Float64())
+	}
+	return c.pinholeRay(x, y)
+}
+
+// pinholeRay returns the ray through the image position (x, y)
+// for the projection of the camera, ignoring its lens
+func (c *Camera) pinholeRay(x, y float64) Ray {
+	switch c.projection.Mode {
+	case ProjectOrthographic:
+		return c.orthographicRay(x, y)
+	case ProjectFisheye:
+		return c.fisheyeRay(x, y)
+	case ProjectEquirectangular:
+		return c.equirectangularRay(x, y)
+	case ProjectCubemap:
+		return c.cubemapRay(x, y)
+	}
+	return c.perspectiveRay(x, y)
+}
+
+func (c *Camera) perspectiveRay(x, y float64) Ray {
+	relX := x + float64(c.offset.X) - float64(c.centerOffset.X) + c.shift
+	relY := y + float64(c.offset.Y) - float64(c.centerOffset.Y)
 	fovHalfRad := c.fov_hRad / 2
 	adjX := float64(c.centerOffset.X) / math.Tan(fovHalfRad)
-	vecX := vec3.Vec3{X: float64(relPxPos.X), Y: adjX, Z: 0}
+	vecX := vec3.Vec3{X: relX, Y: adjX, Z: 0}
 	vecX = vecX.ToUnit()
 
 	fovYHalfRad := c.fov_vRad / 2
 	adjY := float64(c.centerOffset.Y) / math.Tan(fovYHalfRad)
-	vecY := vec3.Vec3{X: float64(relPxPos.Y), Y: adjY, Z: 0}
+	vecY := vec3.Vec3{X: relY, Y: adjY, Z: 0}
 	vecY = vecY.ToUnit()
 
-	right := c.up.Cross(c.Dir).Mult(vecX.X)
-	up := c.up.Mult(vecY.X)
+	forward, right, up := c.Basis()
 	r2 := Ray{
-		c.Pos,
-		c.Dir.Add(up).Add(right),
+		origin: c.Pos,
+		dir:    forward.Add(up.Mult(vecY.X)).Add(right.Mult(vecX.X)),
 	}
 
 	return r2
 }
 
+// Project returns the continuous image position whose pinhole ray passes
+// through the world point p. It returns false for points behind the
+// camera or outside of its field of view, and for projections other
+// than perspective.
+func (c *Camera) Project(p vec3.Vec3) (x, y float64, ok bool) {
+	if c.projection.Mode != ProjectPerspective {
+		return 0, 0, false
+	}
+	// p - Pos = a*forward + b*up + r*right, the ray direction
+	// being forward + up*sin(angleY) + right*sin(angleX)
+	v := p.Sub(c.Pos)
+	forward, right, up := c.Basis()
+	a := vec3.Dot(v, forward)
+	b := vec3.Dot(v, up)
+	r := vec3.Dot(v, right)
+	if a <= 0 {
+		return 0, 0, false
+	}
+	sinX, sinY := r/a, b/a
+	if math.Abs(sinX) >= 1 || math.Abs(sinY) >= 1 {
+		return 0, 0, false
+	}
+	adjX := float64(c.centerOffset.X) / math.Tan(c.fov_hRad/2)
+	adjY := float64(c.centerOffset.Y) / math.Tan(c.fov_vRad/2)
+	x = float64(c.centerOffset.X-c.offset.X) - c.shift + adjX*sinX/math.Sqrt(1-sinX*sinX)
+	y = float64(c.centerOffset.Y-c.offset.Y) + adjY*sinY/math.Sqrt(1-sinY*sinY)
+	return x, y, true
+}
+
 func (c *Camera) Size() int64 {
 	return int64(c.SizeX) * int64(c.SizeY)
 }
@@ -169,10 +305,12 @@ func (c *Camera) MoveBackward(amt float64) {
 	c.Pos = c.Pos.Sub(c.Dir.Mult(amt))
 }
 
+// RotateLeft turns the camera around its up vector by amt radians
 func (c *Camera) RotateLeft(amt float64) {
-	c.Dir = c.Dir.Mult(1 - amt).Add(c.up.Cross(c.Dir).Mult(amt))
+	c.Turn(utils.RadToDeg(amt), 0)
 }
 
+// RotateRight turns the camera around its up vector by amt radians
 func (c *Camera) RotateRight(amt float64) {
-	c.Dir = c.Dir.Mult(1 - amt).Sub(c.up.Cross(c.Dir).Mult(amt))
+	c.Turn(-utils.RadToDeg(amt), 0)
 }
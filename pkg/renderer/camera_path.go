@@ -0,0 +1,360 @@
+package renderer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+// Easing shapes how a camera path moves from one keyframe to the next
+type Easing int
+
+const (
+	// EaseLinear moves at the pace of the spline
+	EaseLinear Easing = iota
+	// EaseIn starts slowly and speeds up
+	EaseIn
+	// EaseOut starts quickly and slows down
+	EaseOut
+	// EaseInOut starts and ends slowly
+	EaseInOut
+)
+
+var easingNames = map[Easing]string{
+	EaseLinear: "linear",
+	EaseIn:     "in",
+	EaseOut:    "out",
+	EaseInOut:  "in-out",
+}
+
+func (e Easing) String() string {
+	if name, ok := easingNames[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("Easing(%d)", int(e))
+}
+
+// ParseEasing converts an easing name (linear, in, out, in-out) into an Easing
+func ParseEasing(name string) (Easing, error) {
+	for e, eName := range easingNames {
+		if strings.EqualFold(name, eName) {
+			return e, nil
+		}
+	}
+	return EaseLinear, fmt.Errorf("unknown easing: %q", name)
+}
+
+func (e Easing) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+func (e *Easing) UnmarshalText(text []byte) error {
+	ease, err := ParseEasing(string(text))
+	*e = ease
+	return err
+}
+
+// apply maps the fraction u of the time between two keyframes
+// to the fraction of the way along the spline between them
+func (e Easing) apply(u float64) float64 {
+	switch e {
+	case EaseIn:
+		return u * u
+	case EaseOut:
+		return 1 - (1-u)*(1-u)
+	case EaseInOut:
+		return u * u * (3 - 2*u)
+	}
+	return u
+}
+
+// PathInterpolation is the spline a camera path follows through its keyframes
+type PathInterpolation int
+
+const (
+	// PathCatmullRom passes through every keyframe with tangents
+	// pointing from the previous keyframe to the next. Directions
+	// without targets turn at an even rate between keyframes.
+	PathCatmullRom PathInterpolation = iota
+	// PathBezier uses the In and Out control points of the keyframes,
+	// placing missing ones like PathCatmullRom
+	PathBezier
+	// PathLinear moves in straight lines between keyframes
+	PathLinear
+)
+
+var pathInterpolationNames = map[PathInterpolation]string{
+	PathCatmullRom: "catmull-rom",
+	PathBezier:     "bezier",
+	PathLinear:     "linear",
+}
+
+func (pi PathInterpolation) String() string {
+	if name, ok := pathInterpolationNames[pi]; ok {
+		return name
+	}
+	return fmt.Sprintf("PathInterpolation(%d)", int(pi))
+}
+
+// ParsePathInterpolation converts an interpolation name (catmull-rom,
+// bezier, linear) into a PathInterpolation
+func ParsePathInterpolation(name string) (PathInterpolation, error) {
+	for pi, piName := range pathInterpolationNames {
+		if strings.EqualFold(name, piName) {
+			return pi, nil
+		}
+	}
+	return PathCatmullRom, fmt.Errorf("unknown path interpolation: %q", name)
+}
+
+func (pi PathInterpolation) MarshalText() ([]byte, error) {
+	return []byte(pi.String()), nil
+}
+
+func (pi *PathInterpolation) UnmarshalText(text []byte) error {
+	interp, err := ParsePathInterpolation(string(text))
+	*pi = interp
+	return err
+}
+
+// Keyframe is where a camera path has the camera at a given time
+type Keyframe struct {
+	// Time is when the camera reaches the keyframe, in seconds
+	Time float64   `json:"time"`
+	Pos  vec3.Vec3 `json:"pos"`
+	// Target is the point the camera looks at. Without
+	// a target the camera looks along Dir.
+	Target *vec3.Vec3 `json:"target,omitempty"`
+	Dir    *vec3.Vec3 `json:"dir,omitempty"`
+	// Fov is the vertical field of view in degrees,
+	// or 0 to keep the field of view of the camera
+	Fov float64 `json:"fov,omitempty"`
+	// Roll is the angle in degrees the camera is rolled around its view direction
+	Roll float64 `json:"roll,omitempty"`
+	// In and Out are the Bézier control points of the position
+	// before and after the keyframe
+	In  *vec3.Vec3 `json:"in,omitempty"`
+	Out *vec3.Vec3 `json:"out,omitempty"`
+	// Ease shapes the move from this keyframe to the next
+	Ease Easing `json:"ease,omitempty"`
+}
+
+// look returns the direction the camera looks in at the keyframe
+func (k Keyframe) look() vec3.Vec3 {
+	if k.Target != nil {
+		return vec3.DirFromPos(*k.Target, k.Pos)
+	}
+	return k.Dir.ToUnit()
+}
+
+// maxPathTurn is the most a path without targets may turn the camera
+// from one keyframe to the next, in degrees. Turning around any further
+// could go either way.
+const maxPathTurn = 179
+
+// CameraPath moves a camera through keyframes along a spline
+type CameraPath struct {
+	Interpolation PathInterpolation `json:"interpolation"`
+	Keyframes     []Keyframe        `json:"keyframes"`
+}
+
+// PathSample is the state of the camera at a point along a path
+type PathSample struct {
+	Pos vec3.Vec3
+	Dir vec3.Vec3
+	// Fov is 0 if the path keeps the field of view of the camera
+	Fov  float64
+	Roll float64
+}
+
+// Pose returns the pose of the camera at the sample
+func (s PathSample) Pose() CameraPose {
+	return CameraPose{s.Pos, s.Dir, s.Roll, s.Fov}
+}
+
+// Apply moves the camera to the sample
+func (s PathSample) Apply(c *Camera) {
+	c.SetPose(s.Pose())
+}
+
+// LoadCameraPath reads a camera path from a JSON file such as
+//
+//	{
+//	  "interpolation": "catmull-rom",
+//	  "keyframes": [
+//	    {"time": 0, "pos": {"x": -15, "y": 0, "z": 0}, "target": {"x": 0, "y": 0, "z": 0}, "fov": 20},
+//	    {"time": 4, "pos": {"x": 0, "y": -8, "z": 2}, "target": {"x": 0, "y": 0, "z": 0}, "fov": 30, "ease": "in-out"}
+//	  ]
+//	}
+func LoadCameraPath(path string) (*CameraPath, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cp := new(CameraPath)
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("can't read camera path %s: %w", path, err)
+	}
+	if err := cp.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid camera path %s: %w", path, err)
+	}
+	return cp, nil
+}
+
+// Validate reports every problem with the keyframes of the path
+func (p *CameraPath) Validate() error {
+	if len(p.Keyframes) == 0 {
+		return errors.New("a camera path needs at least one keyframe")
+	}
+	var errs []error
+	withFov := 0
+	for i, k := range p.Keyframes {
+		if i > 0 && k.Time <= p.Keyframes[i-1].Time {
+			errs = append(errs, fmt.Errorf("keyframe %d at %0.3fs doesn't come after the one before it", i, k.Time))
+		}
+		switch {
+		case k.Target != nil:
+			if k.Target.Sub(k.Pos).Norm() == 0 {
+				errs = append(errs, fmt.Errorf("keyframe %d looks at its own position", i))
+			}
+		case k.Dir != nil:
+			if k.Dir.Norm() == 0 {
+				errs = append(errs, fmt.Errorf("keyframe %d has a zero direction", i))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("keyframe %d needs a target or a direction", i))
+		}
+		if k.Fov < 0 || k.Fov >= 180 {
+			errs = append(errs, fmt.Errorf("keyframe %d field of view must be between 0 and 180 degrees, got %0.2f", i, k.Fov))
+		}
+		if k.Fov > 0 {
+			withFov++
+		}
+	}
+	if withFov != 0 && withFov != len(p.Keyframes) {
+		errs = append(errs, errors.New("either every keyframe or none of them must have a field of view"))
+	}
+	if len(errs) == 0 && !p.allTargets() {
+		for i := 1; i < len(p.Keyframes); i++ {
+			if turn := vec3.Angle(p.Keyframes[i-1].look(), p.Keyframes[i].look()); turn > maxPathTurn {
+				errs = append(errs, fmt.Errorf("keyframe %d turns the camera %0.1f degrees, which way is ambiguous, so add a keyframe in between", i, turn))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// HasFov reports whether the path sets the field of view of the camera
+func (p *CameraPath) HasFov() bool {
+	return p.Keyframes[0].Fov > 0
+}
+
+// Duration returns the time of the last keyframe
+func (p *CameraPath) Duration() float64 {
+	return p.Keyframes[len(p.Keyframes)-1].Time
+}
+
+// At returns the camera along the path at time t in seconds. Before the
+// first keyframe and after the last one the camera stays where they are.
+func (p *CameraPath) At(t float64) PathSample {
+	keys := p.Keyframes
+	i := 0
+	for i < len(keys)-1 && keys[i+1].Time <= t {
+		i++
+	}
+	if i == len(keys)-1 || t <= keys[0].Time {
+		k := keys[i]
+		return PathSample{Pos: k.Pos, Dir: k.look(), Fov: k.Fov, Roll: k.Roll}
+	}
+
+	u := keys[i].Ease.apply((t - keys[i].Time) / (keys[i+1].Time - keys[i].Time))
+	pos := p.curve(i, u, true, func(j int) vec3.Vec3 { return keys[j].Pos })
+	var dir vec3.Vec3
+	if p.allTargets() {
+		target := p.curve(i, u, false, func(j int) vec3.Vec3 { return *keys[j].Target })
+		dir = vec3.DirFromPos(target, pos)
+	} else {
+		dir = slerp(keys[i].look(), keys[i+1].look(), u)
+	}
+	// the field of view and roll follow the same spline as the
+	// position, with the roll turning the short way between keyframes
+	rolls := p.rolls()
+	lens := p.curve(i, u, false, func(j int) vec3.Vec3 { return vec3.New(keys[j].Fov, rolls[j], 0) })
+	return PathSample{Pos: pos, Dir: dir, Fov: lens.X, Roll: math.Remainder(lens.Y, 360)}
+}
+
+// rolls returns the roll of every keyframe, adding whole turns so
+// that no two keyframes are more than half a turn apart
+func (p *CameraPath) rolls() []float64 {
+	rolls := make([]float64, len(p.Keyframes))
+	for i, k := range p.Keyframes {
+		rolls[i] = k.Roll
+		if i > 0 {
+			rolls[i] = rolls[i-1] + math.Remainder(k.Roll-rolls[i-1], 360)
+		}
+	}
+	return rolls
+}
+
+// slerp turns the unit vector a towards b at an even rate,
+// reaching b at u = 1
+func slerp(a, b vec3.Vec3, u float64) vec3.Vec3 {
+	cos := vec3.Clamp(vec3.Dot(a, b), -1, 1)
+	angle := math.Acos(cos)
+	if angle < 1e-9 {
+		return a
+	}
+	sin := math.Sin(angle)
+	return a.Mult(math.Sin((1-u)*angle) / sin).Add(b.Mult(math.Sin(u*angle) / sin))
+}
+
+func (p *CameraPath) allTargets() bool {
+	for _, k := range p.Keyframes {
+		if k.Target == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// curve evaluates the spline through the values of the keyframes at the
+// fraction u of the way from keyframe i to the next. Handles selects
+// whether the In and Out control points of Bézier paths apply.
+func (p *CameraPath) curve(i int, u float64, handles bool, value func(int) vec3.Vec3) vec3.Vec3 {
+	keys := p.Keyframes
+	p1, p2 := value(i), value(i+1)
+	if p.Interpolation == PathLinear {
+		return p1.Mult(1 - u).Add(p2.Mult(u))
+	}
+
+	// Catmull-Rom tangents are rates of change per second, so the path
+	// keeps its speed through keyframes that are unevenly spaced in time.
+	// At the ends of the path they point straight at the next keyframe.
+	dt := keys[i+1].Time - keys[i].Time
+	m1 := p2.Sub(p1).Div(dt)
+	if i > 0 {
+		m1 = p2.Sub(value(i - 1)).Div(keys[i+1].Time - keys[i-1].Time)
+	}
+	m2 := p2.Sub(p1).Div(dt)
+	if i+2 < len(keys) {
+		m2 = value(i + 2).Sub(p1).Div(keys[i+2].Time - keys[i].Time)
+	}
+	b1 := p1.Add(m1.Mult(dt / 3))
+	b2 := p2.Sub(m2.Mult(dt / 3))
+	if handles && p.Interpolation == PathBezier {
+		if keys[i].Out != nil {
+			b1 = *keys[i].Out
+		}
+		if keys[i+1].In != nil {
+			b2 = *keys[i+1].In
+		}
+	}
+
+	v := 1 - u
+	return p1.Mult(v * v * v).Add(b1.Mult(3 * v * v * u)).Add(b2.Mult(3 * v * u * u)).Add(p2.Mult(u * u * u))
+}
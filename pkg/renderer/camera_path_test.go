@@ -0,0 +1,192 @@
+package renderer
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+func testPath(interp PathInterpolation) *CameraPath {
+	origin := vec3.Zero
+	return &CameraPath{
+		Interpolation: interp,
+		Keyframes: []Keyframe{
+			{Time: 0, Pos: vec3.New(-10, 0, 0), Target: &origin, Fov: 20},
+			{Time: 1, Pos: vec3.New(0, -10, 2), Target: &origin, Fov: 40, Roll: 10, Ease: EaseInOut},
+			{Time: 3, Pos: vec3.New(10, 0, 0), Target: &origin, Fov: 30},
+		},
+	}
+}
+
+func TestCameraPathPassesKeyframes(t *testing.T) {
+	for interp := range pathInterpolationNames {
+		path := testPath(interp)
+		if err := path.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		for _, k := range path.Keyframes {
+			s := path.At(k.Time)
+			if s.Pos.Sub(k.Pos).Norm() > 1e-9 || math.Abs(s.Fov-k.Fov) > 1e-9 || math.Abs(s.Roll-k.Roll) > 1e-9 {
+				t.Errorf("%s: expected keyframe %+v at %0.1fs. Got %+v", interp, k, k.Time, s)
+			}
+			checkDir(t, interp.String(), s.Dir, k.look())
+		}
+		// the camera stays at the ends outside of the path
+		if s := path.At(-1); s.Pos != path.Keyframes[0].Pos {
+			t.Errorf("%s: expected the first keyframe before the path. Got %v", interp, s.Pos)
+		}
+		if s := path.At(5); s.Pos != path.Keyframes[2].Pos {
+			t.Errorf("%s: expected the last keyframe after the path. Got %v", interp, s.Pos)
+		}
+	}
+}
+
+func TestCameraPathLooksAtTargets(t *testing.T) {
+	path := testPath(PathCatmullRom)
+	for _, at := range []float64{0.3, 1.7, 2.5} {
+		s := path.At(at)
+		checkDir(t, "target", s.Dir, vec3.DirFromPos(vec3.Zero, s.Pos))
+	}
+}
+
+func TestCameraPathInterpolation(t *testing.T) {
+	path := testPath(PathLinear)
+	if s := path.At(2); s.Pos.Sub(vec3.New(5, -5, 1)).Norm() > 1e-9 {
+		t.Errorf("Expected halfway along the line. Got %v", s.Pos)
+	}
+
+	// Catmull-Rom curves through the middle keyframe instead of cornering
+	path = testPath(PathCatmullRom)
+	if s := path.At(2); s.Pos.Sub(vec3.New(5, -5, 1)).Norm() < 0.5 {
+		t.Errorf("Expected the spline to bend away from the line. Got %v", s.Pos)
+	}
+
+	// a Bézier handle pulls the curve towards it
+	path = testPath(PathBezier)
+	out := vec3.New(0, -10, 20)
+	path.Keyframes[1].Out = &out
+	if s := path.At(2); s.Pos.Z < 5 {
+		t.Errorf("Expected the handle to lift the curve. Got %v", s.Pos)
+	}
+}
+
+func TestCameraPathKeepsSpeedThroughKeyframes(t *testing.T) {
+	// the second segment lasts three times as long as the first
+	path := &CameraPath{Keyframes: []Keyframe{
+		{Time: 0, Pos: vec3.New(0, 0, 0), Dir: &vec3.UnitX},
+		{Time: 1, Pos: vec3.New(1, 1, 0), Dir: &vec3.UnitX},
+		{Time: 4, Pos: vec3.New(2, 0, 0), Dir: &vec3.UnitX},
+	}}
+	const h = 1e-6
+	before := path.At(1).Pos.Sub(path.At(1 - h).Pos).Div(h)
+	after := path.At(1 + h).Pos.Sub(path.At(1).Pos).Div(h)
+	if before.Sub(after).Norm() > 1e-3 {
+		t.Errorf("Expected the same velocity on both sides of the keyframe. Got %v and %v", before, after)
+	}
+}
+
+func TestCameraPathTurnsEvenly(t *testing.T) {
+	back := vec3.New(-1, 0.2, 0)
+	path := &CameraPath{Keyframes: []Keyframe{
+		{Time: 0, Pos: vec3.Zero, Dir: &vec3.UnitX},
+		{Time: 1, Pos: vec3.Zero, Dir: &back},
+	}}
+	if err := path.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	total := vec3.Angle(vec3.UnitX, back)
+	for _, u := range []float64{0.25, 0.5, 0.75} {
+		dir := path.At(u).Dir
+		if math.Abs(dir.Norm()-1) > 1e-9 || math.Abs(vec3.Angle(vec3.UnitX, dir)-u*total) > 1e-6 {
+			t.Errorf("Expected to have turned %0.2f degrees at %0.2fs. Got %v", u*total, u, dir)
+		}
+	}
+
+	back = vec3.New(-1, 0, 0)
+	if err := path.Validate(); err == nil {
+		t.Error("Expected an error for turning the camera around completely")
+	}
+}
+
+func TestCameraPathRollsTheShortWay(t *testing.T) {
+	path := &CameraPath{Interpolation: PathLinear, Keyframes: []Keyframe{
+		{Time: 0, Pos: vec3.Zero, Dir: &vec3.UnitX, Roll: 170},
+		{Time: 1, Pos: vec3.Zero, Dir: &vec3.UnitX, Roll: -170},
+	}}
+	if roll := path.At(0.5).Roll; math.Abs(math.Abs(roll)-180) > 1e-9 {
+		t.Errorf("Expected to roll through 180 degrees. Got %f", roll)
+	}
+	if roll := path.At(0.25).Roll; math.Abs(roll-175) > 1e-9 {
+		t.Errorf("Expected a roll of 175 degrees. Got %f", roll)
+	}
+}
+
+func TestEasing(t *testing.T) {
+	for e := range easingNames {
+		if e.apply(0) != 0 || e.apply(1) != 1 {
+			t.Errorf("%s: expected easing to keep the ends. Got %f, %f", e, e.apply(0), e.apply(1))
+		}
+	}
+	if EaseIn.apply(0.5) >= 0.5 || EaseOut.apply(0.5) <= 0.5 || EaseInOut.apply(0.25) >= 0.25 {
+		t.Error("Expected easing in to lag and easing out to lead")
+	}
+}
+
+func TestLoadCameraPath(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "path.json")
+	data := `{
+		"interpolation": "bezier",
+		"keyframes": [
+			{"time": 0, "pos": {"x": -15, "y": 0, "z": 0}, "dir": {"x": 1, "y": 0, "z": 0}},
+			{"time": 2, "pos": {"x": -5, "y": 0, "z": 0}, "dir": {"x": 0, "y": 1, "z": 0}, "roll": 30, "ease": "in"}
+		]
+	}`
+	if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	path, err := LoadCameraPath(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path.Interpolation != PathBezier || path.Keyframes[1].Ease != EaseIn || path.Duration() != 2 {
+		t.Errorf("Expected the path from the file. Got %+v", path)
+	}
+	s := path.At(1)
+	checkDir(t, "blend", s.Dir, vec3.New(1, 1, 0).ToUnit())
+	if s.Fov != 0 {
+		t.Errorf("Expected the path to keep the field of view. Got %f", s.Fov)
+	}
+
+	if err := os.WriteFile(file, []byte(`{"interpolation": "spline", "keyframes": []}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCameraPath(file); err == nil {
+		t.Error("Expected an error for an unknown interpolation")
+	}
+}
+
+func TestCameraPathValidate(t *testing.T) {
+	path := testPath(PathCatmullRom)
+	path.Keyframes[2].Time = 1
+	path.Keyframes[1].Fov = 0
+	path.Keyframes[0].Target = nil
+	if err := path.Validate(); err == nil {
+		t.Error("Expected an error for out of order keyframes, a missing field of view and no target")
+	}
+	if err := (&CameraPath{}).Validate(); err == nil {
+		t.Error("Expected an error for a path without keyframes")
+	}
+}
+
+func TestPathSampleApply(t *testing.T) {
+	cam := NewCameraFOV(vec3.New(-5, 0, 0), 64, 48, 30, "./rend_test")
+	s := testPath(PathCatmullRom).At(0.5)
+	s.Apply(cam)
+	if cam.Pos != s.Pos || cam.Fov() != s.Fov || cam.Roll() != s.Roll {
+		t.Errorf("Expected the camera at %+v. Got %v, %f, %f", s, cam.Pos, cam.Fov(), cam.Roll())
+	}
+	checkDir(t, "apply", cam.Dir, s.Dir)
+}
@@ -0,0 +1,332 @@
+package renderer
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+// ErrNoCheckpoint is returned when resuming from a
+// directory that doesn't hold a checkpoint
+var ErrNoCheckpoint = errors.New("no checkpoint to resume from")
+
+const (
+	checkpointVersion = 1
+	checkpointState   = "state.json"
+	checkpointFrame   = "frame.gob"
+)
+
+// checkpointInfo is what a checkpoint remembers about a run
+type checkpointInfo struct {
+	Version int `json:"version"`
+	// Fingerprint is a hash of the scene and every option that changes
+	// the image, which has to match for the run to be resumed
+	Fingerprint string `json:"fingerprint"`
+	// Options is a readable form of the options of the run
+	Options string `json:"options"`
+	// Frames is the number of frames finished
+	Frames int `json:"frames"`
+	// Tiles are the finished tiles of the frame in progress
+	Tiles []image.Rectangle `json:"tiles"`
+}
+
+// savedSample is the part of a pixel sample adaptive
+// anti-aliasing needs to find the edges of a resumed frame
+type savedSample struct {
+	Color vec3.Vec3
+	Depth float64
+	// Object is the index of the hit drawable among the drawables
+	// and lights of the scene, one less than its object ID, or -1 for a miss
+	Object int
+}
+
+// checkpointData holds the finished tiles of the frame in progress
+type checkpointData struct {
+	HDR     *framebuffer.Buffer
+	AOVs    map[AOV]*framebuffer.Buffer
+	Samples []savedSample
+}
+
+// Checkpoint periodically saves the finished frames and tiles of a run
+// to a directory so an interrupted run can pick up where it stopped.
+// Only the tile pass is checkpointed; progressive levels aren't.
+type Checkpoint struct {
+	dir      string
+	interval time.Duration
+	mtx      sync.Mutex
+	info     checkpointInfo
+	data     *checkpointData
+	// restored are the tiles loaded from disk for the frame in progress
+	restored []image.Rectangle
+	lastSave time.Time
+	// saveErr is the first error saving the checkpoint
+	// after a tile, which Render reports
+	saveErr error
+}
+
+// OpenCheckpoint starts checkpointing the run of r with the given options
+// into dir, saving at most once every interval. With resume set the run
+// continues from the checkpoint already in dir, which has to have been
+// made with the same scene and options. Otherwise any old checkpoint is
+// replaced.
+func OpenCheckpoint(dir string, interval time.Duration, r *Renderer, opts RenderOpts, resume bool) (*Checkpoint, error) {
+	cp := &Checkpoint{
+		dir:      dir,
+		interval: interval,
+		info: checkpointInfo{
+			Version:     checkpointVersion,
+			Fingerprint: fingerprint(r, opts),
+			Options:     opts.String(),
+		},
+		lastSave: time.Now(),
+	}
+	if !resume {
+		os.Remove(filepath.Join(dir, checkpointFrame))
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, err
+		}
+		return cp, cp.writeInfo()
+	}
+
+	raw, err := os.ReadFile(filepath.Join(dir, checkpointState))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w in %s", ErrNoCheckpoint, dir)
+	} else if err != nil {
+		return nil, err
+	}
+	var saved checkpointInfo
+	if err := json.Unmarshal(raw, &saved); err != nil {
+		return nil, fmt.Errorf("reading checkpoint: %w", err)
+	}
+	if saved.Version != checkpointVersion {
+		return nil, fmt.Errorf("checkpoint version %d can't be resumed, expected %d", saved.Version, checkpointVersion)
+	}
+	if saved.Fingerprint != cp.info.Fingerprint {
+		return nil, fmt.Errorf("the scene or options changed since the checkpoint was made with %s", saved.Options)
+	}
+	cp.info.Frames = saved.Frames
+	if len(saved.Tiles) == 0 {
+		return cp, nil
+	}
+
+	f, err := os.Open(filepath.Join(dir, checkpointFrame))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data := &checkpointData{}
+	if err := gob.NewDecoder(f).Decode(data); err != nil {
+		return nil, fmt.Errorf("reading checkpoint frame: %w", err)
+	}
+	if data.HDR == nil || data.HDR.Width != opts.DimX || data.HDR.Height != opts.DimY {
+		return nil, errors.New("checkpoint frame doesn't match the image size")
+	}
+	cp.data = data
+	cp.info.Tiles = saved.Tiles
+	cp.restored = slices.Clone(saved.Tiles)
+	return cp, nil
+}
+
+// fingerprint hashes the scene and the options that change the image.
+// The worker count and output directory can change between runs.
+func fingerprint(r *Renderer, opts RenderOpts) string {
+	opts.Workers = 0
+	opts.OutPath = ""
+	opts.Stats = StatsOpts{}
+	h := sha256.New()
+	fmt.Fprintln(h, opts.String())
+	fmt.Fprintf(h, "%+v %v %v %+v %+v %+v\n", r.camera.Pose(), r.camera.up, r.camera.roll, r.camera.lens, r.camera.projection, r.camera.shutter)
+	// drawables are compared by their distance at a few points around
+	// them, since their IDs change with the order scenes are built in
+	for _, d := range slices.Concat(r.scene.Drawables, r.scene.Lights) {
+		fmt.Fprintf(h, "%T %v %v %t", d, d.Pos(), d.Color(), d.IsLight())
+		for _, probe := range fingerprintProbes {
+			fmt.Fprintf(h, " %v", d.Dist(d.Pos().Add(probe)))
+		}
+		fmt.Fprintln(h)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fingerprintProbes are the offsets from a drawable's position
+// its distance is sampled at for the fingerprint
+var fingerprintProbes = []vec3.Vec3{
+	vec3.New(0.5, 0, 0),
+	vec3.New(0, 1.5, 0),
+	vec3.New(0, 0, -3),
+	vec3.New(1, 1, 1),
+	vec3.New(-2, 0.5, 4),
+	vec3.New(10, -10, 10),
+}
+
+// SetCheckpoint makes every following render save its progress to cp.
+// A nil checkpoint turns checkpointing off.
+func (r *Renderer) SetCheckpoint(cp *Checkpoint) {
+	r.checkpoint = cp
+}
+
+// Frames returns the number of frames the run has finished
+func (cp *Checkpoint) Frames() int {
+	cp.mtx.Lock()
+	defer cp.mtx.Unlock()
+	return cp.info.Frames
+}
+
+// isRestored reports whether a tile of the frame in progress was loaded
+func (cp *Checkpoint) isRestored(tile image.Rectangle) bool {
+	return slices.Contains(cp.restored, tile)
+}
+
+// restore writes the tiles loaded from disk into a frame
+// that has just begun and returns how many pixels they cover
+func (cp *Checkpoint) restore(r *Renderer) int64 {
+	cp.mtx.Lock()
+	defer cp.mtx.Unlock()
+	if cp.data == nil {
+		cp.data = &checkpointData{HDR: framebuffer.New(r.camera.SizeX, r.camera.SizeY)}
+	}
+	if r.aaSamples != nil && cp.data.Samples == nil {
+		cp.data.Samples = make([]savedSample, len(r.aaSamples))
+	}
+	if cp.data.AOVs == nil {
+		cp.data.AOVs = make(map[AOV]*framebuffer.Buffer, len(r.aovBufs))
+	}
+	for pass := range r.aovBufs {
+		if _, ok := cp.data.AOVs[pass]; !ok {
+			cp.data.AOVs[pass] = framebuffer.New(r.camera.SizeX, r.camera.SizeY)
+		}
+	}
+
+	pixels := int64(0)
+	for _, tile := range cp.restored {
+		pixels += int64(tile.Dx() * tile.Dy())
+		for y := tile.Min.Y; y < tile.Max.Y; y++ {
+			for x := tile.Min.X; x < tile.Max.X; x++ {
+				idx := cp.data.HDR.Index(x, y)
+				r.writePreview(Point{x, y}, cp.data.HDR.Pix[idx])
+				for pass, buf := range r.aovBufs {
+					buf.Pix[idx] = cp.data.AOVs[pass].Pix[idx]
+				}
+				if r.aaSamples != nil {
+					s := cp.data.Samples[idx]
+					r.aaSamples[idx] = pixelSample{color: s.Color, depth: s.Depth, objID: int64(s.Object) + 1}
+				}
+			}
+		}
+	}
+	return pixels
+}
+
+// tileDone keeps a copy of a finished tile and saves
+// the checkpoint if it hasn't been saved for a while
+func (cp *Checkpoint) tileDone(r *Renderer, tile image.Rectangle) {
+	cp.mtx.Lock()
+	defer cp.mtx.Unlock()
+	for y := tile.Min.Y; y < tile.Max.Y; y++ {
+		for x := tile.Min.X; x < tile.Max.X; x++ {
+			idx := cp.data.HDR.Index(x, y)
+			cp.data.HDR.Pix[idx] = r.camera.HDR.Pix[idx]
+			for pass, buf := range r.aovBufs {
+				cp.data.AOVs[pass].Pix[idx] = buf.Pix[idx]
+			}
+			if r.aaSamples != nil {
+				s := r.aaSamples[idx]
+				cp.data.Samples[idx] = savedSample{Color: s.color, Depth: s.depth, Object: int(s.objID) - 1}
+			}
+		}
+	}
+	cp.info.Tiles = append(cp.info.Tiles, tile)
+	if time.Since(cp.lastSave) >= cp.interval {
+		if err := cp.saveLocked(); err != nil && cp.saveErr == nil {
+			cp.saveErr = err
+		}
+	}
+}
+
+// finishFrame forgets the tiles of a frame once it is rendered. The
+// frame only counts as finished once FrameDone is called, so a frame
+// that is rendered but not written out yet is resumed from its tiles.
+func (cp *Checkpoint) finishFrame() {
+	cp.mtx.Lock()
+	defer cp.mtx.Unlock()
+	cp.restored = nil
+	cp.data = nil
+}
+
+// takeErr returns the error saving the checkpoint after
+// a tile, if there was one, and forgets it
+func (cp *Checkpoint) takeErr() error {
+	cp.mtx.Lock()
+	defer cp.mtx.Unlock()
+	err := cp.saveErr
+	cp.saveErr = nil
+	return err
+}
+
+// FrameDone records that a frame has been rendered and written out
+func (cp *Checkpoint) FrameDone() error {
+	cp.mtx.Lock()
+	defer cp.mtx.Unlock()
+	cp.info.Frames++
+	cp.info.Tiles = nil
+	cp.lastSave = time.Now()
+	return cp.writeInfo()
+}
+
+// Save writes the progress of the frame in progress to disk
+func (cp *Checkpoint) Save() error {
+	cp.mtx.Lock()
+	defer cp.mtx.Unlock()
+	return cp.saveLocked()
+}
+
+func (cp *Checkpoint) saveLocked() error {
+	cp.lastSave = time.Now()
+	if cp.data != nil && len(cp.info.Tiles) > 0 {
+		err := writeFileAtomic(filepath.Join(cp.dir, checkpointFrame), func(f *os.File) error {
+			return gob.NewEncoder(f).Encode(cp.data)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return cp.writeInfo()
+}
+
+func (cp *Checkpoint) writeInfo() error {
+	return writeFileAtomic(filepath.Join(cp.dir, checkpointState), func(f *os.File) error {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(cp.info)
+	})
+}
+
+// writeFileAtomic writes a file next to path and renames it into place,
+// so an interrupted write never leaves a broken checkpoint behind
+func writeFileAtomic(path string, write func(f *os.File) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
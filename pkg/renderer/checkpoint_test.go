@@ -0,0 +1,120 @@
+package renderer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func checkpointOpts() RenderOpts {
+	opts := testOpts()
+	opts.Tiles.Size = 8
+	opts.AA.Mode = AAAdaptive
+	opts.AA.Samples = 2
+	opts.AOVs = []AOV{AOVDepth}
+	return opts
+}
+
+func TestCheckpointResume(t *testing.T) {
+	opts := checkpointOpts()
+	full := newTestRenderer(opts)
+	if _, err := full.Render(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	first := newTestRenderer(opts)
+	cp, err := OpenCheckpoint(dir, time.Hour, first, opts, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.SetCheckpoint(cp)
+	ctx, cancel := context.WithCancel(context.Background())
+	tiles := 0
+	first.SetObserver(ObserverFunc(func(e Event) {
+		if e.Kind == EventTileDone {
+			if tiles++; tiles == 4 {
+				cancel()
+			}
+		}
+	}))
+	if _, err := first.Render(ctx, opts); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the render to be cancelled. Got %v", err)
+	}
+
+	second := newTestRenderer(opts)
+	cp, err = OpenCheckpoint(dir, time.Hour, second, opts, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cp.restored) < 4 {
+		t.Fatalf("Expected at least 4 tiles to be restored. Got %d", len(cp.restored))
+	}
+	second.SetCheckpoint(cp)
+	if _, err := second.Render(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(second.camera.HDR.Pix, full.camera.HDR.Pix) {
+		t.Error("Expected the resumed render to match an uninterrupted one")
+	}
+	if !slices.Equal(second.camera.AOVs[AOVDepth].Pix, full.camera.AOVs[AOVDepth].Pix) {
+		t.Error("Expected the resumed depth pass to match an uninterrupted one")
+	}
+
+	if err := cp.FrameDone(); err != nil {
+		t.Fatal(err)
+	}
+	cp, err = OpenCheckpoint(dir, time.Hour, newTestRenderer(opts), opts, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp.Frames() != 1 {
+		t.Errorf("Expected 1 finished frame. Got %d", cp.Frames())
+	}
+}
+
+func TestCheckpointRejectsChangedOptions(t *testing.T) {
+	opts := checkpointOpts()
+	dir := t.TempDir()
+	if _, err := OpenCheckpoint(dir, time.Hour, newTestRenderer(opts), opts, false); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := opts
+	changed.Seed = 9
+	if _, err := OpenCheckpoint(dir, time.Hour, newTestRenderer(changed), changed, true); err == nil {
+		t.Error("Expected a changed seed to be rejected")
+	}
+	moreWorkers := opts
+	moreWorkers.Workers = 7
+	if _, err := OpenCheckpoint(dir, time.Hour, newTestRenderer(moreWorkers), moreWorkers, true); err != nil {
+		t.Errorf("Expected the worker count not to matter. Got %v", err)
+	}
+	if _, err := OpenCheckpoint(t.TempDir(), time.Hour, newTestRenderer(opts), opts, true); !errors.Is(err, ErrNoCheckpoint) {
+		t.Errorf("Expected ErrNoCheckpoint. Got %v", err)
+	}
+}
+
+func TestCheckpointReportsFailedSave(t *testing.T) {
+	opts := checkpointOpts()
+	dir := t.TempDir()
+	r := newTestRenderer(opts)
+	cp, err := OpenCheckpoint(dir, 0, r, opts, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetCheckpoint(cp)
+	// saving after every tile fails once the directory is gone
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Render(context.Background(), opts); err == nil {
+		t.Error("Expected the render to report the failed checkpoint save. Got nil")
+	}
+	if err := cp.takeErr(); err != nil {
+		t.Errorf("Expected the error to be reported only once. Got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package renderer
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// CropWindow is a region of the frame, either in pixels or as fractions
+// of the frame's width and height. The zero window is the whole frame.
+type CropWindow struct {
+	X0, Y0, X1, Y1 float64
+	Normalized     bool
+}
+
+// ParseCropWindow reads a window given as "x0,y0,x1,y1". The corners are
+// pixels, or fractions of the frame size if any of them has a decimal
+// point, so "0.25,0.25,0.75,0.75" is the middle quarter of the frame.
+func ParseCropWindow(s string) (CropWindow, error) {
+	if s == "" {
+		return CropWindow{}, nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return CropWindow{}, fmt.Errorf("crop window needs 4 values x0,y0,x1,y1, got %q", s)
+	}
+	var coords [4]float64
+	normalized := false
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		val, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return CropWindow{}, fmt.Errorf("invalid crop window %q: %w", s, err)
+		}
+		coords[i] = val
+		normalized = normalized || strings.Contains(part, ".")
+	}
+	return CropWindow{coords[0], coords[1], coords[2], coords[3], normalized}, nil
+}
+
+// IsZero reports whether the window is unset, meaning the whole frame
+func (w CropWindow) IsZero() bool {
+	return w == CropWindow{}
+}
+
+// Rect returns the pixels of a dimX x dimY frame the window covers.
+// Normalized windows are rounded outwards to whole pixels.
+func (w CropWindow) Rect(dimX, dimY int) image.Rectangle {
+	if w.IsZero() {
+		return image.Rect(0, 0, dimX, dimY)
+	}
+	if !w.Normalized {
+		return image.Rect(int(w.X0), int(w.Y0), int(w.X1), int(w.Y1))
+	}
+	fx, fy := float64(dimX), float64(dimY)
+	return image.Rect(
+		int(math.Floor(w.X0*fx)), int(math.Floor(w.Y0*fy)),
+		int(math.Ceil(w.X1*fx)), int(math.Ceil(w.Y1*fy)),
+	)
+}
+
+func (w CropWindow) String() string {
+	if w.IsZero() {
+		return "full"
+	}
+	if w.Normalized {
+		return fmt.Sprintf("%0.3f,%0.3f,%0.3f,%0.3f", w.X0, w.Y0, w.X1, w.Y1)
+	}
+	return fmt.Sprintf("%d,%d,%d,%d", int(w.X0), int(w.Y0), int(w.X1), int(w.Y1))
+}
+
+type CropOpts struct {
+	// Window is the region of the frame to render. The camera keeps
+	// projecting the whole frame, so the region looks exactly like
+	// the same pixels of a full render.
+	Window CropWindow
+	// Canvas outputs the whole frame with only the window updated.
+	// Otherwise only the window is output.
+	Canvas bool
+}
+
+func DefaultCropOpts() CropOpts {
+	return CropOpts{
+		Window: CropWindow{},
+		Canvas: false,
+	}
+}
+
+func (co CropOpts) String() string {
+	return fmt.Sprintf("crop: {window: %s, canvas: %t}", co.Window, co.Canvas)
+}
+
+// window returns the pixels of the frame being rendered
+func (r *Renderer) window() image.Rectangle {
+	return r.opts.Crop.Window.Rect(r.camera.SizeX, r.camera.SizeY)
+}
+
+// windowTiles clips tiles to the window, dropping those outside it
+func (r *Renderer) windowTiles(tiles []image.Rectangle) []image.Rectangle {
+	window := r.window()
+	clipped := tiles[:0]
+	for _, tile := range tiles {
+		if tile = tile.Intersect(window); !tile.Empty() {
+			clipped = append(clipped, tile)
+		}
+	}
+	return clipped
+}
+
+// cropImage returns the part of img inside window
+func cropImage(img image.Image, window image.Rectangle) image.Image {
+	if window.Empty() || window == img.Bounds() {
+		return img
+	}
+	if sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(window)
+	}
+	return img
+}
@@ -0,0 +1,71 @@
+package renderer
+
+import (
+	"context"
+	"image"
+	"testing"
+)
+
+func TestParseCropWindow(t *testing.T) {
+	w, err := ParseCropWindow("0.25,0.5,0.75,1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := w.Rect(32, 24), image.Rect(8, 12, 24, 24); got != want {
+		t.Errorf("Expected the normalized window to cover %v. Got %v", want, got)
+	}
+	w, err = ParseCropWindow("4,2,10,20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := w.Rect(32, 24), image.Rect(4, 2, 10, 20); got != want {
+		t.Errorf("Expected the pixel window to cover %v. Got %v", want, got)
+	}
+	if _, err := ParseCropWindow("1,2,3"); err == nil {
+		t.Error("Expected a window with 3 values to be rejected")
+	}
+}
+
+func TestCropMatchesFullRender(t *testing.T) {
+	opts := testOpts()
+	full := newTestRenderer(opts)
+	if _, err := full.Render(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	window := image.Rect(5, 3, 21, 17)
+	for _, canvas := range []bool{false, true} {
+		opts.Crop = CropOpts{Window: CropWindow{5, 3, 21, 17, false}, Canvas: canvas}
+		r := newTestRenderer(opts)
+		img, err := r.Render(context.Background(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantBounds := window
+		if canvas {
+			wantBounds = image.Rect(0, 0, opts.DimX, opts.DimY)
+		}
+		if img.Bounds() != wantBounds {
+			t.Errorf("canvas %t: expected bounds %v. Got %v", canvas, wantBounds, img.Bounds())
+		}
+		for y := 0; y < opts.DimY; y++ {
+			for x := 0; x < opts.DimX; x++ {
+				got := r.camera.HDR.At(x, y)
+				if image.Pt(x, y).In(window) && got != full.camera.HDR.At(x, y) {
+					t.Fatalf("Expected pixel (%d, %d) to match the full render", x, y)
+				}
+				if !image.Pt(x, y).In(window) && got.Norm() != 0 {
+					t.Fatalf("Expected pixel (%d, %d) outside the window to be left empty", x, y)
+				}
+			}
+		}
+	}
+}
+
+func TestCropWindowOutsideFrame(t *testing.T) {
+	opts := testOpts()
+	opts.Crop.Window = CropWindow{20, 10, 40, 20, false}
+	if err := opts.Validate(); err == nil {
+		t.Error("Expected a window outside the frame to be rejected")
+	}
+}
@@ -0,0 +1,46 @@
+package renderer
+
+import (
+	"fmt"
+
+	"github.com/Solidsilver/go-ray-march/pkg/denoise"
+)
+
+// denoiseGuides are the AOV passes the denoiser needs to find edges
+var denoiseGuides = []AOV{AOVNormal, AOVDepth, AOVAlbedo}
+
+type DenoiseOpts struct {
+	// Enabled runs the denoiser on the HDR buffer once the frame
+	// is finished, before exposure, post effects and tone mapping
+	Enabled bool
+	Filter  denoise.Options
+}
+
+func DefaultDenoiseOpts() DenoiseOpts {
+	return DenoiseOpts{
+		Enabled: false,
+		Filter:  denoise.DefaultOptions(),
+	}
+}
+
+func (do DenoiseOpts) String() string {
+	return fmt.Sprintf("denoise: {enabled: %t, filter: %s}", do.Enabled, do.Filter)
+}
+
+// Denoise filters the HDR buffer of the camera in place,
+// using the normal, depth and albedo of the last frame as guides
+func (r *Renderer) Denoise() {
+	guides := denoise.Guides{
+		Normal: r.aovBufs[AOVNormal],
+		Depth:  r.aovBufs[AOVDepth],
+		Albedo: r.aovBufs[AOVAlbedo],
+	}
+	filtered := denoise.ATrous(r.camera.HDR, guides, r.opts.Denoise.Filter)
+	// only the pixels just rendered are replaced, so the rest of
+	// the canvas isn't filtered again
+	hdr := r.camera.HDR
+	window := r.window()
+	for y := window.Min.Y; y < window.Max.Y; y++ {
+		copy(hdr.Pix[hdr.Index(window.Min.X, y):hdr.Index(window.Max.X, y)], filtered.Pix[hdr.Index(window.Min.X, y):])
+	}
+}
@@ -0,0 +1,121 @@
+package renderer
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Solidsilver/go-ray-march/pkg/utils"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+// LensOpts describes the thin lens of a camera.
+// An Aperture of 0 gives a pinhole camera where everything is in focus.
+type LensOpts struct {
+	// Aperture is the radius of the lens in world units
+	Aperture float64
+	// FocusDist is the distance along the view direction
+	// of the plane that is in perfect focus
+	FocusDist float64
+	// Blades is the number of aperture blades. Values below 3
+	// give a round aperture, otherwise bokeh is polygonal.
+	Blades int
+	// BladeRotation rotates the aperture polygon, in degrees
+	BladeRotation float64
+	// AutoFocus sets FocusDist by marching the center pixel before rendering
+	AutoFocus bool
+	// Samples is the number of points on the lens a pixel that isn't
+	// supersampled traces rays from, so out of focus areas blur
+	// instead of turning to grain
+	Samples int
+}
+
+func DefaultLensOpts() LensOpts {
+	return LensOpts{
+		Aperture:  0,
+		FocusDist: 15,
+		Blades:    0,
+		Samples:   16,
+	}
+}
+
+func (lo LensOpts) String() string {
+	return fmt.Sprintf("lens: {aperture: %f, focusDist: %f, blades: %d, bladeRotation: %0.2f, autoFocus: %t, samples: %d}", lo.Aperture, lo.FocusDist, lo.Blades, lo.BladeRotation, lo.AutoFocus, lo.Samples)
+}
+
+// Lens returns the thin lens settings of the camera
+func (c *Camera) Lens() LensOpts {
+	return c.lens
+}
+
+// SetLens sets the thin lens settings of the camera
+func (c *Camera) SetLens(lens LensOpts) {
+	c.lens = lens
+}
+
+// SetFocusDist sets the distance of the plane in focus
+func (c *Camera) SetFocusDist(dist float64) {
+	c.lens.FocusDist = dist
+}
+
+// hasAperture reports whether rays of the camera start at points on its lens
+func (c *Camera) hasAperture() bool {
+	return c.lens.Aperture > 0 && c.projection.Mode == ProjectPerspective
+}
+
+// RayThroughLens returns the ray through the continuous image position (x, y)
+// that leaves the lens at the point given by the lens sample (u, v) in [0, 1).
+// All rays for the same image position converge on the focal plane.
+func (c *Camera) RayThroughLens(x, y, u, v float64) Ray {
+	pinhole := c.pinholeRay(x, y)
+	if c.lens.Aperture <= 0 || c.lens.FocusDist <= 0 {
+		return pinhole
+	}
+
+	forward, right, up := c.Basis()
+	focusT := c.lens.FocusDist / vec3.Dot(pinhole.dir, forward)
+	focusPt := pinhole.origin.Add(pinhole.dir.Mult(focusT))
+
+	lensX, lensY := c.sampleAperture(u, v)
+	origin := c.Pos.Add(right.Mult(lensX * c.lens.Aperture)).Add(up.Mult(lensY * c.lens.Aperture))
+
+	return Ray{origin: origin, dir: vec3.DirFromPos(focusPt, origin)}
+}
+
+// sampleAperture maps (u, v) in [0, 1) to a point on the unit aperture,
+// which is a disk or a regular polygon depending on the blade count
+func (c *Camera) sampleAperture(u, v float64) (float64, float64) {
+	blades := c.lens.Blades
+	if blades < 3 {
+		r := math.Sqrt(u)
+		theta := 2 * math.Pi * v
+		return r * math.Cos(theta), r * math.Sin(theta)
+	}
+
+	// Pick one of the triangles fanning out from the center,
+	// then sample it uniformly
+	sector := math.Min(math.Floor(u*float64(blades)), float64(blades-1))
+	u = u*float64(blades) - sector
+	rotation := utils.DegToRad(c.lens.BladeRotation)
+	theta0 := rotation + 2*math.Pi*sector/float64(blades)
+	theta1 := rotation + 2*math.Pi*(sector+1)/float64(blades)
+
+	s := math.Sqrt(u)
+	x := s * ((1-v)*math.Cos(theta0) + v*math.Cos(theta1))
+	y := s * ((1-v)*math.Sin(theta0) + v*math.Sin(theta1))
+	return x, y
+}
+
+// AutoFocus marches the center pixel of the camera and sets the focus
+// distance to the distance of whatever it hits. It returns the new
+// focus distance, and false if the ray hit nothing.
+func (r *Renderer) AutoFocus() (float64, bool) {
+	cam := r.camera
+	ray := cam.pinholeRay(float64(cam.centerOffset.X), float64(cam.centerOffset.Y))
+	marchRslt := RayMarch(ray, r, false)
+	if marchRslt.HitObject == nil {
+		return cam.lens.FocusDist, false
+	}
+	focusDist := vec3.Dot(marchRslt.HitPos.Sub(cam.Pos), cam.Dir.ToUnit())
+	cam.SetFocusDist(focusDist)
+	return focusDist, true
+}
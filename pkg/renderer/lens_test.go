@@ -0,0 +1,83 @@
+package renderer
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/Solidsilver/go-ray-march/pkg/utils"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+func TestLensFocusesOnFocalPlane(t *testing.T) {
+	cam := NewCameraFOV(vec3.New(-5, 0, 0), 64, 48, 30, "./rend_test")
+	cam.SetLens(LensOpts{Aperture: 0.5, FocusDist: 7, Blades: 5, Samples: 1})
+	pinhole := cam.pinholeRay(10, 40)
+	want := pinhole.origin.Add(pinhole.dir.Mult(7 / vec3.Dot(pinhole.dir, vec3.UnitX)))
+	for _, uv := range [][2]float64{{0, 0}, {0.3, 0.9}, {0.99, 0.5}, {0.5, 0.1}} {
+		ray := cam.RayThroughLens(10, 40, uv[0], uv[1])
+		// follow the ray to the focal plane
+		focusT := (7 - vec3.Dot(ray.origin.Sub(cam.Pos), vec3.UnitX)) / vec3.Dot(ray.dir, vec3.UnitX)
+		got := ray.origin.Add(ray.dir.Mult(focusT))
+		if got.Sub(want).Norm() > 1e-9 {
+			t.Errorf("Expected the lens sample %v to meet the pinhole ray at %v. Got %v", uv, want, got)
+		}
+	}
+}
+
+func TestApertureSamplesInsidePolygon(t *testing.T) {
+	cam := NewCameraFOV(vec3.New(-5, 0, 0), 64, 48, 30, "./rend_test")
+	for _, blades := range []int{3, 5, 6} {
+		cam.SetLens(LensOpts{Aperture: 1, Blades: blades, BladeRotation: 17})
+		rng := NewRNG(uint64(blades))
+		// the edges are halfway between the vertices, cos(pi/n) from the center
+		inradius := math.Cos(math.Pi / float64(blades))
+		for range 1000 {
+			x, y := cam.sampleAperture(rng.Float64(), rng.Float64())
+			for k := range blades {
+				theta := utils.DegToRad(17) + 2*math.Pi*(float64(k)+0.5)/float64(blades)
+				if d := x*math.Cos(theta) + y*math.Sin(theta); d > inradius+1e-9 {
+					t.Fatalf("%d blades: expected (%f, %f) inside the polygon. Got %f past edge %d", blades, x, y, d-inradius, k)
+				}
+			}
+		}
+	}
+}
+
+func TestAutoFocus(t *testing.T) {
+	r := newTestRenderer(testOpts())
+	dist, ok := r.AutoFocus()
+	// the unit sphere at the origin is 4 units in front of the camera
+	if !ok || math.Abs(dist-4) > 0.01 {
+		t.Errorf("Expected to focus at 4. Got %f, %t", dist, ok)
+	}
+	if r.camera.Lens().FocusDist != dist {
+		t.Errorf("Expected the camera to focus at %f. Got %f", dist, r.camera.Lens().FocusDist)
+	}
+
+	r.camera.SetPose(CameraPose{Pos: vec3.New(-5, 0, 0), Dir: vec3.UnitY})
+	if _, ok := r.AutoFocus(); ok {
+		t.Error("Expected nothing to focus on looking past the sphere")
+	}
+}
+
+func TestDepthOfFieldAveragesLens(t *testing.T) {
+	noise := func(samples int) float64 {
+		renders := []*Renderer{}
+		for seed := range uint64(2) {
+			opts := testOpts()
+			opts.Seed = seed
+			r := newTestRenderer(opts)
+			r.camera.SetLens(LensOpts{Aperture: 0.5, FocusDist: 15, Samples: samples})
+			if _, err := r.Render(context.Background(), opts); err != nil {
+				t.Fatal(err)
+			}
+			renders = append(renders, r)
+		}
+		return meanDiff(renders[0].camera.Image, renders[1].camera.Image)
+	}
+	single, averaged := noise(1), noise(64)
+	if single == 0 || averaged > single/2 {
+		t.Errorf("Expected averaging lens samples to cut the noise between seeds. Got %f with 1 sample and %f with 64", single, averaged)
+	}
+}
@@ -0,0 +1,212 @@
+package renderer
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/Solidsilver/go-ray-march/pkg/drawables"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+// Shutter is the interval of frame time, where 0 is the start
+// of the frame and 1 the start of the next, that the shutter is open for
+type Shutter struct {
+	Open  float64
+	Close float64
+}
+
+// ShutterFromAngle returns the shutter interval of a rotary
+// shutter with the given angle in degrees (180 is half a frame)
+func ShutterFromAngle(angle float64) Shutter {
+	return Shutter{0, angle / 360}
+}
+
+// Duration returns the fraction of the frame the shutter is open for
+func (s Shutter) Duration() float64 {
+	return s.Close - s.Open
+}
+
+// At maps u in [0, 1] to a frame time inside the shutter interval
+func (s Shutter) At(u float64) float64 {
+	return s.Open + u*s.Duration()
+}
+
+func (s Shutter) String() string {
+	return fmt.Sprintf("shutter: {open: %0.3f, close: %0.3f}", s.Open, s.Close)
+}
+
+type MotionOpts struct {
+	Shutter Shutter
+	// TimeSamples is the number of distinct instants across the
+	// shutter interval that samples are distributed over. A pixel
+	// that isn't supersampled traces a ray at each of them.
+	TimeSamples int
+}
+
+func DefaultMotionOpts() MotionOpts {
+	return MotionOpts{
+		Shutter:     Shutter{0, 0},
+		TimeSamples: 8,
+	}
+}
+
+func (mo MotionOpts) String() string {
+	return fmt.Sprintf("motion: {%s, timeSamples: %d}", mo.Shutter, mo.TimeSamples)
+}
+
+// CameraPose is where a camera is and how it is aimed
+type CameraPose struct {
+	Pos vec3.Vec3
+	Dir vec3.Vec3
+	// Roll is the angle in degrees the image is rotated around Dir
+	Roll float64
+	// Fov is the vertical field of view in degrees,
+	// or 0 to keep the field of view of the camera
+	Fov float64
+}
+
+// Pose returns the current pose of the camera
+func (c *Camera) Pose() CameraPose {
+	return CameraPose{c.Pos, c.Dir, c.roll, c.fov}
+}
+
+// SetPose moves the camera to pose
+func (c *Camera) SetPose(pose CameraPose) {
+	c.Pos = pose.Pos
+	c.Dir = pose.Dir
+	c.roll = pose.Roll
+	if pose.Fov > 0 {
+		c.SetFov(pose.Fov)
+	}
+}
+
+// SetShutter sets the interval of the frame the shutter is open for
+func (c *Camera) SetShutter(shutter Shutter) {
+	c.shutter = shutter
+}
+
+// SetMotion sets the pose the camera will be in at the end of the
+// frame (frame time 1). The pose at frame time 0 is the current one.
+func (c *Camera) SetMotion(end CameraPose) {
+	c.motionEnd = &end
+}
+
+// Motion returns the pose set with SetMotion, if any
+func (c *Camera) Motion() (CameraPose, bool) {
+	if c.motionEnd == nil {
+		return CameraPose{}, false
+	}
+	return *c.motionEnd, true
+}
+
+// ClearMotion removes any camera motion set with SetMotion
+func (c *Camera) ClearMotion() {
+	c.motionEnd = nil
+}
+
+// PoseAt returns the pose of the camera at frame time t, interpolating
+// between the current pose and the motion end pose. The direction turns
+// at a constant rate, like it does along a camera path.
+func (c *Camera) PoseAt(t float64) CameraPose {
+	start := c.Pose()
+	if c.motionEnd == nil {
+		return start
+	}
+	end := *c.motionEnd
+	if end.Fov <= 0 {
+		end.Fov = start.Fov
+	}
+	dirLen := start.Dir.Norm()*(1-t) + end.Dir.Norm()*t
+	return CameraPose{
+		Pos:  start.Pos.Mult(1 - t).Add(end.Pos.Mult(t)),
+		Dir:  slerp(start.Dir.ToUnit(), end.Dir.ToUnit(), t).Mult(dirLen),
+		Roll: start.Roll*(1-t) + end.Roll*t,
+		Fov:  start.Fov*(1-t) + end.Fov*t,
+	}
+}
+
+// atTime returns a copy of the camera posed at frame time t.
+// The copy shares the image of the original camera.
+func (c *Camera) atTime(t float64) Camera {
+	snapshot := *c
+	snapshot.SetPose(c.PoseAt(t))
+	snapshot.motionEnd = nil
+	return snapshot
+}
+
+// SceneAnimator updates a copy of the scene to its state at frame time t.
+// The Drawables and Lights slices may be modified in place.
+type SceneAnimator func(t float64, scene *Scene)
+
+// SetAnimator sets the function used to evaluate
+// time-dependent scene parameters for motion blur
+func (s *Scene) SetAnimator(anim SceneAnimator) {
+	s.animator = anim
+}
+
+func (s *Scene) atTime(t float64) *Scene {
+	snapshot := *s
+	snapshot.Drawables = append([]drawables.Drawable{}, s.Drawables...)
+	snapshot.Lights = append([]drawables.Drawable{}, s.Lights...)
+	snapshot.animator = nil
+	s.animator(t, &snapshot)
+	// animators that move drawables in place keep their IDs,
+	// so the snapshot can share the index of the scene
+	if !sameObjects(s, &snapshot) {
+		snapshot.indexObjects()
+	}
+	return &snapshot
+}
+
+// sameObjects reports whether two scenes hold drawables
+// and lights with the same IDs in the same order
+func sameObjects(a, b *Scene) bool {
+	same := func(x, y []drawables.Drawable) bool {
+		return slices.EqualFunc(x, y, func(d1, d2 drawables.Drawable) bool { return d1.ID() == d2.ID() })
+	}
+	return same(a.Drawables, b.Drawables) && same(a.Lights, b.Lights)
+}
+
+func (r *Renderer) motionEnabled() bool {
+	cam := r.camera
+	return cam.shutter.Duration() > 0 && (cam.motionEnd != nil || r.scene.animator != nil)
+}
+
+// beginMotion builds a view of the scene and camera for each instant
+// the shutter interval is sampled at. The views share the options and
+// stats of the renderer and, unless the scene is animated, its scene,
+// so only their cameras are copied.
+func (r *Renderer) beginMotion() {
+	r.timeSlices = nil
+	if !r.motionEnabled() {
+		return
+	}
+	count := max(r.opts.Motion.TimeSamples, 1)
+	views := make([]Renderer, count)
+	cameras := make([]Camera, count)
+	r.timeSlices = make([]*Renderer, count)
+	for i := range count {
+		t := r.camera.shutter.At((float64(i) + 0.5) / float64(count))
+		view := &views[i]
+		cameras[i] = r.camera.atTime(t)
+		view.camera = &cameras[i]
+		view.scene = r.scene
+		if r.scene.animator != nil {
+			view.scene = r.scene.atTime(t)
+		}
+		view.opts = r.opts
+		view.stats = r.stats
+		r.timeSlices[i] = view
+	}
+}
+
+// sliceFor returns the view of the renderer to use for sample i of n.
+// Samples are stratified across the time slices of the shutter.
+func (r *Renderer) sliceFor(i, n int, rng *RNG) *Renderer {
+	if r.timeSlices == nil {
+		return r
+	}
+	u := (float64(i) + rng.Float64()) / float64(n)
+	idx := min(int(u*float64(len(r.timeSlices))), len(r.timeSlices)-1)
+	return r.timeSlices[idx]
+}
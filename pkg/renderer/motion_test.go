@@ -0,0 +1,181 @@
+package renderer
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/Solidsilver/go-ray-march/pkg/drawables"
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+	"github.com/Solidsilver/go-ray-march/pkg/utils"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+func TestShutterFromAngle(t *testing.T) {
+	shutter := ShutterFromAngle(180)
+	if shutter != (Shutter{0, 0.5}) {
+		t.Errorf("Expected half a frame. Got %v", shutter)
+	}
+	if at := shutter.At(0.5); at != 0.25 {
+		t.Errorf("Expected the middle of the shutter at 0.25. Got %f", at)
+	}
+}
+
+func TestCameraPoseAt(t *testing.T) {
+	cam := NewCameraFOV(vec3.New(-5, 0, 0), 32, 24, 20, "./rend_test")
+	if pose := cam.PoseAt(0.5); pose != cam.Pose() {
+		t.Errorf("Expected a still camera to keep its pose. Got %+v", pose)
+	}
+	cam.SetMotion(CameraPose{Pos: vec3.New(-5, 2, 0), Dir: vec3.UnitY})
+	pose := cam.PoseAt(0.5)
+	if pose.Pos != vec3.New(-5, 1, 0) {
+		t.Errorf("Expected the camera halfway along its motion. Got %v", pose.Pos)
+	}
+	checkDir(t, "halfway", pose.Dir, vec3.New(1, 1, 0).ToUnit())
+	if pose.Roll != 0 || pose.Fov != 20 {
+		t.Errorf("Expected a motion without roll or field of view to keep the camera's. Got %f and %f", pose.Roll, pose.Fov)
+	}
+
+	// the direction turns at a constant rate, like along a path
+	cam.SetMotion(CameraPose{Pos: vec3.New(-5, 2, 0), Dir: vec3.UnitY, Roll: 30, Fov: 40})
+	pose = cam.PoseAt(0.25)
+	angle := utils.DegToRad(22.5)
+	checkDir(t, "a quarter of the way", pose.Dir, vec3.New(math.Cos(angle), math.Sin(angle), 0))
+	if math.Abs(pose.Roll-7.5) > 1e-9 || math.Abs(pose.Fov-25) > 1e-9 {
+		t.Errorf("Expected a roll of 7.5 and a field of view of 25. Got %f and %f", pose.Roll, pose.Fov)
+	}
+	if snapshot := cam.atTime(0.25); snapshot.Roll() != pose.Roll || snapshot.Fov() != pose.Fov {
+		t.Errorf("Expected the camera at a quarter of the frame to be rolled %f with a field of view of %f. Got %f and %f", pose.Roll, pose.Fov, snapshot.Roll(), snapshot.Fov())
+	}
+}
+
+func TestBeginMotion(t *testing.T) {
+	opts := testOpts()
+	opts.Motion.TimeSamples = 4
+	r := newTestRenderer(opts)
+	r.beginMotion()
+	if r.timeSlices != nil {
+		t.Fatal("Expected no time slices without a shutter interval")
+	}
+	r.camera.SetShutter(ShutterFromAngle(360))
+	r.camera.SetMotion(CameraPose{Pos: vec3.New(-5, 4, 0), Dir: vec3.UnitX})
+	r.beginMotion()
+	if len(r.timeSlices) != 4 {
+		t.Fatalf("Expected 4 time slices. Got %d", len(r.timeSlices))
+	}
+	for i, slice := range r.timeSlices {
+		want := vec3.New(-5, float64(i)+0.5, 0)
+		if slice.camera.Pos.Sub(want).Norm() > 1e-9 {
+			t.Errorf("Expected slice %d at %v. Got %v", i, want, slice.camera.Pos)
+		}
+		if slice.scene != r.scene {
+			t.Errorf("Expected slice %d to share the scene without an animator", i)
+		}
+	}
+}
+
+func TestBeginMotionAnimatesScene(t *testing.T) {
+	opts := testOpts()
+	opts.Motion.TimeSamples = 2
+	r := newTestRenderer(opts)
+	r.camera.SetShutter(ShutterFromAngle(360))
+	r.scene.SetAnimator(func(t float64, scene *Scene) {
+		sphere := scene.Drawables[0].(drawables.Sphere)
+		sphere.Center = vec3.New(0, t, 0)
+		scene.Drawables[0] = sphere
+		if t > 0.5 {
+			// a new light gets a new ID
+			scene.Lights[0] = drawables.NewLight(vec3.New(-5, 5, 5), 0.001, color.RGBA{255, 255, 255, 255}, false)
+		}
+	})
+	r.beginMotion()
+	if len(r.timeSlices) != 2 {
+		t.Fatalf("Expected 2 time slices. Got %d", len(r.timeSlices))
+	}
+	for i, slice := range r.timeSlices {
+		scene := slice.scene
+		if scene == r.scene {
+			t.Fatalf("Expected slice %d to have its own scene", i)
+		}
+		if want := 0.25 + 0.5*float64(i); scene.Drawables[0].(drawables.Sphere).Center.Y != want {
+			t.Errorf("Expected the sphere of slice %d at y = %f. Got %v", i, want, scene.Drawables[0].(drawables.Sphere).Center)
+		}
+		if id := scene.ObjectID(scene.Drawables[0]); id != 1 {
+			t.Errorf("Expected the sphere of slice %d to be object 1. Got %d", i, id)
+		}
+		if id := scene.ObjectID(scene.Lights[0]); id != 2 {
+			t.Errorf("Expected the light of slice %d to be object 2. Got %d", i, id)
+		}
+	}
+	index := reflect.ValueOf(r.scene.objectIDs).Pointer()
+	if reflect.ValueOf(r.timeSlices[0].scene.objectIDs).Pointer() != index || reflect.ValueOf(r.timeSlices[1].scene.objectIDs).Pointer() == index {
+		t.Error("Expected only the slice that replaced the light to be indexed again")
+	}
+}
+
+func TestMotionBlurAveragesPoses(t *testing.T) {
+	opts := testOpts()
+	opts.Motion.TimeSamples = 4
+	r := newTestRenderer(opts)
+	end := CameraPose{Pos: vec3.New(-5, 1, 0), Dir: vec3.UnitX}
+	r.camera.SetShutter(ShutterFromAngle(360))
+	r.camera.SetMotion(end)
+	if _, err := r.Render(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	blurred := r.camera.HDR.Copy()
+
+	// the average of still renders at the instants the shutter is sampled at
+	moving := *r.camera
+	r.camera.ClearMotion()
+	sum := framebuffer.New(opts.DimX, opts.DimY)
+	for i := range 4 {
+		r.camera.SetPose(moving.PoseAt((float64(i) + 0.5) / 4))
+		if _, err := r.Render(context.Background(), opts); err != nil {
+			t.Fatal(err)
+		}
+		for y := range opts.DimY {
+			for x := range opts.DimX {
+				sum.Set(x, y, sum.At(x, y).Add(r.camera.HDR.At(x, y).Div(4)))
+			}
+		}
+	}
+	for y := range opts.DimY {
+		for x := range opts.DimX {
+			if d := blurred.At(x, y).Sub(sum.At(x, y)).Norm(); d > 1e-9 {
+				t.Fatalf("Expected the average of the poses at (%d, %d). Got %v, want %v", x, y, blurred.At(x, y), sum.At(x, y))
+			}
+		}
+	}
+}
+
+func TestZeroShutterMatchesStill(t *testing.T) {
+	opts := testOpts()
+	r := newTestRenderer(opts)
+	still, err := r.Render(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := copyRGBA(still)
+
+	r.camera.SetShutter(Shutter{0.5, 0.5})
+	r.camera.SetMotion(CameraPose{Pos: vec3.New(-5, 1, 0), Dir: vec3.UnitX})
+	got, err := r.Render(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !imagesEqual(copyRGBA(got), want) {
+		t.Errorf("Expected a zero-length shutter to match the still render. Mean difference %f", meanDiff(got, want))
+	}
+}
+
+// copyRGBA copies a rendered image, which the next render overwrites
+func copyRGBA(img image.Image) *image.RGBA {
+	out := image.NewRGBA(img.Bounds())
+	draw.Draw(out, out.Rect, img, img.Bounds().Min, draw.Src)
+	return out
+}
@@ -0,0 +1,161 @@
+package renderer
+
+import (
+	"fmt"
+	"image"
+	"sync"
+	"time"
+)
+
+// EventKind identifies what happened during a render
+type EventKind int
+
+const (
+	// EventStarted is sent once before any pixels are rendered
+	EventStarted EventKind = iota
+	// EventTileDone is sent every time a tile is finished
+	EventTileDone
+	// EventPassDone is sent when a pass over the frame is finished,
+	// such as a progressive level, the tile pass, anti-aliasing
+	// refinement or denoising
+	EventPassDone
+	// EventFinished is sent once the render is over, whether it
+	// completed, was cancelled or failed
+	EventFinished
+)
+
+var eventKindNames = map[EventKind]string{
+	EventStarted:  "started",
+	EventTileDone: "tile done",
+	EventPassDone: "pass done",
+	EventFinished: "finished",
+}
+
+func (k EventKind) String() string {
+	if name, ok := eventKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+// The passes a frame goes through, in order
+const (
+	PassTiles     = "tiles"
+	PassAntiAlias = "antialias"
+	PassDenoise   = "denoise"
+	PassResolve   = "resolve"
+)
+
+// Event describes the progress of a render
+type Event struct {
+	Kind EventKind
+	// Pass is the name of the finished pass for EventPassDone
+	Pass string
+	// Tile is the finished tile for EventTileDone
+	Tile image.Rectangle
+	// Done is the number of pixels rendered so far in the tile passes
+	// and Total the number of pixels in all of them. Progressive
+	// rendering goes over the frame once per level.
+	Done  int64
+	Total int64
+	// Elapsed is the time since the render started
+	Elapsed time.Duration
+	// Duration is how long the pass took for EventPassDone,
+	// or the whole render for EventFinished
+	Duration time.Duration
+	// Err is the error the render finished with, if any
+	Err error
+}
+
+// Progress returns the fraction of pixels rendered in the tile passes
+func (e Event) Progress() float64 {
+	if e.Total == 0 {
+		return 0
+	}
+	return float64(e.Done) / float64(e.Total)
+}
+
+// An Observer is told about the progress of every render. Events
+// are delivered one at a time, so observers don't need to lock,
+// but they are called from the render goroutines and should return
+// quickly.
+type Observer interface {
+	OnEvent(e Event)
+}
+
+// ObserverFunc lets an ordinary function be used as an Observer
+type ObserverFunc func(e Event)
+
+func (f ObserverFunc) OnEvent(e Event) {
+	f(e)
+}
+
+// SetObserver sets the observer told about every following render.
+// A nil observer turns reporting off.
+func (r *Renderer) SetObserver(o Observer) {
+	r.observer = o
+}
+
+// renderEvents tracks the timing of a single render and sends its events
+type renderEvents struct {
+	mtx       sync.Mutex
+	observer  Observer
+	start     time.Time
+	passStart time.Time
+	done      int64
+	total     int64
+}
+
+func (r *Renderer) startEvents(passes int) *renderEvents {
+	now := time.Now()
+	ev := &renderEvents{observer: r.observer, start: now, passStart: now, total: int64(area(r.window())) * int64(passes)}
+	ev.send(Event{Kind: EventStarted})
+	return ev
+}
+
+func area(rect image.Rectangle) int {
+	return rect.Dx() * rect.Dy()
+}
+
+func (ev *renderEvents) send(e Event) {
+	if ev.observer == nil {
+		return
+	}
+	ev.mtx.Lock()
+	defer ev.mtx.Unlock()
+	ev.sendLocked(e)
+}
+
+func (ev *renderEvents) sendLocked(e Event) {
+	e.Done = ev.done
+	e.Total = ev.total
+	e.Elapsed = time.Since(ev.start)
+	ev.observer.OnEvent(e)
+}
+
+func (ev *renderEvents) tileDone(tile image.Rectangle) {
+	if ev.observer == nil {
+		return
+	}
+	ev.mtx.Lock()
+	defer ev.mtx.Unlock()
+	ev.done += int64(tile.Dx() * tile.Dy())
+	ev.sendLocked(Event{Kind: EventTileDone, Tile: tile})
+}
+
+// skipped counts pixels that didn't need rendering as done
+func (ev *renderEvents) skipped(pixels int64) {
+	ev.mtx.Lock()
+	defer ev.mtx.Unlock()
+	ev.done += pixels
+}
+
+func (ev *renderEvents) passDone(pass string) {
+	now := time.Now()
+	ev.send(Event{Kind: EventPassDone, Pass: pass, Duration: now.Sub(ev.passStart)})
+	ev.passStart = now
+}
+
+func (ev *renderEvents) finished(err error) {
+	ev.send(Event{Kind: EventFinished, Duration: time.Since(ev.start), Err: err})
+}
@@ -6,15 +6,6 @@ import (
 	"math"
 )
 
-type VignetteOpts struct {
-	enabled  bool
-	strength float64
-}
-
-func (vo VignetteOpts) String() string {
-	return fmt.Sprintf("vignett: {enabled: %t, strength: %f}", vo.enabled, vo.strength)
-}
-
 type BGOpts struct {
 	color color.RGBA
 	show  bool
@@ -55,19 +46,21 @@ type TraceOpts struct {
 	maxSteps   int
 	maxDist    float64
 	fastMath   bool
+	// surfaceBias is how far, in multiples of the hit distance, rays
+	// leaving a surface start off it along the normal
+	surfaceBias float64
 }
 
 func (to TraceOpts) String() string {
-	return fmt.Sprintf("trace: {LOD: %t, minHitDist: %f, maxHitDist: %f, maxSteps: %d, maxDist: %f}", to.LOD, to.minHitDist, to.maxHitDist, to.maxSteps, to.maxDist)
+	return fmt.Sprintf("trace: {LOD: %t, minHitDist: %f, maxHitDist: %f, maxSteps: %d, maxDist: %f, surfaceBias: %f}", to.LOD, to.minHitDist, to.maxHitDist, to.maxSteps, to.maxDist, to.surfaceBias)
 }
 
 type LightingOpts struct {
-	shadows  bool
-	vignette VignetteOpts
-	bg       BGOpts
-	ao       AmbientOcclusionOpts
-	dropoff  DropoffOpts
-	trace    TraceOpts
+	shadows bool
+	bg      BGOpts
+	ao      AmbientOcclusionOpts
+	dropoff DropoffOpts
+	trace   TraceOpts
 }
 
 func (lopt LightingOpts) WithShadows(setShadows bool) LightingOpts {
@@ -75,15 +68,18 @@ func (lopt LightingOpts) WithShadows(setShadows bool) LightingOpts {
 	return lopt
 }
 
+// WithSurfaceBias sets how far, in multiples of the hit distance,
+// shadow rays start off the surface they leave from
+func (lopt LightingOpts) WithSurfaceBias(bias float64) LightingOpts {
+	lopt.trace.surfaceBias = bias
+	return lopt
+}
+
 func DefaultLightingOpts() LightingOpts {
 	maxTraceDist := 5000.0
 	minHitDist := 0.0005
 	lopts := LightingOpts{
 		shadows: true,
-		vignette: VignetteOpts{
-			enabled:  false,
-			strength: 0.05,
-		},
 		bg: BGOpts{
 			color: BG_COLOR,
 			show:  true,
@@ -101,12 +97,13 @@ func DefaultLightingOpts() LightingOpts {
 			distance: maxTraceDist / 25,
 		},
 		trace: TraceOpts{
-			LOD:        false,
-			minHitDist: minHitDist,
-			maxHitDist: 10.0,
-			maxSteps:   100000,
-			maxDist:    maxTraceDist,
-			fastMath:   false,
+			LOD:         false,
+			minHitDist:  minHitDist,
+			maxHitDist:  10.0,
+			maxSteps:    100000,
+			maxDist:     maxTraceDist,
+			fastMath:    false,
+			surfaceBias: 2,
 		},
 	}
 
@@ -114,9 +111,9 @@ func DefaultLightingOpts() LightingOpts {
 }
 
 func (lopts LightingOpts) String() string {
-	return fmt.Sprintf("LightingOpts{shadows: %t, vignette: %s, bg: %s, ao: %s, dropoff: %s, trace: %s}", lopts.shadows, lopts.vignette, lopts.bg, lopts.ao, lopts.dropoff, lopts.trace)
+	return fmt.Sprintf("LightingOpts{shadows: %t, bg: %s, ao: %s, dropoff: %s, trace: %s}", lopts.shadows, lopts.bg, lopts.ao, lopts.dropoff, lopts.trace)
 }
 
 func (lopts LightingOpts) JsonString() string {
-	return fmt.Sprintf("LightingOpts{shadows: %t, vignette: %s, bg: %s, ao: %s, dropoff: %s, trace: %s}", lopts.shadows, lopts.vignette, lopts.bg, lopts.ao, lopts.dropoff, lopts.trace)
+	return fmt.Sprintf("LightingOpts{shadows: %t, bg: %s, ao: %s, dropoff: %s, trace: %s}", lopts.shadows, lopts.bg, lopts.ao, lopts.dropoff, lopts.trace)
 }
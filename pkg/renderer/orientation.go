@@ -0,0 +1,134 @@
+package renderer
+
+import (
+	"math"
+
+	"github.com/Solidsilver/go-ray-march/pkg/utils"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+// maxPitch is how close, in degrees, Turn and Orbit may bring the
+// view to the up vector before they stop tilting it
+const maxPitch = 89.0
+
+// Basis returns the orthonormal frame of the camera. Forward is the view
+// direction, and image x runs along right and image y along up, which is
+// the up vector of the camera made perpendicular to the view direction
+// and rolled around it.
+func (c *Camera) Basis() (forward, right, up vec3.Vec3) {
+	forward = c.Dir.ToUnit()
+	right = c.up.Cross(forward)
+	if right.Norm() < 1e-9 {
+		// looking along the up vector, so any right will do
+		right = vec3.UnitX.Cross(forward)
+		if right.Norm() < 1e-9 {
+			right = vec3.UnitY.Cross(forward)
+		}
+	}
+	right = right.ToUnit()
+	up = forward.Cross(right)
+	if c.roll != 0 {
+		rad := utils.DegToRad(c.roll)
+		cos, sin := math.Cos(rad), math.Sin(rad)
+		right, up = right.Mult(cos).Add(up.Mult(sin)), up.Mult(cos).Sub(right.Mult(sin))
+	}
+	return forward, right, up
+}
+
+// Up returns the up vector of the camera, which yaw turns around
+// and the view is kept level with
+func (c *Camera) Up() vec3.Vec3 {
+	return c.up
+}
+
+// SetUp sets the up vector of the camera. A zero vector is ignored.
+func (c *Camera) SetUp(up vec3.Vec3) {
+	if up.Norm() == 0 {
+		return
+	}
+	c.up = up.ToUnit()
+}
+
+// Roll returns the angle in degrees the camera is rolled around its view direction
+func (c *Camera) Roll() float64 {
+	return c.roll
+}
+
+// SetRoll sets the angle in degrees the camera is rolled around its view direction
+func (c *Camera) SetRoll(roll float64) {
+	c.roll = roll
+}
+
+// horizon returns the axes yaw is measured in, perpendicular to the
+// up vector, with a yaw of 0 looking along the first
+func (c *Camera) horizon() (x, y vec3.Vec3) {
+	x = vec3.UnitX.Sub(c.up.Mult(vec3.Dot(vec3.UnitX, c.up)))
+	if x.Norm() < 1e-9 {
+		x = vec3.UnitY.Sub(c.up.Mult(vec3.Dot(vec3.UnitY, c.up)))
+	}
+	x = x.ToUnit()
+	return x, c.up.Cross(x)
+}
+
+// Orientation returns the yaw, pitch and roll of the camera in degrees.
+// Yaw is the angle of the view direction around the up vector, pitch how
+// far it is tilted towards the up vector and roll the angle around it.
+func (c *Camera) Orientation() (yaw, pitch, roll float64) {
+	forward := c.Dir.ToUnit()
+	x, y := c.horizon()
+	yaw = utils.RadToDeg(math.Atan2(vec3.Dot(forward, y), vec3.Dot(forward, x)))
+	pitch = utils.RadToDeg(math.Asin(max(-1, min(1, vec3.Dot(forward, c.up)))))
+	return yaw, pitch, c.roll
+}
+
+// SetOrientation points the camera by yaw, pitch and roll in degrees,
+// as returned by Orientation
+func (c *Camera) SetOrientation(yaw, pitch, roll float64) {
+	x, y := c.horizon()
+	yawRad, pitchRad := utils.DegToRad(yaw), utils.DegToRad(pitch)
+	level := x.Mult(math.Cos(yawRad)).Add(y.Mult(math.Sin(yawRad)))
+	c.Dir = level.Mult(math.Cos(pitchRad)).Add(c.up.Mult(math.Sin(pitchRad)))
+	c.roll = roll
+}
+
+// Turn turns the view by yaw degrees around the up vector, towards the
+// right of the image, and tilts it by pitch degrees towards the up vector.
+// The view stops tilting short of the up vector so it never flips over.
+func (c *Camera) Turn(yaw, pitch float64) {
+	c.Dir = vec3.Rotate(c.Dir.ToUnit(), c.up, yaw)
+	_, current, _ := c.Orientation()
+	target := max(-maxPitch, min(maxPitch, current+pitch))
+	_, right, _ := c.levelBasis()
+	c.Dir = vec3.Rotate(c.Dir, right, current-target)
+}
+
+// LookAt points the camera at target
+func (c *Camera) LookAt(target vec3.Vec3) {
+	if target.Sub(c.Pos).Norm() == 0 {
+		return
+	}
+	c.Dir = vec3.DirFromPos(target, c.Pos)
+}
+
+// Orbit moves the camera around pivot by yaw degrees around the up
+// vector and by pitch degrees towards it, turning the view along, so a
+// camera looking at the pivot keeps looking at it
+func (c *Camera) Orbit(pivot vec3.Vec3, yaw, pitch float64) {
+	offset := vec3.Rotate(c.Pos.Sub(pivot), c.up, yaw)
+	c.Dir = vec3.Rotate(c.Dir.ToUnit(), c.up, yaw)
+	if dist := offset.Norm(); dist > 0 {
+		elevation := utils.RadToDeg(math.Asin(max(-1, min(1, vec3.Dot(offset, c.up)/dist))))
+		pitch = max(-maxPitch, min(maxPitch, elevation+pitch)) - elevation
+	}
+	_, right, _ := c.levelBasis()
+	offset = vec3.Rotate(offset, right, pitch)
+	c.Dir = vec3.Rotate(c.Dir, right, pitch)
+	c.Pos = pivot.Add(offset)
+}
+
+// levelBasis returns the basis of the camera without its roll
+func (c *Camera) levelBasis() (forward, right, up vec3.Vec3) {
+	rolled := *c
+	rolled.roll = 0
+	return rolled.Basis()
+}
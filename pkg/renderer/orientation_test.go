@@ -0,0 +1,97 @@
+package renderer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+func checkOrthonormal(t *testing.T, c *Camera) {
+	t.Helper()
+	forward, right, up := c.Basis()
+	for _, v := range []vec3.Vec3{forward, right, up} {
+		if math.Abs(v.Norm()-1) > 1e-9 {
+			t.Errorf("Expected a unit vector. Got %v", v)
+		}
+	}
+	if math.Abs(vec3.Dot(forward, right)) > 1e-9 || math.Abs(vec3.Dot(forward, up)) > 1e-9 || math.Abs(vec3.Dot(right, up)) > 1e-9 {
+		t.Errorf("Expected perpendicular axes. Got %v %v %v", forward, right, up)
+	}
+}
+
+func TestCameraDefaultBasis(t *testing.T) {
+	c := NewCamera(vec3.Zero, 32, 24, "./rend_test")
+	forward, right, up := c.Basis()
+	if forward != vec3.UnitX || right != vec3.UnitY || up != vec3.UnitZ {
+		t.Errorf("Expected the X, Y, Z basis. Got %v %v %v", forward, right, up)
+	}
+}
+
+func TestCameraTurnKeepsBasis(t *testing.T) {
+	c := NewCamera(vec3.Zero, 32, 24, "./rend_test")
+	for range 100 {
+		c.RotateLeft(0.3)
+		c.Turn(7, 11)
+		c.SetRoll(c.Roll() + 13)
+		checkOrthonormal(t, c)
+	}
+	if _, pitch, _ := c.Orientation(); math.Abs(pitch-maxPitch) > 1e-6 {
+		t.Errorf("Expected the pitch to stop at %f. Got %f", maxPitch, pitch)
+	}
+}
+
+func TestCameraOrientationRoundTrip(t *testing.T) {
+	c := NewCamera(vec3.Zero, 32, 24, "./rend_test")
+	c.SetUp(vec3.New(0, 1, 1))
+	c.SetOrientation(-120, 35, 10)
+	yaw, pitch, roll := c.Orientation()
+	if math.Abs(yaw+120) > 1e-9 || math.Abs(pitch-35) > 1e-9 || roll != 10 {
+		t.Errorf("Expected -120, 35, 10. Got %f, %f, %f", yaw, pitch, roll)
+	}
+	checkOrthonormal(t, c)
+}
+
+func TestCameraLookAt(t *testing.T) {
+	c := NewCamera(vec3.New(3, -4, 2), 32, 24, "./rend_test")
+	target := vec3.New(-1, 2, 0.5)
+	c.LookAt(target)
+	x, y, ok := c.Project(target)
+	if !ok || math.Abs(x-16) > 1e-9 || math.Abs(y-12) > 1e-9 {
+		t.Errorf("Expected the target at the image center. Got %f, %f, %t", x, y, ok)
+	}
+}
+
+func TestCameraOrbit(t *testing.T) {
+	c := NewCamera(vec3.New(-5, 0, 0), 32, 24, "./rend_test")
+	pivot := vec3.New(0, 1, 0)
+	c.LookAt(pivot)
+	dist := c.Pos.Sub(pivot).Norm()
+	for range 20 {
+		c.Orbit(pivot, 17, 9)
+		if d := c.Pos.Sub(pivot).Norm(); math.Abs(d-dist) > 1e-9 {
+			t.Fatalf("Expected to stay %f from the pivot. Got %f", dist, d)
+		}
+		if d := c.Dir.Sub(vec3.DirFromPos(pivot, c.Pos)).Norm(); d > 1e-9 {
+			t.Fatalf("Expected to keep looking at the pivot. Got %v", c.Dir)
+		}
+	}
+	elevation := math.Asin(vec3.Dot(c.Pos.Sub(pivot), c.Up()) / dist)
+	if math.Abs(elevation*180/math.Pi-maxPitch) > 1e-6 {
+		t.Errorf("Expected the orbit to stop at %f degrees. Got %f", maxPitch, elevation*180/math.Pi)
+	}
+}
+
+func TestCameraRollProject(t *testing.T) {
+	c := NewCamera(vec3.Zero, 32, 24, "./rend_test")
+	c.SetRoll(90)
+	// a point to the right of the view lands above or below the center once rolled
+	x, y, ok := c.Project(vec3.New(10, 1, 0))
+	if !ok || math.Abs(x-16) > 1e-9 || math.Abs(y-12) < 1 {
+		t.Errorf("Expected the point straight above or below the center. Got %f, %f", x, y)
+	}
+	ray := c.RayForSubPixel(x, y, nil)
+	if d := ray.dir.ToUnit().Sub(vec3.New(10, 1, 0).ToUnit()).Norm(); d > 1e-9 {
+		t.Errorf("Expected the ray back through the point. Got %v", ray.dir)
+	}
+}
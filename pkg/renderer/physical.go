@@ -0,0 +1,155 @@
+package renderer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Solidsilver/go-ray-march/pkg/utils"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+// PhysicalCameraOpts describes a camera the way a photographer would.
+// The field of view, lens aperture and exposure of a render are derived
+// from it with Apply.
+type PhysicalCameraOpts struct {
+	// FocalLength is the focal length of the lens in mm
+	FocalLength float64
+	// SensorWidth and SensorHeight are the size of the film back in mm.
+	// The image covers as much of the sensor as its aspect ratio allows.
+	SensorWidth  float64
+	SensorHeight float64
+	FStop        float64
+	// ShutterSpeed is the exposure time in seconds
+	ShutterSpeed float64
+	ISO          float64
+	// UnitScale is the length of a world unit in meters
+	UnitScale float64
+}
+
+// DefaultPhysicalCameraOpts returns a 50mm lens on a full frame sensor at
+// f/8, 1/60s and ISO 100. Scenes are lit for these exposure settings, so
+// they leave the exposure unchanged.
+func DefaultPhysicalCameraOpts() PhysicalCameraOpts {
+	return PhysicalCameraOpts{
+		FocalLength:  50,
+		SensorWidth:  36,
+		SensorHeight: 24,
+		FStop:        8,
+		ShutterSpeed: 1.0 / 60,
+		ISO:          100,
+		UnitScale:    1,
+	}
+}
+
+func (pc PhysicalCameraOpts) String() string {
+	return fmt.Sprintf("physical: {focalLength: %0.1fmm, sensor: %0.1fx%0.1fmm, fStop: %0.1f, shutterSpeed: %0.4fs, iso: %0.0f, unitScale: %f}", pc.FocalLength, pc.SensorWidth, pc.SensorHeight, pc.FStop, pc.ShutterSpeed, pc.ISO, pc.UnitScale)
+}
+
+// Validate reports every setting that isn't positive
+func (pc PhysicalCameraOpts) Validate() error {
+	var errs []error
+	for _, s := range []struct {
+		name  string
+		value float64
+	}{
+		{"focal length", pc.FocalLength},
+		{"sensor width", pc.SensorWidth},
+		{"sensor height", pc.SensorHeight},
+		{"f-stop", pc.FStop},
+		{"shutter speed", pc.ShutterSpeed},
+		{"ISO", pc.ISO},
+		{"unit scale", pc.UnitScale},
+	} {
+		if s.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %v", s.name, s.value))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Fov returns the vertical field of view in degrees of a dimX x dimY image
+func (pc PhysicalCameraOpts) Fov(dimX, dimY int) float64 {
+	height := min(pc.SensorHeight, pc.SensorWidth*float64(dimY)/float64(dimX))
+	return utils.RadToDeg(2 * math.Atan(height/(2*pc.FocalLength)))
+}
+
+// Aperture returns the radius of the lens opening in world units
+func (pc PhysicalCameraOpts) Aperture() float64 {
+	return pc.FocalLength / pc.FStop / 2 / 1000 / pc.UnitScale
+}
+
+// EV100 returns the exposure value of the settings at ISO 100
+func (pc PhysicalCameraOpts) EV100() float64 {
+	return math.Log2(pc.FStop * pc.FStop / pc.ShutterSpeed * 100 / pc.ISO)
+}
+
+// Exposure returns the exposure in stops relative to the default settings
+func (pc PhysicalCameraOpts) Exposure() float64 {
+	return DefaultPhysicalCameraOpts().EV100() - pc.EV100()
+}
+
+// Apply sets the field of view and lens aperture of opts from the
+// settings and adds their exposure to the tone mapping exposure, which
+// makes it exposure compensation on top of the camera.
+func (pc PhysicalCameraOpts) Apply(opts *RenderOpts) {
+	opts.Fov = pc.Fov(opts.DimX, opts.DimY)
+	opts.Lens.Aperture = pc.Aperture()
+	opts.ToneMap.Exposure += pc.Exposure()
+}
+
+// NewCameraPhysical creates a camera with the field of view and lens
+// aperture of the physical settings. The exposure isn't part of the
+// camera, use Apply to carry it into the tone mapping of a render.
+func NewCameraPhysical(pos vec3.Vec3, sizeX int, sizeY int, physical PhysicalCameraOpts, imgOut string) *Camera {
+	lens := DefaultLensOpts()
+	lens.Aperture = physical.Aperture()
+	return NewCameraOpts(CameraOpts{
+		Position: pos,
+		Size:     utils.NewVec2(float64(sizeX), float64(sizeY)),
+		Fov:      physical.Fov(sizeX, sizeY),
+		ImgDir:   imgOut,
+		Lens:     lens,
+	})
+}
+
+// ParseShutterSpeed converts a shutter speed in seconds, written as a
+// number or a fraction like 1/250, into seconds
+func ParseShutterSpeed(s string) (float64, error) {
+	num, den, isFraction := strings.Cut(s, "/")
+	speed, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err == nil && isFraction {
+		var d float64
+		d, err = strconv.ParseFloat(strings.TrimSpace(den), 64)
+		speed /= d
+	}
+	if err != nil || speed <= 0 || math.IsInf(speed, 0) || math.IsNaN(speed) {
+		return 0, fmt.Errorf("invalid shutter speed: %q", s)
+	}
+	return speed, nil
+}
+
+// ParsePhysicalCamera builds the physical camera given on the command
+// line, with the sensor size written as "36x24" and the shutter speed
+// as accepted by ParseShutterSpeed, and validates it
+func ParsePhysicalCamera(focalLength float64, sensor string, fStop float64, shutterSpeed string, iso, unitScale float64) (PhysicalCameraOpts, error) {
+	pc := PhysicalCameraOpts{
+		FocalLength: focalLength,
+		FStop:       fStop,
+		ISO:         iso,
+		UnitScale:   unitScale,
+	}
+	width, height, _ := strings.Cut(sensor, "x")
+	var errW, errH, err error
+	pc.SensorWidth, errW = strconv.ParseFloat(strings.TrimSpace(width), 64)
+	pc.SensorHeight, errH = strconv.ParseFloat(strings.TrimSpace(height), 64)
+	if errW != nil || errH != nil {
+		return pc, fmt.Errorf("invalid sensor size %q: %w", sensor, errors.Join(errW, errH))
+	}
+	if pc.ShutterSpeed, err = ParseShutterSpeed(shutterSpeed); err != nil {
+		return pc, err
+	}
+	return pc, pc.Validate()
+}
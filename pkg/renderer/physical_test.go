@@ -0,0 +1,106 @@
+package renderer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+func TestPhysicalCameraFov(t *testing.T) {
+	pc := DefaultPhysicalCameraOpts()
+	// a 3:2 image sees the whole 24mm height of the sensor
+	want := 2 * math.Atan(12.0/50) * 180 / math.Pi
+	if got := pc.Fov(1500, 1000); math.Abs(got-want) > 1e-9 {
+		t.Errorf("Expected a %f degree field of view. Got %f", want, got)
+	}
+	// a 16:9 image is cropped to the 36mm width
+	want = 2 * math.Atan(36.0*9/16/2/50) * 180 / math.Pi
+	if got := pc.Fov(1920, 1080); math.Abs(got-want) > 1e-9 {
+		t.Errorf("Expected a %f degree field of view. Got %f", want, got)
+	}
+	// a longer lens narrows the view
+	pc.FocalLength = 200
+	if pc.Fov(1920, 1080) >= DefaultPhysicalCameraOpts().Fov(1920, 1080) {
+		t.Error("Expected a narrower view with a longer lens")
+	}
+}
+
+func TestPhysicalCameraExposure(t *testing.T) {
+	pc := DefaultPhysicalCameraOpts()
+	if pc.Exposure() != 0 {
+		t.Errorf("Expected the default settings to leave the exposure. Got %f", pc.Exposure())
+	}
+	// one stop wider, twice the time and twice the ISO each add a stop
+	pc.FStop /= math.Sqrt2
+	pc.ShutterSpeed *= 2
+	pc.ISO *= 2
+	if math.Abs(pc.Exposure()-3) > 1e-9 {
+		t.Errorf("Expected 3 stops more exposure. Got %f", pc.Exposure())
+	}
+}
+
+func TestPhysicalCameraApply(t *testing.T) {
+	opts := testOpts()
+	opts.ToneMap.Exposure = 1
+	pc := DefaultPhysicalCameraOpts()
+	pc.FStop = 2
+	pc.UnitScale = 0.01
+	pc.Apply(&opts)
+	// 50mm at f/2 is a 12.5mm radius, or 1.25 centimeter units
+	if math.Abs(opts.Lens.Aperture-1.25) > 1e-9 {
+		t.Errorf("Expected an aperture of 1.25. Got %f", opts.Lens.Aperture)
+	}
+	if math.Abs(opts.ToneMap.Exposure-5) > 1e-9 {
+		t.Errorf("Expected 4 stops on top of the compensation. Got %f", opts.ToneMap.Exposure)
+	}
+	if opts.Fov != pc.Fov(opts.DimX, opts.DimY) {
+		t.Errorf("Expected the field of view of the lens. Got %f", opts.Fov)
+	}
+	if err := opts.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	cam := NewCameraPhysical(vec3.Zero, opts.DimX, opts.DimY, pc, "./rend_test")
+	if cam.Fov() != opts.Fov || cam.Lens().Aperture != opts.Lens.Aperture {
+		t.Errorf("Expected the camera to match the options. Got %f, %+v", cam.Fov(), cam.Lens())
+	}
+
+	pc.ISO = 0
+	if err := pc.Validate(); err == nil {
+		t.Error("Expected an error for an ISO of 0")
+	}
+}
+
+func TestParseShutterSpeed(t *testing.T) {
+	for s, want := range map[string]float64{"1/250": 0.004, "0.5": 0.5, "2": 2, " 1 / 8 ": 0.125} {
+		got, err := ParseShutterSpeed(s)
+		if err != nil || math.Abs(got-want) > 1e-12 {
+			t.Errorf("Expected %q to be %f. Got %f, %v", s, want, got, err)
+		}
+	}
+	for _, s := range []string{"", "fast", "1/0", "-1/60", "0"} {
+		if _, err := ParseShutterSpeed(s); err == nil {
+			t.Errorf("Expected an error for %q", s)
+		}
+	}
+}
+
+func TestParsePhysicalCamera(t *testing.T) {
+	pc, err := ParsePhysicalCamera(35, "23.6x15.6", 2.8, "1/250", 400, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PhysicalCameraOpts{FocalLength: 35, SensorWidth: 23.6, SensorHeight: 15.6, FStop: 2.8, ShutterSpeed: 0.004, ISO: 400, UnitScale: 1}
+	if pc != want {
+		t.Errorf("Expected %v. Got %v", want, pc)
+	}
+	for _, sensor := range []string{"36", "36xfull", "0x24"} {
+		if _, err := ParsePhysicalCamera(50, sensor, 8, "1/60", 100, 1); err == nil {
+			t.Errorf("Expected an error for the sensor size %q", sensor)
+		}
+	}
+	if _, err := ParsePhysicalCamera(50, "36x24", 8, "fast", 100, 1); err == nil {
+		t.Error("Expected an error for an invalid shutter speed")
+	}
+}
@@ -0,0 +1,149 @@
+package renderer
+
+import (
+	"time"
+
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+// pixelSample is the result of shading a single ray: its radiance,
+// along with the surface information adaptive anti-aliasing uses
+// to detect edges and the renderer writes out as AOV passes
+type pixelSample struct {
+	color vec3.Vec3
+	// depth is the distance marched along the ray
+	depth float64
+	// objID is the object ID of the hit drawable within the scene
+	objID int64
+	hit   bool
+	// linearDepth is the distance of the hit along the view direction
+	linearDepth float64
+	normal      vec3.Vec3
+	albedo      vec3.Vec3
+	position    vec3.Vec3
+	steps       float64
+	shadow      float64
+}
+
+// pixelShader marches a ray and shades whatever it hits
+type pixelShader func(ray Ray, renderer *Renderer) pixelSample
+
+func newPixelSample(marchRslt MarchResult, radiance vec3.Vec3, visibility lightVisibility, renderer *Renderer) pixelSample {
+	sample := pixelSample{
+		color: radiance,
+		depth: marchRslt.Distance,
+		steps: float64(marchRslt.Steps),
+	}
+	if marchRslt.HitObject == nil {
+		return sample
+	}
+	sample.hit = true
+	sample.objID = renderer.scene.ObjectID(marchRslt.HitObject)
+	sample.position = marchRslt.HitPos
+	if !renderer.opts.recordsSurface() {
+		return sample
+	}
+
+	sample.linearDepth = vec3.Dot(marchRslt.HitPos.Sub(renderer.camera.Pos), renderer.camera.Dir.ToUnit())
+	sample.albedo = marchRslt.HitObject.ColorVec()
+	sample.normal = SurfaceNormal(marchRslt, renderer.scene.options.trace.fastMath)
+	if renderer.scene.options.shadows {
+		sample.shadow = visibility.shadow()
+	}
+	return sample
+}
+
+func shadeLighting2(ray Ray, renderer *Renderer) pixelSample {
+	marchRslt := RayMarch(ray, renderer, false)
+	radiance, visibility := calculateRadiance2(marchRslt, renderer)
+	return newPixelSample(marchRslt, radiance, visibility, renderer)
+}
+
+func shadeLightingTest(ray Ray, renderer *Renderer) pixelSample {
+	marchRslt := RayMarchP(ray, renderer, false)
+	radiance, visibility := calculateRadianceTest(marchRslt, renderer)
+	return newPixelSample(marchRslt, radiance, visibility, renderer)
+}
+
+// renderPixel shades the pixel at pt according to the
+// anti-aliasing options and writes it to the camera
+func (r *Renderer) renderPixel(pt Point, shade pixelShader) {
+	r.storeSample(pt, r.samplePixel(pt, shade))
+}
+
+// samplePixel shades the pixel at pt according to the anti-aliasing options
+func (r *Renderer) samplePixel(pt Point, shade pixelShader) pixelSample {
+	if r.stats == nil {
+		return r.shadePixel(pt, shade)
+	}
+	start := time.Now()
+	sample := r.shadePixel(pt, shade)
+	r.recordHeatmap(pt, sample, time.Since(start))
+	return sample
+}
+
+func (r *Renderer) shadePixel(pt Point, shade pixelShader) pixelSample {
+	if r.singleRay() {
+		if r.reproj != nil {
+			if sample, ok := r.reprojectPixel(pt, shade); ok {
+				return sample
+			}
+		}
+		rng := r.pixelRNG(pt, streamPrimary)
+		if n := r.pixelRays(); n > 1 {
+			return r.averagePixel(pt, shade, n, rng)
+		}
+		view := r.sliceFor(0, 1, rng)
+		return shade(view.camera.RayForPixel(pt, rng), view)
+	}
+	return r.superSample(pt, shade, r.opts.AA.Mode == AAGrid, r.pixelRNG(pt, streamPrimary))
+}
+
+// singleRay reports whether the first pass traces
+// a single ray through the center of each pixel
+func (r *Renderer) singleRay() bool {
+	aa := r.opts.AA
+	return aa.Mode == AANone || aa.Mode == AAAdaptive || aa.Samples <= 1
+}
+
+// pixelRays returns the number of rays a pixel traces when it isn't
+// supersampled. With motion blur a pixel averages an instant from each
+// time slice and with depth of field the lens samples, so both blur
+// instead of adding noise.
+func (r *Renderer) pixelRays() int {
+	n := 1
+	if r.timeSlices != nil {
+		n = len(r.timeSlices)
+	}
+	if r.camera.hasAperture() {
+		n = max(n, r.camera.lens.Samples)
+	}
+	return n
+}
+
+// storeSample keeps the sample for adaptive anti-aliasing and writes it to the camera
+func (r *Renderer) storeSample(pt Point, sample pixelSample) {
+	if r.aaSamples != nil {
+		r.aaSamples[pt.Y*r.camera.SizeX+pt.X] = sample
+	}
+	r.writeSample(pt, sample)
+}
+
+// writeSample stores the radiance of a pixel in the HDR buffer, writes a
+// tone mapped preview of it to the camera image and fills in its AOVs
+func (r *Renderer) writeSample(pt Point, sample pixelSample) {
+	r.writePreview(pt, sample.color)
+	r.recordHistory(pt, sample)
+	for pass, buf := range r.aovBufs {
+		buf.Set(pt.X, pt.Y, sample.aov(pass))
+	}
+}
+
+// writePreview stores the radiance of a pixel in the HDR buffer
+// and writes a tone mapped preview of it to the camera image
+func (r *Renderer) writePreview(pt Point, radiance vec3.Vec3) {
+	r.camera.HDR.Set(pt.X, pt.Y, radiance)
+	tm := r.opts.ToneMap
+	display := tm.Apply(radiance, tm.Scale())
+	r.camera.Image.Set(pt.X, pt.Y, vec3.Vec3ToRGBA(display, r.scene.options.bg.color.A))
+}
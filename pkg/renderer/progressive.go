@@ -0,0 +1,127 @@
+package renderer
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"slices"
+)
+
+type ProgressiveOpts struct {
+	// Enabled renders the frame in passes of shrinking blocks, each
+	// refining the one before it, before the full resolution pass
+	Enabled bool
+	// Levels are the block sizes of the coarse passes in pixels
+	Levels []int
+}
+
+func DefaultProgressiveOpts() ProgressiveOpts {
+	return ProgressiveOpts{
+		Enabled: false,
+		Levels:  []int{16, 8, 4, 2},
+	}
+}
+
+func (po ProgressiveOpts) String() string {
+	return fmt.Sprintf("progressive: {enabled: %t, levels: %v}", po.Enabled, po.Levels)
+}
+
+// levels returns the coarse block sizes from largest to smallest,
+// without duplicates or sizes too small to be a block
+func (po ProgressiveOpts) levels() []int {
+	levels := []int{}
+	for _, size := range po.Levels {
+		if size > 1 && !slices.Contains(levels, size) {
+			levels = append(levels, size)
+		}
+	}
+	slices.Sort(levels)
+	slices.Reverse(levels)
+	return levels
+}
+
+// passes returns the number of tile passes a frame takes
+func (po ProgressiveOpts) passes() int {
+	if !po.Enabled {
+		return 1
+	}
+	return len(po.levels()) + 1
+}
+
+// BlockPass returns the name of the progressive
+// pass that renders blocks of the given size
+func BlockPass(size int) string {
+	return fmt.Sprintf("blocks%d", size)
+}
+
+// renderProgressive renders one pixel out of every block for each level,
+// filling the rest of the block with it, then renders the full frame.
+// When a pixel is shaded the same way at every level, pixels already
+// rendered by a coarser level are kept instead of being shaded again.
+func (r *Renderer) renderProgressive(ctx context.Context, workers int, shade pixelShader, events *renderEvents) {
+	reuse := r.singleRay()
+	prev := 0
+	for _, block := range r.opts.Progressive.levels() {
+		r.runTiles(ctx, workers, func(tile image.Rectangle) {
+			r.renderBlocks(ctx, tile, shade, block, prev, reuse)
+		}, events.tileDone)
+		if ctx.Err() != nil {
+			return
+		}
+		events.passDone(BlockPass(block))
+		prev = block
+	}
+
+	if !reuse {
+		prev = 0
+	}
+	r.runTiles(ctx, workers, func(tile image.Rectangle) {
+		r.renderBlocks(ctx, tile, shade, 1, prev, reuse)
+	}, events.tileDone)
+}
+
+// renderBlocks renders the pixels of the tile that lie on the grid of the
+// given block size, skipping those on the grid of the previous level.
+// A block is filled in full even where it reaches into the next tile,
+// whose own blocks only start on the grid.
+func (r *Renderer) renderBlocks(ctx context.Context, tile image.Rectangle, shade pixelShader, block, prev int, reuse bool) {
+	window := r.window()
+	for y := alignUp(tile.Min.Y, block); y < tile.Max.Y; y += block {
+		if ctx.Err() != nil {
+			return
+		}
+		for x := alignUp(tile.Min.X, block); x < tile.Max.X; x += block {
+			if prev > 0 && x%prev == 0 && y%prev == 0 {
+				continue
+			}
+			pt := Point{x, y}
+			if block == 1 {
+				r.renderPixel(pt, shade)
+				continue
+			}
+
+			var sample pixelSample
+			if reuse {
+				sample = r.samplePixel(pt, shade)
+				r.storeSample(pt, sample)
+			} else {
+				rng := r.pixelRNG(pt, streamPreview)
+				view := r.sliceFor(0, 1, rng)
+				sample = shade(view.camera.RayForPixel(pt, rng), view)
+				r.writePreview(pt, sample.color)
+			}
+			for by := y; by < min(y+block, window.Max.Y); by++ {
+				for bx := x; bx < min(x+block, window.Max.X); bx++ {
+					if bx != x || by != y {
+						r.writePreview(Point{bx, by}, sample.color)
+					}
+				}
+			}
+		}
+	}
+}
+
+// alignUp rounds v up to the next multiple of n
+func alignUp(v, n int) int {
+	return (v + n - 1) / n * n
+}
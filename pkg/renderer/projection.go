@@ -0,0 +1,201 @@
+package renderer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/Solidsilver/go-ray-march/pkg/utils"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+// Projection maps the pixels of an image to the rays leaving the camera
+type Projection int
+
+const (
+	// ProjectPerspective is a pinhole camera with the vertical field of view of the camera
+	ProjectPerspective Projection = iota
+	// ProjectOrthographic sends parallel rays from a plane ViewWidth wide
+	ProjectOrthographic
+	// ProjectFisheye is an equidistant fisheye with FisheyeFov across the
+	// circle fitting the image. Pixels outside the circle show the background.
+	ProjectFisheye
+	// ProjectEquirectangular maps longitude to x and latitude to y,
+	// covering the full sphere around the camera
+	ProjectEquirectangular
+	// ProjectCubemap renders the six 90 degree faces of a cube around the
+	// camera side by side, in the order front, right, back, left, up and
+	// down. The image has to be six times as wide as it is high.
+	ProjectCubemap
+)
+
+var projectionNames = map[Projection]string{
+	ProjectPerspective:     "perspective",
+	ProjectOrthographic:    "orthographic",
+	ProjectFisheye:         "fisheye",
+	ProjectEquirectangular: "equirect",
+	ProjectCubemap:         "cubemap",
+}
+
+func (p Projection) String() string {
+	if name, ok := projectionNames[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("Projection(%d)", int(p))
+}
+
+// ParseProjection converts a projection name (perspective, orthographic,
+// fisheye, equirect, cubemap) into a Projection
+func ParseProjection(name string) (Projection, error) {
+	for p, pName := range projectionNames {
+		if strings.EqualFold(name, pName) {
+			return p, nil
+		}
+	}
+	return ProjectPerspective, fmt.Errorf("unknown projection: %q", name)
+}
+
+type ProjectionOpts struct {
+	Mode Projection
+	// ViewWidth is the width of the view in world units for orthographic projection
+	ViewWidth float64
+	// FisheyeFov is the field of view in degrees across the image circle
+	// of a fisheye, up to 360
+	FisheyeFov float64
+}
+
+func DefaultProjectionOpts() ProjectionOpts {
+	return ProjectionOpts{
+		Mode:       ProjectPerspective,
+		ViewWidth:  4,
+		FisheyeFov: 180,
+	}
+}
+
+func (po ProjectionOpts) String() string {
+	return fmt.Sprintf("projection: {mode: %s, viewWidth: %f, fisheyeFov: %0.2f}", po.Mode, po.ViewWidth, po.FisheyeFov)
+}
+
+// validate reports the projection options that can't be rendered
+// into a dimX x dimY image
+func (po ProjectionOpts) validate(dimX, dimY int) []error {
+	var errs []error
+	switch po.Mode {
+	case ProjectOrthographic:
+		if po.ViewWidth <= 0 {
+			errs = append(errs, fmt.Errorf("orthographic view width must be positive, got %f", po.ViewWidth))
+		}
+	case ProjectFisheye:
+		if po.FisheyeFov <= 0 || po.FisheyeFov > 360 {
+			errs = append(errs, fmt.Errorf("fisheye field of view must be between 0 and 360 degrees, got %0.2f", po.FisheyeFov))
+		}
+	case ProjectCubemap:
+		if dimX != 6*dimY {
+			errs = append(errs, fmt.Errorf("a cubemap has to be 6 times as wide as it is high, got %dx%d", dimX, dimY))
+		}
+	case ProjectPerspective, ProjectEquirectangular:
+	default:
+		errs = append(errs, fmt.Errorf("unknown projection %s", po.Mode))
+	}
+	return errs
+}
+
+// Projection returns the projection of the camera
+func (c *Camera) Projection() ProjectionOpts {
+	return c.projection
+}
+
+// SetProjection sets the projection of the camera
+func (c *Camera) SetProjection(projection ProjectionOpts) {
+	c.projection = projection
+}
+
+// frameSize returns the size of the whole frame the image of the camera
+// is part of, which is larger than the image for band cameras
+func (c *Camera) frameSize() Point {
+	if c.full != (Point{}) {
+		return c.full
+	}
+	return Point{c.SizeX, c.SizeY}
+}
+
+// frameCoords returns where the image position (x, y) lies in the frame
+// relative to the center of the pixels, in units of half the frame size
+func (c *Camera) frameCoords(x, y float64) (u, v float64) {
+	size := c.frameSize()
+	w, h := float64(size.X), float64(size.Y)
+	u = (x + float64(c.offset.X) - (w-1)/2) / (w / 2)
+	v = (y + float64(c.offset.Y) - (h-1)/2) / (h / 2)
+	return u, v
+}
+
+// missRay returns a ray that starts beyond any trace distance, so it
+// hits nothing and shows the background
+func (c *Camera) missRay() Ray {
+	forward, _, _ := c.Basis()
+	return Ray{origin: c.Pos, dir: forward, start: math.Inf(1)}
+}
+
+func (c *Camera) orthographicRay(x, y float64) Ray {
+	forward, right, up := c.Basis()
+	size := c.frameSize()
+	u, v := c.frameCoords(x, y)
+	halfW := c.projection.ViewWidth / 2
+	halfH := halfW * float64(size.Y) / float64(size.X)
+	origin := c.Pos.Add(right.Mult(u * halfW)).Add(up.Mult(v * halfH))
+	return Ray{origin: origin, dir: forward}
+}
+
+func (c *Camera) fisheyeRay(x, y float64) Ray {
+	forward, right, up := c.Basis()
+	size := c.frameSize()
+	u, v := c.frameCoords(x, y)
+	// scale to the circle fitting the shorter side of the frame
+	if size.X > size.Y {
+		u *= float64(size.X) / float64(size.Y)
+	} else {
+		v *= float64(size.Y) / float64(size.X)
+	}
+	r := math.Hypot(u, v)
+	if r > 1 {
+		return c.missRay()
+	}
+	theta := r * utils.DegToRad(c.projection.FisheyeFov) / 2
+	phi := math.Atan2(v, u)
+	side := right.Mult(math.Cos(phi)).Add(up.Mult(math.Sin(phi)))
+	dir := forward.Mult(math.Cos(theta)).Add(side.Mult(math.Sin(theta)))
+	return Ray{origin: c.Pos, dir: dir}
+}
+
+func (c *Camera) equirectangularRay(x, y float64) Ray {
+	forward, right, up := c.Basis()
+	u, v := c.frameCoords(x, y)
+	lon := u * math.Pi
+	lat := v * math.Pi / 2
+	level := forward.Mult(math.Cos(lon)).Add(right.Mult(math.Sin(lon)))
+	dir := level.Mult(math.Cos(lat)).Add(up.Mult(math.Sin(lat)))
+	return Ray{origin: c.Pos, dir: dir}
+}
+
+func (c *Camera) cubemapRay(x, y float64) Ray {
+	forward, right, up := c.Basis()
+	size := c.frameSize()
+	faceSize := float64(size.X) / 6
+	fx := x + float64(c.offset.X)
+	face := min(max(int(math.Floor((fx+0.5)/faceSize)), 0), 5)
+	u := (fx - float64(face)*faceSize - (faceSize-1)/2) / (faceSize / 2)
+	_, v := c.frameCoords(x, y)
+
+	// the view direction, right and up of each face
+	faces := [6][3]vec3.Vec3{
+		{forward, right, up},
+		{right, forward.Mult(-1), up},
+		{forward.Mult(-1), right.Mult(-1), up},
+		{right.Mult(-1), forward, up},
+		{up, right, forward.Mult(-1)},
+		{up.Mult(-1), right, forward},
+	}
+	axes := faces[face]
+	dir := axes[0].Add(axes[1].Mult(u)).Add(axes[2].Mult(v))
+	return Ray{origin: c.Pos, dir: dir.ToUnit()}
+}
@@ -0,0 +1,105 @@
+package renderer
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"github.com/Solidsilver/go-ray-march/pkg/utils"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+func projectionCamera(mode Projection, sizeX, sizeY int) *Camera {
+	proj := DefaultProjectionOpts()
+	proj.Mode = mode
+	proj.FisheyeFov = 360
+	cam := NewCameraOpts(CameraOpts{
+		Position:   vec3.New(-5, 0, 0),
+		Size:       utils.NewVec2(float64(sizeX), float64(sizeY)),
+		Fov:        45,
+		Projection: proj,
+	})
+	return cam
+}
+
+func checkDir(t *testing.T, name string, got, want vec3.Vec3) {
+	t.Helper()
+	if d := got.ToUnit().Sub(want).Norm(); d > 1e-9 {
+		t.Errorf("%s: expected direction %v. Got %v", name, want, got.ToUnit())
+	}
+}
+
+func TestParseProjection(t *testing.T) {
+	for mode, name := range projectionNames {
+		got, err := ParseProjection(name)
+		if err != nil || got != mode {
+			t.Errorf("Expected %s. Got %s, %v", mode, got, err)
+		}
+	}
+	if _, err := ParseProjection("pinhole"); err == nil {
+		t.Error("Expected an error for an unknown projection")
+	}
+}
+
+func TestOrthographicRays(t *testing.T) {
+	cam := projectionCamera(ProjectOrthographic, 41, 21)
+	left := cam.pinholeRay(0, 10)
+	right := cam.pinholeRay(40, 10)
+	checkDir(t, "left", left.dir, vec3.UnitX)
+	checkDir(t, "right", right.dir, vec3.UnitX)
+	// the pixel centers span the view width less one pixel
+	want := cam.projection.ViewWidth * 40 / 41
+	if d := right.origin.Sub(left.origin); math.Abs(d.Y-want) > 1e-9 || d.X != 0 || d.Z != 0 {
+		t.Errorf("Expected the origins %f apart along Y. Got %v", want, d)
+	}
+}
+
+func TestFisheyeRays(t *testing.T) {
+	cam := projectionCamera(ProjectFisheye, 41, 21)
+	checkDir(t, "center", cam.pinholeRay(20, 10).dir, vec3.UnitX)
+	// with 360 degrees the edge of the circle looks backwards
+	checkDir(t, "edge", cam.pinholeRay(20, -0.5).dir, vec3.UnitX.Mult(-1))
+	ray := cam.pinholeRay(0, 0)
+	r := newTestRenderer(testOpts())
+	if rslt := RayMarch(ray, r, false); rslt.HitObject != nil || rslt.Steps != 0 {
+		t.Errorf("Expected a pixel outside the circle to miss. Got %+v", rslt)
+	}
+}
+
+func TestEquirectangularRays(t *testing.T) {
+	cam := projectionCamera(ProjectEquirectangular, 40, 20)
+	checkDir(t, "center", cam.pinholeRay(19.5, 9.5).dir, vec3.UnitX)
+	checkDir(t, "right", cam.pinholeRay(29.5, 9.5).dir, vec3.UnitY)
+	checkDir(t, "behind", cam.pinholeRay(-0.5, 9.5).dir, vec3.UnitX.Mult(-1))
+	checkDir(t, "pole", cam.pinholeRay(3, 19.5).dir, vec3.UnitZ)
+}
+
+func TestCubemapRays(t *testing.T) {
+	cam := projectionCamera(ProjectCubemap, 60, 10)
+	centers := []vec3.Vec3{vec3.UnitX, vec3.UnitY, vec3.UnitX.Mult(-1), vec3.UnitY.Mult(-1), vec3.UnitZ, vec3.UnitZ.Mult(-1)}
+	for face, want := range centers {
+		checkDir(t, "face", cam.pinholeRay(float64(face*10)+4.5, 4.5).dir, want)
+	}
+	// neighboring faces meet at the same direction
+	checkDir(t, "seam", cam.pinholeRay(9.5, 4.5).dir, vec3.New(1, 1, 0).ToUnit())
+
+	opts := testOpts()
+	opts.Projection.Mode = ProjectCubemap
+	if err := opts.Validate(); err == nil {
+		t.Error("Expected an error for a cubemap that isn't 6:1")
+	}
+}
+
+func TestProjectionBands(t *testing.T) {
+	for mode := range projectionNames {
+		cam := projectionCamera(mode, 60, 10)
+		band := cam.band(image.Rect(0, 4, 60, 7), 60, 10)
+		for _, pt := range []Point{{0, 4}, {13, 5}, {59, 6}} {
+			want := cam.pinholeRay(float64(pt.X), float64(pt.Y))
+			got := band.pinholeRay(float64(pt.X), float64(pt.Y-4))
+			if got.origin != want.origin || got.dir != want.dir {
+				t.Errorf("%s: expected the band ray %v at %v. Got %v", mode, want, pt, got)
+			}
+		}
+	}
+}
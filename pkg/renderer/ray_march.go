@@ -13,23 +13,32 @@ type MarchResult struct {
 	Steps     int
 	Distance  float64
 	Mhd       float64
+	// Inside is set when the ray started inside an object and
+	// hit its surface from within
+	Inside bool
 }
 
-func RayMarch(ray Ray, renderer *Renderer, showLight bool) MarchResult {
+func RayMarch(ray Ray, renderer *Renderer, showLight bool) (rslt MarchResult) {
+	if renderer.stats != nil {
+		defer func() { renderer.stats.addRay(showLight, rslt, renderer.scene.options.trace.maxSteps) }()
+	}
 	scene := renderer.scene
-	totalDistTraveled := 0.0
-	curPos := ray.origin
+	totalDistTraveled := ray.start
+	curPos := ray.origin.Add(ray.dir.Mult(ray.start))
 	totalMin := renderer.scene.options.trace.maxDist
 	var closest drawables.Drawable
 	steps := 0
 	minDistAvg := 0.0
 	maxTraceCubed := renderer.scene.options.trace.maxDist * renderer.scene.options.trace.maxDist //* MAXIMUM_TRACE_DISTANCE
+	inside := false
 
 	for totalDistTraveled < renderer.scene.options.trace.maxDist {
 		minDist := renderer.scene.options.trace.maxDist
-		for _, obj := range scene.Drawables {
+		for i, obj := range scene.Drawables {
 			dist := 0.0
-			if renderer.scene.options.trace.fastMath {
+			if renderer.stats != nil {
+				dist = renderer.timedDist(i, obj, curPos)
+			} else if renderer.scene.options.trace.fastMath {
 				dist = obj.FastDist(curPos)
 			} else {
 				dist = obj.Dist(curPos)
@@ -41,9 +50,11 @@ func RayMarch(ray Ray, renderer *Renderer, showLight bool) MarchResult {
 			}
 		}
 		if renderer.scene.options.shadows && showLight {
-			for _, obj := range scene.Lights {
+			for i, obj := range scene.Lights {
 				dist := 0.0
-				if renderer.scene.options.trace.fastMath {
+				if renderer.stats != nil {
+					dist = renderer.timedDist(len(scene.Drawables)+i, obj, curPos)
+				} else if renderer.scene.options.trace.fastMath {
 					dist = obj.FastDist(curPos)
 				} else {
 					dist = obj.Dist(curPos)
@@ -55,13 +66,15 @@ func RayMarch(ray Ray, renderer *Renderer, showLight bool) MarchResult {
 			}
 		}
 
+		minDist, inside = insideDist(steps, minDist, inside)
+
 		oldAvg := minDistAvg
 		minDistAvg -= minDistAvg / 3
 		minDistAvg += minDist / 3
 		minDistSlope := minDistAvg - oldAvg
 
 		if steps == renderer.scene.options.trace.maxSteps {
-			return MarchResult{closest, curPos, renderer.scene.options.trace.maxSteps, totalDistTraveled, renderer.scene.options.trace.minHitDist}
+			return MarchResult{closest, curPos, renderer.scene.options.trace.maxSteps, totalDistTraveled, renderer.scene.options.trace.minHitDist, inside}
 		}
 
 		minHitDist := renderer.scene.options.trace.minHitDist
@@ -77,7 +90,7 @@ func RayMarch(ray Ray, renderer *Renderer, showLight bool) MarchResult {
 				retPos = retPos.Sub(ray.dir.Mult(minHitDist))
 			}
 
-			return MarchResult{closest, retPos, steps, totalDistTraveled, minHitDist}
+			return MarchResult{closest, retPos, max(steps, ray.minSteps), totalDistTraveled, minHitDist, inside}
 		}
 		distP := minDist * 0.95
 
@@ -91,15 +104,18 @@ func RayMarch(ray Ray, renderer *Renderer, showLight bool) MarchResult {
 		}
 
 	}
-	return MarchResult{nil, curPos, steps, totalDistTraveled, renderer.scene.options.trace.minHitDist}
+	return MarchResult{nil, curPos, steps, totalDistTraveled, renderer.scene.options.trace.minHitDist, false}
 
 }
 
-func RayMarchP(ray Ray, renderer *Renderer, showLight bool) MarchResult {
+func RayMarchP(ray Ray, renderer *Renderer, showLight bool) (rslt MarchResult) {
+	if renderer.stats != nil {
+		defer func() { renderer.stats.addRay(showLight, rslt, renderer.scene.options.trace.maxSteps) }()
+	}
 	// scene := renderer.scene
-	// inside := false
-	totalDistTraveled := 0.0
-	curPos := vec3.NewCp(ray.origin)
+	inside := false
+	totalDistTraveled := ray.start
+	curPos := vec3.NewCp(ray.origin.Add(ray.dir.Mult(ray.start)))
 	totalMin := renderer.scene.options.trace.maxDist
 	var closest drawables.Drawable
 	steps := 0
@@ -108,9 +124,11 @@ func RayMarchP(ray Ray, renderer *Renderer, showLight bool) MarchResult {
 
 	for totalDistTraveled < renderer.scene.options.trace.maxDist {
 		minDist := renderer.scene.options.trace.maxDist
-		for _, obj := range renderer.scene.Drawables {
+		for i, obj := range renderer.scene.Drawables {
 			dist := 0.0
-			if renderer.scene.options.trace.fastMath {
+			if renderer.stats != nil {
+				dist = renderer.timedDist(i, obj, *curPos)
+			} else if renderer.scene.options.trace.fastMath {
 				dist = obj.FastDist(*curPos)
 			} else {
 				dist = obj.Dist(*curPos)
@@ -122,9 +140,11 @@ func RayMarchP(ray Ray, renderer *Renderer, showLight bool) MarchResult {
 			}
 		}
 		if renderer.scene.options.shadows && showLight {
-			for _, obj := range renderer.scene.Lights {
+			for i, obj := range renderer.scene.Lights {
 				dist := 0.0
-				if renderer.scene.options.trace.fastMath {
+				if renderer.stats != nil {
+					dist = renderer.timedDist(len(renderer.scene.Drawables)+i, obj, *curPos)
+				} else if renderer.scene.options.trace.fastMath {
 					dist = obj.FastDist(*curPos)
 				} else {
 					dist = obj.Dist(*curPos)
@@ -136,13 +156,7 @@ func RayMarchP(ray Ray, renderer *Renderer, showLight bool) MarchResult {
 			}
 		}
 
-		// if steps == 0 && minDist < 0 {
-		// 	inside = true
-		// }
-		// if minDist < 0 &&
-		//  {
-		// 	minDist = -minDist
-		// }
+		minDist, inside = insideDist(steps, minDist, inside)
 
 		oldAvg := minDistAvg
 		minDistAvg -= minDistAvg / 3
@@ -150,7 +164,7 @@ func RayMarchP(ray Ray, renderer *Renderer, showLight bool) MarchResult {
 		minDistSlope := minDistAvg - oldAvg
 
 		if steps == renderer.scene.options.trace.maxSteps {
-			return MarchResult{closest, *curPos, renderer.scene.options.trace.maxSteps, totalDistTraveled, renderer.scene.options.trace.minHitDist}
+			return MarchResult{closest, *curPos, renderer.scene.options.trace.maxSteps, totalDistTraveled, renderer.scene.options.trace.minHitDist, inside}
 		}
 
 		minHitDist := renderer.scene.options.trace.minHitDist
@@ -168,7 +182,7 @@ func RayMarchP(ray Ray, renderer *Renderer, showLight bool) MarchResult {
 				// retPos = retPos.Sub(ray.dir.Mult(minHitDist))
 			}
 
-			return MarchResult{closest, *curPos, steps, totalDistTraveled, minHitDist}
+			return MarchResult{closest, *curPos, max(steps, ray.minSteps), totalDistTraveled, minHitDist, inside}
 		}
 		distP := minDist * 0.95
 
@@ -184,31 +198,53 @@ func RayMarchP(ray Ray, renderer *Renderer, showLight bool) MarchResult {
 		totalMin = math.Min(totalMin, minDist)
 
 	}
-	return MarchResult{nil, *curPos, steps, totalDistTraveled, renderer.scene.options.trace.minHitDist}
+	return MarchResult{nil, *curPos, steps, totalDistTraveled, renderer.scene.options.trace.minHitDist, false}
+
+}
 
+// insideDist returns the distance to step along a ray and whether the
+// ray is inside an object. A ray starting inside an object marches to
+// where it leaves the object, measuring distances from the inside.
+func insideDist(steps int, minDist float64, inside bool) (float64, bool) {
+	if steps == 0 && minDist < 0 {
+		inside = true
+	}
+	if inside {
+		return -minDist, true
+	}
+	return minDist, false
 }
 
+// SurfaceNormal returns the unit normal of the hit object at the hit
+// position, from forward differences of its distance field. For a ray
+// that hit the surface from inside the object the normal points inwards,
+// facing the ray.
 func SurfaceNormal(hitRslt MarchResult, fast bool) vec3.Vec3 {
 	obj := hitRslt.HitObject
+	dist := obj.Dist
+	if fast {
+		dist = obj.FastDist
+	}
 	dx := hitRslt.HitPos.Add(vec3.NewX(hitRslt.Mhd))
 	dy := hitRslt.HitPos.Add(vec3.NewY(hitRslt.Mhd))
 	dz := hitRslt.HitPos.Add(vec3.NewZ(hitRslt.Mhd))
-	var normal *vec3.Vec3
-	switch fast {
-	case true:
-		normal = vec3.NewP(
-			obj.FastDist(dx),
-			obj.FastDist(dy),
-			obj.FastDist(dz),
-		)
-	case false:
-		normal = vec3.NewP(
-			obj.Dist(dx),
-			obj.Dist(dy),
-			obj.Dist(dz),
-		)
-	}
-	normal.MinusSet(hitRslt.Distance)
+	normal := vec3.NewP(
+		dist(dx),
+		dist(dy),
+		dist(dz),
+	)
+	normal.MinusSet(dist(hitRslt.HitPos))
 	normal.ToUnitSet()
+	if hitRslt.Inside {
+		normal.MultSet(-1)
+	}
 	return *normal
 }
+
+// secondaryRay returns a ray in direction dir leaving the surface at a
+// hit. It starts off the surface along the normal by the surface bias,
+// so it doesn't hit the surface it leaves from.
+func secondaryRay(hitRslt MarchResult, normal, dir vec3.Vec3, renderer *Renderer) Ray {
+	bias := renderer.scene.options.trace.surfaceBias * hitRslt.Mhd
+	return Ray{origin: hitRslt.HitPos.Add(normal.Mult(bias)), dir: dir}
+}
@@ -0,0 +1,83 @@
+package renderer
+
+import (
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/Solidsilver/go-ray-march/pkg/drawables"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+var marchFuncs = map[string]func(Ray, *Renderer, bool) MarchResult{
+	"RayMarch":  RayMarch,
+	"RayMarchP": RayMarchP,
+}
+
+func TestRayMarchFromInside(t *testing.T) {
+	r := newTestRenderer(testOpts())
+	for name, march := range marchFuncs {
+		ray := Ray{origin: vec3.New(0.2, 0, 0), dir: vec3.UnitX}
+		rslt := march(ray, r, false)
+		if rslt.HitObject == nil || !rslt.Inside {
+			t.Fatalf("%s: expected an inside hit. Got %+v", name, rslt)
+		}
+		if d := math.Abs(rslt.HitPos.Norm() - 1); d > 0.01 {
+			t.Errorf("%s: expected the hit on the sphere surface. Got %v, %f off", name, rslt.HitPos, d)
+		}
+		normal := SurfaceNormal(rslt, false)
+		if vec3.Dot(normal, ray.dir) > -0.99 {
+			t.Errorf("%s: expected the normal to face the ray. Got %v", name, normal)
+		}
+	}
+}
+
+func TestRayMarchFromOutside(t *testing.T) {
+	r := newTestRenderer(testOpts())
+	for name, march := range marchFuncs {
+		rslt := march(Ray{origin: vec3.New(-5, 0, 0), dir: vec3.UnitX}, r, false)
+		if rslt.HitObject == nil || rslt.Inside {
+			t.Fatalf("%s: expected an outside hit. Got %+v", name, rslt)
+		}
+		if d := rslt.HitPos.Sub(vec3.New(-1, 0, 0)).Norm(); d > 0.01 {
+			t.Errorf("%s: expected the hit at the front of the sphere. Got %v", name, rslt.HitPos)
+		}
+	}
+}
+
+func TestSurfaceNormalUsesLocalDistance(t *testing.T) {
+	r := newTestRenderer(testOpts())
+	rslt := RayMarch(Ray{origin: vec3.New(-5, 0.3, 0.2), dir: vec3.UnitX}, r, false)
+	if rslt.HitObject == nil {
+		t.Fatal("Expected the ray to hit the sphere")
+	}
+	normal := SurfaceNormal(rslt, false)
+	want := rslt.HitPos.ToUnit()
+	if d := normal.Sub(want).Norm(); d > 0.01 {
+		t.Errorf("Expected normal %v. Got %v", want, normal)
+	}
+}
+
+func TestSecondaryRayBias(t *testing.T) {
+	scene := NewBlankScene()
+	scene.AddDrawables(drawables.NewSphere(vec3.Zero, 1, color.RGBA{255, 255, 255, 255}, false))
+	light := drawables.NewLight(vec3.New(-5, 0, 0), 0.01, color.RGBA{255, 255, 255, 255}, false)
+	scene.AddLights(light)
+	opts := testOpts()
+	cam := NewCameraFOV(vec3.New(-5, 0, 0), opts.DimX, opts.DimY, opts.Fov, "./rend_test")
+	r := NewRendererOpts(scene, cam, opts)
+
+	// a hit that landed just below the surface
+	hit := MarchResult{HitObject: scene.Drawables[0], HitPos: vec3.New(-0.9999, 0, 0), Mhd: 0.0005}
+	lightDir := vec3.DirFromPos(light.Pos(), hit.HitPos)
+	normal := SurfaceNormal(hit, false)
+
+	unbiased := RayMarch(Ray{origin: hit.HitPos, dir: lightDir}, &r, true)
+	if drawables.Equals(unbiased.HitObject, light) {
+		t.Fatal("Expected a ray from below the surface to hit the sphere")
+	}
+	biased := RayMarch(secondaryRay(hit, normal, lightDir, &r), &r, true)
+	if !drawables.Equals(biased.HitObject, light) {
+		t.Errorf("Expected the biased ray to reach the light. Got %+v", biased)
+	}
+}
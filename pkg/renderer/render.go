@@ -0,0 +1,314 @@
+package renderer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+	"sync"
+
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+)
+
+// ErrRenderInProgress is returned when Render is called
+// while the renderer is still working on another frame
+var ErrRenderInProgress = errors.New("a render is already in progress")
+
+// ShadingModel selects how hit points are lit
+type ShadingModel int
+
+const (
+	// ShadeAngle fades each light linearly with the angle
+	// between it and the surface normal
+	ShadeAngle ShadingModel = iota
+	// ShadeLambert uses the cosine falloff of a Lambertian
+	// surface and the in-place vector marcher
+	ShadeLambert
+)
+
+var shadingModelNames = map[ShadingModel]string{
+	ShadeAngle:   "angle",
+	ShadeLambert: "lambert",
+}
+
+func (m ShadingModel) String() string {
+	if name, ok := shadingModelNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("ShadingModel(%d)", int(m))
+}
+
+// ParseShadingModel converts a model name (angle, lambert)
+// into a ShadingModel
+func ParseShadingModel(name string) (ShadingModel, error) {
+	for model, modelName := range shadingModelNames {
+		if strings.EqualFold(name, modelName) {
+			return model, nil
+		}
+	}
+	return ShadeAngle, fmt.Errorf("unknown shading model: %q", name)
+}
+
+func (m ShadingModel) shader() pixelShader {
+	if m == ShadeLambert {
+		return shadeLightingTest
+	}
+	return shadeLighting2
+}
+
+// Validate reports every option that can't be rendered with
+func (opts RenderOpts) Validate() error {
+	var errs []error
+	if opts.Workers < 1 {
+		errs = append(errs, fmt.Errorf("workers must be at least 1, got %d", opts.Workers))
+	}
+	if opts.DimX < 1 || opts.DimY < 1 {
+		errs = append(errs, fmt.Errorf("dimensions must be at least 1x1, got %dx%d", opts.DimX, opts.DimY))
+	}
+	if opts.Fov <= 0 || opts.Fov >= 180 {
+		errs = append(errs, fmt.Errorf("field of view must be between 0 and 180 degrees, got %0.2f", opts.Fov))
+	}
+	if opts.AA.Samples < 1 {
+		errs = append(errs, fmt.Errorf("anti-aliasing samples must be at least 1, got %d", opts.AA.Samples))
+	}
+	if opts.Tiles.Size < 1 {
+		errs = append(errs, fmt.Errorf("tile size must be at least 1, got %d", opts.Tiles.Size))
+	}
+	if opts.Motion.TimeSamples < 0 {
+		errs = append(errs, fmt.Errorf("time samples can't be negative, got %d", opts.Motion.TimeSamples))
+	}
+	if opts.Lens.Aperture < 0 {
+		errs = append(errs, fmt.Errorf("aperture can't be negative, got %f", opts.Lens.Aperture))
+	}
+	if opts.Lens.Aperture > 0 && opts.Lens.Samples < 1 {
+		errs = append(errs, fmt.Errorf("lens samples must be at least 1, got %d", opts.Lens.Samples))
+	}
+	errs = append(errs, opts.Projection.validate(opts.DimX, opts.DimY)...)
+	if opts.Projection.Mode != ProjectPerspective {
+		if opts.Lens.Aperture > 0 {
+			errs = append(errs, fmt.Errorf("depth of field needs the perspective projection, got %s", opts.Projection.Mode))
+		}
+		if opts.Temporal.Enabled {
+			errs = append(errs, fmt.Errorf("temporal reprojection needs the perspective projection, got %s", opts.Projection.Mode))
+		}
+	}
+	if opts.Progressive.Enabled && len(opts.Progressive.levels()) == 0 {
+		errs = append(errs, fmt.Errorf("progressive rendering needs at least one block size above 1, got %v", opts.Progressive.Levels))
+	}
+	if opts.Temporal.Tolerance < 0 {
+		errs = append(errs, fmt.Errorf("temporal tolerance can't be negative, got %f", opts.Temporal.Tolerance))
+	}
+	if !opts.Crop.Window.IsZero() {
+		frame := image.Rect(0, 0, opts.DimX, opts.DimY)
+		if window := opts.Crop.Window.Rect(opts.DimX, opts.DimY); window.Empty() || !window.In(frame) {
+			errs = append(errs, fmt.Errorf("crop window %s must be a non-empty part of the %dx%d frame", opts.Crop.Window, opts.DimX, opts.DimY))
+		}
+		if opts.Temporal.Enabled {
+			errs = append(errs, errors.New("temporal reprojection can't be used with a crop window"))
+		}
+	}
+	if err := opts.Post.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if opts.Denoise.Enabled && opts.Denoise.Filter.Iterations < 1 {
+		errs = append(errs, fmt.Errorf("denoiser iterations must be at least 1, got %d", opts.Denoise.Filter.Iterations))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid render options: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Render renders a frame of the scene with the given options and returns
+// the camera image. The camera is resized to the dimensions of the options
+// if they differ, but its field of view, lens and shutter stay as they were
+// set up. With a crop window only the window is rendered and, unless the
+// whole canvas is asked for, returned. Rendering stops as soon as ctx is
+// cancelled, in which case the context's error is returned and the image
+// is left partially rendered.
+func (r *Renderer) Render(ctx context.Context, opts RenderOpts) (image.Image, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if !r.rendering.CompareAndSwap(false, true) {
+		return nil, ErrRenderInProgress
+	}
+	defer r.rendering.Store(false)
+
+	r.opts = opts
+	if r.camera.SizeX != opts.DimX || r.camera.SizeY != opts.DimY {
+		r.camera.Resize(opts.DimX, opts.DimY)
+	} else if r.camera.Image.Bounds() != image.Rect(0, 0, opts.DimX, opts.DimY) {
+		// the image was replaced, such as by a combined stereo image
+		r.camera.Reset()
+	}
+	shade := opts.Shading.shader()
+
+	// progressive levels aren't checkpointed, so checkpointed
+	// frames only go over the frame once
+	progressive := opts.Progressive.Enabled && r.checkpoint == nil
+	passes := 1
+	if progressive {
+		passes = opts.Progressive.passes()
+	}
+	events := r.startEvents(passes)
+	r.beginFrame()
+	onTile := events.tileDone
+	if cp := r.checkpoint; cp != nil {
+		events.skipped(cp.restore(r))
+		onTile = func(tile image.Rectangle) {
+			cp.tileDone(r, tile)
+			events.tileDone(tile)
+		}
+	}
+	if progressive {
+		r.renderProgressive(ctx, opts.Workers, shade, events)
+	} else {
+		r.renderTiles(ctx, opts.Workers, shade, onTile)
+	}
+	if ctx.Err() == nil {
+		events.passDone(PassTiles)
+	}
+	r.finishFrame(ctx, opts.Workers, shade, events)
+	err := ctx.Err()
+	if err == nil {
+		r.finishStats()
+	}
+	r.stats = nil
+	if r.checkpoint != nil {
+		if saveErr := r.checkpoint.takeErr(); saveErr != nil {
+			err = errors.Join(err, fmt.Errorf("saving checkpoint: %w", saveErr))
+		}
+		if ctx.Err() != nil {
+			if saveErr := r.checkpoint.Save(); saveErr != nil {
+				err = errors.Join(err, fmt.Errorf("saving checkpoint: %w", saveErr))
+			}
+		} else {
+			r.checkpoint.finishFrame()
+		}
+	}
+	events.finished(err)
+	if err != nil {
+		return nil, err
+	}
+	return cropImage(r.camera.Image, r.camera.output), nil
+}
+
+// ErrNeedsWholeFrame is returned by RenderTile for options that
+// need every pixel of the frame to render a single one
+var ErrNeedsWholeFrame = errors.New("option needs the whole frame")
+
+// ValidateTile reports the options a lone tile can't be rendered with
+func (opts RenderOpts) ValidateTile() error {
+	var errs []error
+	if opts.AA.Mode == AAAdaptive && opts.AA.Samples > 1 {
+		errs = append(errs, fmt.Errorf("adaptive anti-aliasing: %w", ErrNeedsWholeFrame))
+	}
+	if opts.Denoise.Enabled {
+		errs = append(errs, fmt.Errorf("denoising: %w", ErrNeedsWholeFrame))
+	}
+	if len(opts.AOVs) > 0 {
+		errs = append(errs, fmt.Errorf("AOVs: %w", ErrNeedsWholeFrame))
+	}
+	if opts.Temporal.Enabled {
+		errs = append(errs, fmt.Errorf("temporal reprojection: %w", ErrNeedsWholeFrame))
+	}
+	return errors.Join(errs...)
+}
+
+// RenderTile renders a single tile of the frame and returns its linear
+// radiance, without tone mapping it or running any of the passes that
+// need the whole frame. Rows of the tile are shared between the workers.
+// Rendering the tiles of a frame one by one gives the same radiance as
+// rendering the frame with Render, up to the rounding of jittered sample
+// positions. Only the tile is held in memory, so the camera's own image
+// isn't used and can be created at any size.
+func (r *Renderer) RenderTile(ctx context.Context, opts RenderOpts, tile image.Rectangle) (*framebuffer.Buffer, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.ValidateTile(); err != nil {
+		return nil, fmt.Errorf("can't render a lone tile: %w", err)
+	}
+	if tile.Empty() || !tile.In(image.Rect(0, 0, opts.DimX, opts.DimY)) {
+		return nil, fmt.Errorf("tile %v is outside the %dx%d frame", tile, opts.DimX, opts.DimY)
+	}
+	if !r.rendering.CompareAndSwap(false, true) {
+		return nil, ErrRenderInProgress
+	}
+	defer r.rendering.Store(false)
+
+	full := r.camera
+	defer func() { r.camera = full }()
+	r.opts = opts
+	r.camera = full.band(tile, opts.DimX, opts.DimY)
+	shade := opts.Shading.shader()
+
+	r.beginFrame()
+	rows := make(chan int, tile.Dy())
+	for y := range tile.Dy() {
+		rows <- y
+	}
+	close(rows)
+	var wg sync.WaitGroup
+	for range opts.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := range rows {
+				if ctx.Err() != nil {
+					return
+				}
+				for x := range tile.Dx() {
+					r.renderPixel(Point{x, y}, shade)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	r.timeSlices = nil
+	r.stats = nil
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.camera.HDR, nil
+}
+
+// beginFrame prepares the per-frame state of the renderer
+// before any pixels are rendered
+func (r *Renderer) beginFrame() {
+	r.camera.output = image.Rectangle{}
+	if !r.opts.Crop.Window.IsZero() && !r.opts.Crop.Canvas {
+		r.camera.output = r.window()
+	}
+	r.beginStats()
+	r.beginAA()
+	r.beginMotion()
+	r.beginAOVs()
+	r.beginTemporal()
+}
+
+// finishFrame runs the passes that need the whole frame
+// once every pixel has been rendered
+func (r *Renderer) finishFrame(ctx context.Context, workers int, shade pixelShader, events *renderEvents) {
+	if r.aaSamples != nil {
+		r.finishAA(ctx, workers, shade)
+		if ctx.Err() == nil {
+			events.passDone(PassAntiAlias)
+		}
+	}
+	r.timeSlices = nil
+	if ctx.Err() != nil {
+		r.reproj = nil
+		r.historyNext = nil
+		return
+	}
+	r.finishTemporal()
+	if r.opts.Denoise.Enabled {
+		r.Denoise()
+		events.passDone(PassDenoise)
+	}
+	r.Resolve()
+	events.passDone(PassResolve)
+}
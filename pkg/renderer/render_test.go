@@ -0,0 +1,344 @@
+package renderer
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"github.com/Solidsilver/go-ray-march/pkg/drawables"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+func newTestRenderer(opts RenderOpts) *Renderer {
+	scene := NewBlankScene()
+	scene.AddDrawables(drawables.NewSphere(vec3.Zero, 1, color.RGBA{255, 255, 255, 255}, false))
+	scene.AddLights(drawables.NewLight(vec3.New(-5, -5, 5), 0.001, color.RGBA{255, 255, 255, 255}, false))
+	cam := NewCameraFOV(vec3.New(-5, 0, 0), opts.DimX, opts.DimY, opts.Fov, "./rend_test")
+	r := NewRendererOpts(scene, cam, opts)
+	return &r
+}
+
+func testOpts() RenderOpts {
+	opts := DefaultRenderOpts()
+	opts.Workers = 2
+	opts.DimX = 32
+	opts.DimY = 24
+	return opts
+}
+
+func TestRenderValidatesOptions(t *testing.T) {
+	opts := testOpts()
+	r := newTestRenderer(opts)
+	opts.Workers = 0
+	opts.DimY = 0
+	if _, err := r.Render(context.Background(), opts); err == nil {
+		t.Error("Expected an error for zero workers and dimensions")
+	}
+}
+
+func TestRenderCancelled(t *testing.T) {
+	opts := testOpts()
+	r := newTestRenderer(opts)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.Render(ctx, opts); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled. Got %v", err)
+	}
+}
+
+func TestRenderResizesCamera(t *testing.T) {
+	opts := testOpts()
+	r := newTestRenderer(opts)
+	opts.DimX, opts.DimY = 16, 8
+	img, err := r.Render(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 16 || b.Dy() != 8 {
+		t.Errorf("Expected a 16x8 image. Got %dx%d", b.Dx(), b.Dy())
+	}
+}
+
+func TestRenderEvents(t *testing.T) {
+	opts := testOpts()
+	r := newTestRenderer(opts)
+	events := []Event{}
+	r.SetObserver(ObserverFunc(func(e Event) {
+		events = append(events, e)
+	}))
+	if _, err := r.Render(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if first := events[0]; first.Kind != EventStarted || first.Total != 32*24 {
+		t.Errorf("Expected a started event for %d pixels. Got %+v", 32*24, first)
+	}
+	last := events[len(events)-1]
+	if last.Kind != EventFinished || last.Err != nil {
+		t.Errorf("Expected a successful finished event. Got %+v", last)
+	}
+	passes := []string{}
+	for _, e := range events {
+		if e.Kind == EventPassDone {
+			passes = append(passes, e.Pass)
+			if e.Pass == PassTiles && e.Done != e.Total {
+				t.Errorf("Expected every pixel to be done after the tile pass. Got %d of %d", e.Done, e.Total)
+			}
+		}
+	}
+	if len(passes) != 2 || passes[0] != PassTiles || passes[1] != PassResolve {
+		t.Errorf("Expected the tiles and resolve passes. Got %v", passes)
+	}
+}
+
+func TestProgressiveMatchesFullRender(t *testing.T) {
+	opts := testOpts()
+	full, err := newTestRenderer(opts).Render(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Progressive.Enabled = true
+	opts.Tiles.Size = 10
+	progressive, err := newTestRenderer(opts).Render(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < opts.DimY; y++ {
+		for x := 0; x < opts.DimX; x++ {
+			if full.At(x, y) != progressive.At(x, y) {
+				t.Fatalf("Expected pixel (%d, %d) to match the full render. Got %v and %v", x, y, progressive.At(x, y), full.At(x, y))
+			}
+		}
+	}
+}
+
+func TestProgressiveBlocksCoverTileEdges(t *testing.T) {
+	opts := testOpts()
+	opts.Progressive.Enabled = true
+	opts.Progressive.Levels = []int{8}
+	// tiles that aren't a multiple of the block size
+	opts.Tiles.Size = 10
+	r := newTestRenderer(opts)
+	r.SetObserver(ObserverFunc(func(e Event) {
+		if e.Kind != EventPassDone || e.Pass != BlockPass(8) {
+			return
+		}
+		for y := range opts.DimY {
+			for x := range opts.DimX {
+				if r.camera.Image.RGBAAt(x, y).A == 0 {
+					t.Fatalf("Expected the 8 pixel blocks to cover the frame. Got an empty pixel at (%d, %d)", x, y)
+				}
+			}
+		}
+	}))
+	if _, err := r.Render(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInvalidateHistoryAfterSceneEdit(t *testing.T) {
+	opts := testOpts()
+	opts.Temporal.Enabled = true
+	opts.Stats.Enabled = true
+	r := newTestRenderer(opts)
+	if _, err := r.Render(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	// only the color changes, so the old pixels still lie on the surface
+	r.scene.Drawables[0] = drawables.NewSphere(vec3.Zero, 1, color.RGBA{255, 0, 0, 255}, false)
+	r.InvalidateHistory()
+	got, err := r.Render(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := r.Stats(); stats.ReusedPixels != 0 || stats.SeededPixels != 0 {
+		t.Errorf("Expected no pixels to be reprojected after the scene was edited. Got %d reused and %d seeded", stats.ReusedPixels, stats.SeededPixels)
+	}
+
+	opts.Temporal.Enabled = false
+	fresh := newTestRenderer(opts)
+	fresh.scene.Drawables[0] = r.scene.Drawables[0]
+	want, err := fresh.Render(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := meanDiff(got, want); d != 0 {
+		t.Errorf("Expected the frame after the edit to match a fresh render. Got a mean difference of %f", d)
+	}
+}
+
+func TestReprojectionMarchesEdgesInFull(t *testing.T) {
+	opts := testOpts()
+	opts.Temporal.Enabled = true
+	r := newTestRenderer(opts)
+	// a wall behind the sphere fills the whole frame
+	r.scene.AddDrawables(drawables.NewBox(vec3.New(3, 0, 0), vec3.New(0.1, 20, 20), color.RGBA{0, 0, 255, 255}))
+	if _, err := r.Render(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	r.beginFrame()
+	for _, pt := range []Point{{3, 3}, {opts.DimX / 2, opts.DimY / 2}} {
+		if _, ok := r.reprojectPixel(pt, shadeLighting2); !ok {
+			t.Errorf("Expected pixel %v to be reprojected", pt)
+		}
+	}
+	for _, pt := range []Point{{0, 4}, {4, 1}, {opts.DimX - 2, 4}, {4, opts.DimY - 1}} {
+		if _, ok := r.reprojectPixel(pt, shadeLighting2); ok {
+			t.Errorf("Expected pixel %v at the edge of the frame to be marched in full", pt)
+		}
+	}
+
+	// without the wall, the edge of the sphere lies next to pixels that missed
+	r = newTestRenderer(opts)
+	if _, err := r.Render(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+	r.beginFrame()
+	edges := 0
+	for y := reprojectBorder; y < opts.DimY-reprojectBorder; y++ {
+		for x := reprojectBorder; x < opts.DimX-reprojectBorder; x++ {
+			i := y*opts.DimX + x
+			if !r.reproj[i].valid || (r.reproj[i-1].valid && r.reproj[i+1].valid) {
+				continue
+			}
+			edges++
+			if _, ok := r.reprojectPixel(Point{x, y}, shadeLighting2); ok {
+				t.Errorf("Expected pixel (%d, %d) next to a miss to be marched in full", x, y)
+			}
+		}
+	}
+	if edges == 0 {
+		t.Error("Expected the sphere to have edges in the frame")
+	}
+}
+
+func TestRenderTileOnlyHoldsTheTile(t *testing.T) {
+	opts := testOpts()
+	opts.AA.Mode = AAJitter
+	opts.AA.Samples = 2
+	full := newTestRenderer(opts)
+	if _, err := full.Render(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	tile := image.Rect(8, 4, 20, 12)
+	small := opts
+	small.DimX, small.DimY = tile.Dx(), tile.Dy()
+	r := newTestRenderer(small)
+	buf, err := r.RenderTile(context.Background(), opts, tile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Width != tile.Dx() || buf.Height != tile.Dy() {
+		t.Fatalf("Expected a %dx%d tile. Got %dx%d", tile.Dx(), tile.Dy(), buf.Width, buf.Height)
+	}
+	if r.camera.SizeX != small.DimX || r.camera.SizeY != small.DimY {
+		t.Errorf("Expected the camera to keep its %dx%d size. Got %dx%d", small.DimX, small.DimY, r.camera.SizeX, r.camera.SizeY)
+	}
+	for y := range tile.Dy() {
+		for x := range tile.Dx() {
+			want := full.camera.HDR.At(tile.Min.X+x, tile.Min.Y+y)
+			if d := buf.At(x, y).Sub(want).Norm(); d > 1e-9 {
+				t.Fatalf("Expected pixel (%d, %d) of the tile to match the full render. Got %v, want %v", x, y, buf.At(x, y), want)
+			}
+		}
+	}
+}
+
+func meanDiff(a, b image.Image) float64 {
+	sum := 0.0
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r1, g1, b1, _ := a.At(x, y).RGBA()
+			r2, g2, b2, _ := b.At(x, y).RGBA()
+			sum += math.Abs(float64(r1)-float64(r2)) + math.Abs(float64(g1)-float64(g2)) + math.Abs(float64(b1)-float64(b2))
+		}
+	}
+	return sum / (3 * 0xffff * float64(bounds.Dx()*bounds.Dy()))
+}
+
+func TestTemporalReprojection(t *testing.T) {
+	for _, reuse := range []bool{true, false} {
+		opts := testOpts()
+		opts.Temporal.Enabled = true
+		opts.Temporal.Reuse = reuse
+		opts.Stats.Enabled = true
+		r := newTestRenderer(opts)
+		if _, err := r.Render(context.Background(), opts); err != nil {
+			t.Fatal(err)
+		}
+		moved := r.camera.Pos.Add(vec3.New(0.05, 0.02, 0))
+		r.camera.Pos = moved
+		got, err := r.Render(context.Background(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats := r.Stats()
+
+		opts.Temporal.Enabled = false
+		fresh := newTestRenderer(opts)
+		fresh.camera.Pos = moved
+		want, err := fresh.Render(context.Background(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := meanDiff(got, want); d > 0.01 {
+			t.Errorf("reuse %t: expected the reprojected frame to match a fresh render. Got a mean difference of %f", reuse, d)
+		}
+
+		if reuse && stats.ReusedPixels == 0 {
+			t.Errorf("Expected pixels of the sphere to be reused. Got %+v", stats)
+		}
+		if !reuse {
+			if stats.ReusedPixels != 0 || stats.SeededPixels == 0 {
+				t.Errorf("Expected pixels of the sphere to be seeded and none reused. Got %+v", stats)
+			}
+			// seeded rays start next to the surface, so the sphere is evaluated less often
+			if seeded, full := stats.Drawables[0].Evaluations, fresh.Stats().Drawables[0].Evaluations; seeded >= full {
+				t.Errorf("Expected seeding to evaluate the sphere less than the %d times of a fresh render. Got %d", full, seeded)
+			}
+		}
+	}
+}
+
+func TestReprojectionMarchesDisocclusions(t *testing.T) {
+	opts := testOpts()
+	opts.Temporal.Enabled = true
+	r := newTestRenderer(opts)
+	// a small sphere hides the middle of the unit sphere from the camera
+	r.scene.AddDrawables(drawables.NewSphere(vec3.New(-3, 0, 0), 0.3, color.RGBA{255, 0, 0, 255}, false))
+	if _, err := r.Render(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// moving sideways, the center ray passes the small sphere and sees
+	// a part of the unit sphere that was behind it
+	r.camera.Pos = vec3.New(-5, 0.6, 0)
+	r.beginFrame()
+	center := Point{opts.DimX / 2, opts.DimY / 2}
+	if _, ok := r.reprojectPixel(center, shadeLighting2); ok {
+		t.Error("Expected the disoccluded pixel to be marched in full")
+	}
+	if sample := r.samplePixel(center, shadeLighting2); sample.objID != r.scene.ObjectID(r.scene.Drawables[0]) {
+		t.Errorf("Expected the disoccluded pixel to show the unit sphere. Got object %d", sample.objID)
+	}
+
+	got, err := r.Render(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Temporal.Enabled = false
+	fresh := newTestRenderer(opts)
+	fresh.scene.AddDrawables(r.scene.Drawables[1])
+	fresh.camera.Pos = r.camera.Pos
+	want, err := fresh.Render(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := meanDiff(got, want); d > 0.01 {
+		t.Errorf("Expected the reprojected frame to match a fresh render. Got a mean difference of %f", d)
+	}
+}
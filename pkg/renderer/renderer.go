@@ -2,18 +2,15 @@ package renderer
 
 import (
 	"fmt"
+	"image"
 	"image/color"
 	"math"
-	"math/rand"
-	"sync"
 	"sync/atomic"
-	"time"
 
 	"github.com/Solidsilver/go-ray-march/pkg/drawables"
-	"github.com/Solidsilver/go-ray-march/pkg/utils"
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+	"github.com/Solidsilver/go-ray-march/pkg/postfx"
 	"github.com/Solidsilver/go-ray-march/pkg/vec3"
-	"github.com/rs/zerolog/log"
-	pb "github.com/schollz/progressbar/v3"
 )
 
 // const MINIMUM_HIT_DISTANCE = 0.0001
@@ -30,25 +27,46 @@ var BG_COLOR = color.RGBA{0, 0, 0, 255}
 type Ray struct {
 	origin vec3.Vec3
 	dir    vec3.Vec3
+	// start is how far along dir marching begins
+	start float64
+	// minSteps is the lowest step count a hit reports, so rays seeded
+	// from a previous frame keep the ambient occlusion of a full march
+	minSteps int
 }
 
 type Renderer struct {
 	scene  *Scene
 	camera *Camera
-	isDone atomic.Bool
-	Reset  atomic.Bool
+	opts   RenderOpts
+	// rendering is set while a frame is in progress
+	rendering  atomic.Bool
+	aaSamples  []pixelSample
+	timeSlices []*Renderer
+	// aovBufs holds every pass being recorded, which are the
+	// requested AOVs plus any the denoiser needs as guides
+	aovBufs  map[AOV]*framebuffer.Buffer
+	observer Observer
+	// history is the last finished frame, historyNext the one being
+	// rendered and reproj the history moved into the current camera
+	history     *frameHistory
+	historyNext *frameHistory
+	reproj      []reprojected
+	// stats collects the statistics of the render in progress
+	stats       *statsCollector
+	lastStats   RenderStats
+	lastHeatmap image.Image
+	checkpoint  *Checkpoint
+	// meteredScale, when positive, is used by Resolve instead of
+	// metering the frame, so both eyes of a stereo pair match
+	meteredScale float64
 }
 
 func NewRenderer(scene *Scene, camera *Camera) Renderer {
-	return Renderer{scene, camera, atomic.Bool{}, atomic.Bool{}}
+	return NewRendererOpts(scene, camera, DefaultRenderOpts())
 }
 
-func (r *Renderer) IsDone() bool {
-	return r.isDone.Load()
-}
-
-func (r *Renderer) SetDone(val bool) {
-	r.isDone.Store(val)
+func NewRendererOpts(scene *Scene, camera *Camera, opts RenderOpts) Renderer {
+	return Renderer{scene: scene, camera: camera, opts: opts}
 }
 
 func (r *Renderer) GetCamera() *Camera {
@@ -73,7 +91,7 @@ func CalculateLighting(marchRslt MarchResult, renderer *Renderer) color.RGBA {
 			surfaceNormal := SurfaceNormal(marchRslt, false)
 			bounceDeg := vec3.Angle(lightDir, surfaceNormal)
 			if bounceDeg < 90 {
-				ray := Ray{hitPoint, lightDir}
+				ray := secondaryRay(marchRslt, surfaceNormal, lightDir, renderer)
 				rslt := RayMarch(ray, renderer, true)
 				if drawables.Equals(rslt.HitObject, lSource) {
 					brightness := float64(rslt.HitObject.Color().A) / 255
@@ -95,8 +113,37 @@ func CalculateLighting(marchRslt MarchResult, renderer *Renderer) color.RGBA {
 	return pxColorVal
 }
 
-func CalculateLighting2(marchRslt MarchResult, screenPos Point, renderer *Renderer) color.RGBA {
-	pxColorVal := renderer.scene.options.bg.color
+func CalculateLighting2(marchRslt MarchResult, renderer *Renderer) color.RGBA {
+	pxColorVec := CalculateRadiance2(marchRslt, renderer)
+	pxColorVec.ClampSet(0, 1)
+	return vec3.Vec3ToRGBA(pxColorVec, renderer.scene.options.bg.color.A)
+}
+
+// CalculateRadiance2 shades a march result like CalculateLighting2, but returns
+// the linear radiance without clamping it to the displayable range
+func CalculateRadiance2(marchRslt MarchResult, renderer *Renderer) vec3.Vec3 {
+	radiance, _ := calculateRadiance2(marchRslt, renderer)
+	return radiance
+}
+
+// lightVisibility counts the lights facing a surface point
+// and how many of those actually reach it
+type lightVisibility struct {
+	facing int
+	lit    int
+}
+
+// shadow returns the fraction of facing lights that are blocked,
+// or 1 if no light faces the point at all
+func (lv lightVisibility) shadow() float64 {
+	if lv.facing == 0 {
+		return 1
+	}
+	return 1 - float64(lv.lit)/float64(lv.facing)
+}
+
+func calculateRadiance2(marchRslt MarchResult, renderer *Renderer) (vec3.Vec3, lightVisibility) {
+	visibility := lightVisibility{}
 	pxColorVec := vec3.RGBAToVec3(renderer.scene.options.bg.color)
 	if marchRslt.HitObject != nil {
 		pxColorVec = vec3.RGBAToVec3(marchRslt.HitObject.Color())
@@ -108,9 +155,11 @@ func CalculateLighting2(marchRslt MarchResult, screenPos Point, renderer *Render
 				surfaceNormal := SurfaceNormal(marchRslt, renderer.scene.options.trace.fastMath)
 				bounceDeg := vec3.Angle(lightDir, surfaceNormal)
 				if bounceDeg < 90 {
-					ray := Ray{hitPoint, lightDir}
+					visibility.facing++
+					ray := secondaryRay(marchRslt, surfaceNormal, lightDir, renderer)
 					rslt := RayMarch(ray, renderer, true)
 					if drawables.Equals(rslt.HitObject, lSource) {
+						visibility.lit++
 						brightness := float64(rslt.HitObject.Color().A) / 255
 						brightness = brightness * (90 - bounceDeg) / 90
 						lightColorVec := vec3.RGBAToVec3(lSource.Color()).Mult(brightness)
@@ -119,7 +168,7 @@ func CalculateLighting2(marchRslt MarchResult, screenPos Point, renderer *Render
 				}
 			}
 
-			pxColorVec = vec3.Min(pxColorVec.MultComp(colorVec), vec3.OfSize(1))
+			pxColorVec = pxColorVec.MultComp(colorVec)
 		}
 		if renderer.scene.options.ao.enabled {
 			var ao float64
@@ -149,21 +198,27 @@ func CalculateLighting2(marchRslt MarchResult, screenPos Point, renderer *Render
 
 	}
 
-	if renderer.scene.options.vignette.enabled {
-		maxVignettNorm := utils.NewVec2(float64(renderer.camera.SizeX), float64(renderer.camera.SizeY)).Norm() * math.Min(1, (1-math.Min(1, renderer.scene.options.vignette.strength)))
-		vignettAmt := 1 - (utils.NewVec2(float64(screenPos.X-renderer.camera.centerOffset.X), float64(screenPos.Y-renderer.camera.centerOffset.Y)).Norm() / maxVignettNorm)
-		pxColorVec = pxColorVec.Mult(vignettAmt)
-	}
+	return pxColorVec, visibility
+}
 
-	pxColorVal = vec3.Vec3ToRGBA(pxColorVec, pxColorVal.A)
-	return pxColorVal
+func CalculateLightingTest(marchRslt MarchResult, renderer *Renderer) color.RGBA {
+	pxColorVec := CalculateRadianceTest(marchRslt, renderer)
+	pxColorVec.ClampSet(0, 1)
+	return vec3.Vec3ToRGBA(pxColorVec, renderer.scene.options.bg.color.A)
+}
+
+// CalculateRadianceTest shades a march result like CalculateLightingTest, but returns
+// the linear radiance without clamping it to the displayable range
+func CalculateRadianceTest(marchRslt MarchResult, renderer *Renderer) vec3.Vec3 {
+	radiance, _ := calculateRadianceTest(marchRslt, renderer)
+	return radiance
 }
 
-func CalculateLightingTest(marchRslt MarchResult, screenPos Point, renderer *Renderer) color.RGBA {
-	pxColorVal := renderer.scene.options.bg.color
+func calculateRadianceTest(marchRslt MarchResult, renderer *Renderer) (vec3.Vec3, lightVisibility) {
+	visibility := lightVisibility{}
 	opts := renderer.scene.options
 	if (opts.ao.enabled && marchRslt.Steps >= int(opts.ao.maxSteps)) || (opts.dropoff.enabled && marchRslt.Distance >= opts.dropoff.distance) {
-		return pxColorVal
+		return vec3.RGBAToVec3(opts.bg.color), visibility
 	}
 	pxColorVec := vec3.RGBAToVec3P(opts.bg.color)
 	if marchRslt.HitObject != nil {
@@ -175,9 +230,11 @@ func CalculateLightingTest(marchRslt MarchResult, screenPos Point, renderer *Ren
 				surfaceNormal := SurfaceNormal(marchRslt, opts.trace.fastMath)
 				brightness := vec3.Dot(surfaceNormal, lightDir)
 				if brightness > 0 {
-					ray := Ray{marchRslt.HitPos, lightDir}
+					visibility.facing++
+					ray := secondaryRay(marchRslt, surfaceNormal, lightDir, renderer)
 					rslt := RayMarchP(ray, renderer, true)
 					if drawables.Equals(rslt.HitObject, lSource) {
+						visibility.lit++
 						lightColorVec := vec3.NewCp(lSource.ColorVec())
 						lightColorVec.MultSet(brightness)
 						colorVec.AddSet(lightColorVec)
@@ -186,7 +243,6 @@ func CalculateLightingTest(marchRslt MarchResult, screenPos Point, renderer *Ren
 			}
 
 			pxColorVec.MultCompSet(colorVec)
-			pxColorVec.MinSet(vec3.NewOfSizeP(1))
 		}
 
 		if opts.ao.enabled {
@@ -212,220 +268,7 @@ func CalculateLightingTest(marchRslt MarchResult, screenPos Point, renderer *Ren
 		pxColorVec.AddSet(blendColor)
 	}
 
-	if opts.vignette.enabled {
-		maxVignettNorm := renderer.camera.Dim().Norm() * math.Min(1, (1-math.Min(1, opts.vignette.strength)))
-		vignettAmt := 1 - (utils.NewVec2(screenPos.X-renderer.camera.centerOffset.X, screenPos.Y-renderer.camera.centerOffset.Y).Norm() / maxVignettNorm)
-		pxColorVec.MultSet(vignettAmt)
-	}
-
-	pxColorVal = vec3.Vec3ToRGBA(*pxColorVec, pxColorVal.A)
-	return pxColorVal
-}
-
-func RayMarchWorkerLighting(id int, workers int, renderer *Renderer, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	for i := id; i <= renderer.camera.SizeX; i += workers {
-		for j := 0; j <= renderer.camera.SizeY; j++ {
-			pt := Point{i, j}
-			ray := renderer.camera.RayForPixel(pt)
-			marchRslt := RayMarch(ray, renderer, true)
-			pxColorVal := CalculateLighting(marchRslt, renderer)
-			renderer.camera.Image.Set(pt.X, pt.Y, pxColorVal)
-		}
-	}
-}
-
-func RayMarchWorkerLighting2(id int, workers int, renderer *Renderer, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	for i := 0; i <= renderer.camera.SizeX; i++ {
-		for j := id; j <= renderer.camera.SizeY; j += workers {
-			j2 := (j + i) % renderer.camera.SizeY
-			pt := Point{i, j2}
-			ray := renderer.camera.RayForPixel(pt)
-			marchRslt := RayMarch(ray, renderer, true)
-			pxColorVal := CalculateLighting(marchRslt, renderer)
-			renderer.camera.Image.Set(pt.X, pt.Y, pxColorVal)
-		}
-	}
-}
-
-func RayMarchWorkerLighting3(id int, workers int, renderer *Renderer, pb *pb.ProgressBar, wg *sync.WaitGroup) {
-	defer wg.Done()
-	points := make([]Point, renderer.camera.Size()/int64(workers))
-	count := 0
-	for i := int64(id); i < renderer.camera.Size(); i += int64(workers) {
-		y := (i) % int64(renderer.camera.SizeY)
-		x := i / int64(renderer.camera.SizeY)
-		pt := Point{int(x), int(y)}
-		points[count] = pt
-		count++
-	}
-
-	rand.Shuffle(len(points), func(i, j int) { points[i], points[j] = points[j], points[i] })
-	for _, pt := range points {
-		if renderer.Reset.Load() {
-			return
-		}
-		ray := renderer.camera.RayForPixel(pt)
-		marchRslt := RayMarch(ray, renderer, false)
-		pxColorVal := CalculateLighting2(marchRslt, pt, renderer)
-		renderer.camera.Image.Set(pt.X, pt.Y, pxColorVal)
-		pb.Add(1)
-	}
-}
-
-var (
-	rmwRangeMap = make(map[int][]int)
-	rngMtx      sync.RWMutex
-)
-
-func setRangePerm(id int, val []int) {
-	rngMtx.Lock()
-	rmwRangeMap[id] = val
-	rngMtx.Unlock()
-}
-
-func getRangePerm(id int) (val []int, ok bool) {
-	rngMtx.RLock()
-	val, ok = rmwRangeMap[id]
-	rngMtx.RUnlock()
-	return
-}
-
-func RayMarchWorkerLighting6(id int, workers int, renderer *Renderer, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	perm, ok := getRangePerm(id)
-	if !ok {
-		rangeSize := int(renderer.camera.Size() / int64(workers))
-		perm = rand.Perm(rangeSize)
-		setRangePerm(id, perm)
-	}
-
-	for _, value := range perm {
-		if renderer.Reset.Load() {
-			return
-		}
-		i := int64(value)*int64(workers) + int64(id)
-		y := (i) % int64(renderer.camera.SizeY)
-		x := i / int64(renderer.camera.SizeY)
-		pt := Point{int(x), int(y)}
-		ray := renderer.camera.RayForPixel(pt)
-		// marchRslt := RayMarch(ray, renderer, false)
-		// pxColorVal := CalculateLighting2(marchRslt, pt, renderer)
-		//  CalculateLighting2(marchRslt, pt, renderer)
-
-		marchRslt := RayMarchP(ray, renderer, false)
-		pxColorVal := CalculateLightingTest(marchRslt, pt, renderer)
-		// CalculateLightingTest(marchRslt, pt, renderer)
-		renderer.camera.Image.Set(pt.X, pt.Y, pxColorVal)
-	}
-}
-
-func RayMarchWorkerLightingStatic(id int, workers int, renderer *Renderer, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	rangeSize := renderer.camera.Size() / int64(workers)
-
-	for value := 0; value < int(rangeSize); value++ {
-		if renderer.Reset.Load() {
-			return
-		}
-		i := int64(value)*int64(workers) + int64(id)
-		y := (i) % int64(renderer.camera.SizeY)
-		x := i / int64(renderer.camera.SizeY)
-		pt := Point{int(x), int(y)}
-		ray := renderer.camera.RayForPixel(pt)
-		marchRslt := RayMarch(ray, renderer, false)
-		pxColorVal := CalculateLighting2(marchRslt, pt, renderer)
-		//  CalculateLighting2(marchRslt, pt, renderer)
-
-		// marchRslt := RayMarchP(ray, renderer, false)
-		// pxColorVal := CalculateLightingTest(marchRslt, pt, renderer)
-		// CalculateLightingTest(marchRslt, pt, renderer)
-		renderer.camera.Image.Set(pt.X, pt.Y, pxColorVal)
-	}
-}
-
-func RenderOut(renderer *Renderer, workers int) {
-	Render(renderer, workers)
-	renderer.camera.FlushToDisk()
-}
-
-func Render(renderer *Renderer, workers int) {
-	wg := new(sync.WaitGroup)
-	pb := pb.NewOptions64(renderer.camera.Size(),
-		pb.OptionSetDescription("Rendering Image..."),
-		pb.OptionThrottle(65*time.Millisecond),
-		pb.OptionShowIts(),
-		pb.OptionSetItsString("px"),
-		pb.OptionSpinnerType(14),
-		pb.OptionFullWidth(),
-		pb.OptionSetRenderBlankState(true),
-		pb.OptionSetPredictTime(true),
-		pb.OptionShowElapsedTimeOnFinish(),
-		pb.OptionUseANSICodes(true),
-	)
-
-	for i := range workers {
-		wg.Add(1)
-		go RayMarchWorkerLighting3(i, workers, renderer, pb, wg)
-	}
-
-	log.Info().Msg("Finished loading jobs, closing jobs & waiting for workers")
-	wg.Wait()
-	// time.Sleep(time.Second)
-	renderer.isDone.Store(true)
-	renderer.Reset.Store(false)
-}
-
-// TODO: Rename render functions to be more clear
-func (renderer *Renderer) Render2(workers int, wg *sync.WaitGroup) {
-	renderer.isDone.Store(false)
-	// startTime := time.Now()
-
-	wg.Add(1)
-	defer wg.Done()
-
-	var wg2 sync.WaitGroup
-
-	for i := range workers {
-		wg2.Add(1)
-		go RayMarchWorkerLighting6(i, workers, renderer, &wg2)
-	}
-
-	// log.Info().Msg("Finished loading jobs, closing jobs & waiting for workers")
-	wg2.Wait()
-
-	renderer.Reset.Store(false)
-	renderer.isDone.Store(true)
-	// renderDuration := time.Since(startTime)
-	// fmt.Printf("Rendered frame in %s\n", renderDuration.String())
-}
-
-func (renderer *Renderer) RenderStatic(workers int, wg *sync.WaitGroup) {
-	// renderer.isDone.Store(false)
-	// startTime := time.Now()
-
-	wg.Add(1)
-	defer wg.Done()
-
-	var wg2 sync.WaitGroup
-
-	for i := range workers {
-		wg2.Add(1)
-		go RayMarchWorkerLightingStatic(i, workers, renderer, &wg2)
-	}
-
-	// log.Info().Msg("Finished loading jobs, closing jobs & waiting for workers")
-	wg2.Wait()
-
-	// renderer.Reset.Store(false)
-	// renderer.isDone.Store(true)
-	// renderDuration := time.Since(startTime)
-	// fmt.Printf("Rendered frame in %s\n", renderDuration.String())
+	return *pxColorVec, visibility
 }
 
 func NewDefaultRenderScene(opts RenderOpts) *Renderer {
@@ -489,34 +332,71 @@ func NewDefaultRenderScene(opts RenderOpts) *Renderer {
 
 	cam.up = vec3.UnitZ
 	cam.Dir = vec3.UnitX
+	cam.SetLens(opts.Lens)
+	cam.SetProjection(opts.Projection)
+	cam.SetShutter(opts.Motion.Shutter)
 
-	renderer := Renderer{
-		scene,
-		cam,
-		atomic.Bool{},
-		atomic.Bool{},
+	renderer := NewRendererOpts(scene, cam, opts)
+	if opts.Lens.AutoFocus {
+		renderer.AutoFocus()
 	}
 	return &renderer
 }
 
 type RenderOpts struct {
-	Workers int
-	OutPath string
-	DimX    int
-	DimY    int
-	Fov     float64
+	Workers     int
+	OutPath     string
+	DimX        int
+	DimY        int
+	Fov         float64
+	AA          AntiAliasOpts
+	Lens        LensOpts
+	Projection  ProjectionOpts
+	Stereo      StereoOpts
+	Motion      MotionOpts
+	ToneMap     ToneMapOpts
+	Post        postfx.Chain
+	AOVs        []AOV
+	Denoise     DenoiseOpts
+	Tiles       TileOpts
+	Shading     ShadingModel
+	Progressive ProgressiveOpts
+	Temporal    TemporalOpts
+	Stats       StatsOpts
+	Crop        CropOpts
+	// Seed selects the random numbers used for sampling. Renders with
+	// the same seed and scene are identical whatever the worker count.
+	Seed uint64
 }
 
 func DefaultRenderOpts() RenderOpts {
 	return RenderOpts{
-		Workers: 1,
-		OutPath: "./rend_out_0",
-		DimX:    1920,
-		DimY:    1080,
-		Fov:     20,
+		Workers:     1,
+		OutPath:     "./rend_out_0",
+		DimX:        1920,
+		DimY:        1080,
+		Fov:         20,
+		AA:          DefaultAntiAliasOpts(),
+		Lens:        DefaultLensOpts(),
+		Projection:  DefaultProjectionOpts(),
+		Stereo:      DefaultStereoOpts(),
+		Motion:      DefaultMotionOpts(),
+		ToneMap:     DefaultToneMapOpts(),
+		Denoise:     DefaultDenoiseOpts(),
+		Tiles:       DefaultTileOpts(),
+		Progressive: DefaultProgressiveOpts(),
+		Temporal:    DefaultTemporalOpts(),
+		Stats:       DefaultStatsOpts(),
+		Crop:        DefaultCropOpts(),
 	}
 }
 
+// recordsSurface reports whether samples need their surface
+// information, either for AOV passes or to guide the denoiser
+func (opts RenderOpts) recordsSurface() bool {
+	return len(opts.AOVs) > 0 || opts.Denoise.Enabled
+}
+
 func (opts RenderOpts) String() string {
-	return fmt.Sprintf("Threads: %d, OutPath: %s, Dim: %dx%d, Fov: %0.2f", opts.Workers, opts.OutPath, opts.DimX, opts.DimY, opts.Fov)
+	return fmt.Sprintf("Threads: %d, OutPath: %s, Dim: %dx%d, Fov: %0.2f, %s, %s, %s, %s, %s, %s, %s, aovs: %v, %s, %s, shading: %s, %s, %s, %s, %s, seed: %d", opts.Workers, opts.OutPath, opts.DimX, opts.DimY, opts.Fov, opts.AA, opts.Lens, opts.Projection, opts.Stereo, opts.Motion, opts.ToneMap, opts.Post, opts.AOVs, opts.Denoise, opts.Tiles, opts.Shading, opts.Progressive, opts.Temporal, opts.Stats, opts.Crop, opts.Seed)
 }
@@ -0,0 +1,53 @@
+package renderer
+
+// RNG is a counter-based random number stream. Every number is a hash
+// of the stream's key and its position in the stream, so the numbers
+// drawn for a pixel don't depend on which worker renders it, or when.
+type RNG struct {
+	key     uint64
+	counter uint64
+}
+
+// The streams of random numbers drawn for a pixel. Each pass that
+// samples a pixel draws from its own stream.
+const (
+	streamPrimary uint64 = iota + 1
+	streamRefine
+	streamPreview
+)
+
+// NewRNG returns the stream of random numbers for the given key
+func NewRNG(key uint64) *RNG {
+	return &RNG{key: mix64(key)}
+}
+
+// pixelRNG returns the stream of random numbers a pass draws from
+// for the pixel at pt, derived from the seed of the render
+func (r *Renderer) pixelRNG(pt Point, stream uint64) *RNG {
+	// band cameras number pixels from the start of their band
+	x, y := pt.X+r.camera.offset.X, pt.Y+r.camera.offset.Y
+	key := mix64(r.opts.Seed) ^ mix64(uint64(uint32(x))<<32|uint64(uint32(y))) ^ mix64(stream<<56)
+	return NewRNG(key)
+}
+
+// Uint64 returns the next number of the stream
+func (g *RNG) Uint64() uint64 {
+	g.counter++
+	return mix64(g.key + g.counter*0x9e3779b97f4a7c15)
+}
+
+// Float64 returns the next number of the stream in [0, 1)
+func (g *RNG) Float64() float64 {
+	return float64(g.Uint64()>>11) / (1 << 53)
+}
+
+// mix64 is the finalizer of SplitMix64, which spreads every
+// input bit over the whole output
+func mix64(z uint64) uint64 {
+	z ^= z >> 30
+	z *= 0xbf58476d1ce4e5b9
+	z ^= z >> 27
+	z *= 0x94d049bb133111eb
+	z ^= z >> 31
+	return z
+}
@@ -0,0 +1,74 @@
+package renderer
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"slices"
+	"testing"
+
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+)
+
+func renderSeeded(t *testing.T, workers int, seed uint64) *image.RGBA {
+	t.Helper()
+	opts := testOpts()
+	opts.Workers = workers
+	opts.Seed = seed
+	opts.AA.Mode = AAJitter
+	opts.AA.Samples = 2
+	r := newTestRenderer(opts)
+	r.camera.SetLens(LensOpts{Aperture: 0.2, FocusDist: 3})
+	img, err := r.Render(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img.(*image.RGBA)
+}
+
+func TestRenderDeterministic(t *testing.T) {
+	want := renderSeeded(t, 1, 7)
+	for _, workers := range []int{2, 5} {
+		if got := renderSeeded(t, workers, 7); !bytes.Equal(got.Pix, want.Pix) {
+			t.Errorf("render with %d workers differs from a single worker", workers)
+		}
+	}
+	if other := renderSeeded(t, 2, 8); bytes.Equal(other.Pix, want.Pix) {
+		t.Error("renders with different seeds are identical")
+	}
+}
+
+func TestRNGStreams(t *testing.T) {
+	a, b := NewRNG(1), NewRNG(1)
+	for range 10 {
+		if a.Uint64() != b.Uint64() {
+			t.Fatal("streams with the same key differ")
+		}
+	}
+	if NewRNG(1).Uint64() == NewRNG(2).Uint64() {
+		t.Error("streams with different keys start the same")
+	}
+	g := NewRNG(3)
+	for range 1000 {
+		if f := g.Float64(); f < 0 || f >= 1 {
+			t.Fatalf("Float64 out of range: %f", f)
+		}
+	}
+}
+
+func TestObjectIDsIndependentOfOtherScenes(t *testing.T) {
+	opts := testOpts()
+	opts.AOVs = []AOV{AOVObjectID}
+	var passes []*framebuffer.Buffer
+	for range 2 {
+		// every scene built creates new drawables with new drawable IDs
+		r := newTestRenderer(opts)
+		if _, err := r.Render(context.Background(), opts); err != nil {
+			t.Fatal(err)
+		}
+		passes = append(passes, r.camera.AOVs[AOVObjectID])
+	}
+	if !slices.Equal(passes[0].Pix, passes[1].Pix) {
+		t.Error("Expected the same scene to render the same object ID pass")
+	}
+}
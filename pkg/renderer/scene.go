@@ -1,19 +1,56 @@
 package renderer
 
-import "github.com/Solidsilver/go-ray-march/pkg/drawables"
+import (
+	"slices"
+
+	"github.com/Solidsilver/go-ray-march/pkg/drawables"
+)
 
 type Scene struct {
 	Drawables []drawables.Drawable
 	Lights    []drawables.Drawable
 	options   LightingOpts
+	animator  SceneAnimator
+	// objectIDs maps the IDs of the drawables and lights to their
+	// object IDs in the scene
+	objectIDs map[int64]int64
 }
 
 func (s *Scene) AddDrawables(draws ...drawables.Drawable) {
 	s.Drawables = append(s.Drawables, draws...)
+	s.indexObjects()
 }
 
 func (s *Scene) AddLights(draws ...drawables.Drawable) {
 	s.Lights = append(s.Lights, draws...)
+	s.indexObjects()
+}
+
+// indexObjects numbers the drawables and then the lights of the scene
+func (s *Scene) indexObjects() {
+	all := slices.Concat(s.Drawables, s.Lights)
+	s.objectIDs = make(map[int64]int64, len(all))
+	for i, d := range all {
+		s.objectIDs[d.ID()] = int64(i) + 1
+	}
+}
+
+// ObjectID returns the ID of a drawable within the scene, which numbers
+// the drawables and then the lights from 1. Unlike drawable IDs it only
+// depends on the scene, so the same scene always gets the same object
+// IDs however many others were built before it. It returns 0 for
+// drawables that aren't part of the scene.
+func (s *Scene) ObjectID(d drawables.Drawable) int64 {
+	if id, ok := s.objectIDs[d.ID()]; ok {
+		return id
+	}
+	// drawables replaced in place since the scene was indexed
+	for i, other := range slices.Concat(s.Drawables, s.Lights) {
+		if drawables.Equals(d, other) {
+			return int64(i) + 1
+		}
+	}
+	return 0
 }
 
 func NewBlankScene() *Scene {
@@ -29,5 +66,6 @@ func NewSceneWithOpts(opts LightingOpts, draws []drawables.Drawable, lights []dr
 	scn.Drawables = draws
 	scn.Lights = lights
 	scn.options = opts
+	scn.indexObjects()
 	return scn
 }
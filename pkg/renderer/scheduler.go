@@ -0,0 +1,256 @@
+package renderer
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// TileOrder is the order tiles are handed out to workers
+type TileOrder int
+
+const (
+	// TileScanline renders tiles left to right, top to bottom
+	TileScanline TileOrder = iota
+	// TileSpiral renders tiles in rings spiraling out from the center
+	TileSpiral
+	// TileHilbert follows a Hilbert curve, which keeps neighboring
+	// tiles close together in time
+	TileHilbert
+)
+
+var tileOrderNames = map[TileOrder]string{
+	TileScanline: "scanline",
+	TileSpiral:   "spiral",
+	TileHilbert:  "hilbert",
+}
+
+func (o TileOrder) String() string {
+	if name, ok := tileOrderNames[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("TileOrder(%d)", int(o))
+}
+
+// ParseTileOrder converts an order name (scanline, spiral, hilbert)
+// into a TileOrder
+func ParseTileOrder(name string) (TileOrder, error) {
+	for order, orderName := range tileOrderNames {
+		if strings.EqualFold(name, orderName) {
+			return order, nil
+		}
+	}
+	return TileScanline, fmt.Errorf("unknown tile order: %q", name)
+}
+
+type TileOpts struct {
+	// Size is the width and height of a tile in pixels
+	Size  int
+	Order TileOrder
+}
+
+func DefaultTileOpts() TileOpts {
+	return TileOpts{
+		Size:  32,
+		Order: TileSpiral,
+	}
+}
+
+func (to TileOpts) String() string {
+	return fmt.Sprintf("tiles: {size: %d, order: %s}", to.Size, to.Order)
+}
+
+// MakeTiles splits a width x height frame into tiles of the given
+// size and returns them in the requested order. Tiles on the right
+// and bottom edges are cropped to the frame.
+func MakeTiles(width, height int, opts TileOpts) []image.Rectangle {
+	size := max(opts.Size, 1)
+	cols := (width + size - 1) / size
+	rows := (height + size - 1) / size
+
+	type cell struct{ col, row int }
+	cells := make([]cell, 0, cols*rows)
+	for row := range rows {
+		for col := range cols {
+			cells = append(cells, cell{col, row})
+		}
+	}
+
+	switch opts.Order {
+	case TileSpiral:
+		cx, cy := float64(cols-1)/2, float64(rows-1)/2
+		ring := func(c cell) float64 {
+			return math.Max(math.Abs(float64(c.col)-cx), math.Abs(float64(c.row)-cy))
+		}
+		angle := func(c cell) float64 {
+			return math.Atan2(float64(c.row)-cy, float64(c.col)-cx)
+		}
+		slices.SortStableFunc(cells, func(a, b cell) int {
+			if ra, rb := ring(a), ring(b); ra != rb {
+				return cmpFloat(ra, rb)
+			}
+			return cmpFloat(angle(a), angle(b))
+		})
+	case TileHilbert:
+		n := 1
+		for n < max(cols, rows) {
+			n *= 2
+		}
+		slices.SortStableFunc(cells, func(a, b cell) int {
+			return hilbertIndex(n, a.col, a.row) - hilbertIndex(n, b.col, b.row)
+		})
+	}
+
+	tiles := make([]image.Rectangle, len(cells))
+	for i, c := range cells {
+		tiles[i] = image.Rect(c.col*size, c.row*size, min((c.col+1)*size, width), min((c.row+1)*size, height))
+	}
+	return tiles
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// hilbertIndex returns the distance of (x, y) along a
+// Hilbert curve filling an n x n grid, n a power of two
+func hilbertIndex(n, x, y int) int {
+	d := 0
+	for s := n / 2; s > 0; s /= 2 {
+		rx, ry := 0, 0
+		if x&s > 0 {
+			rx = 1
+		}
+		if y&s > 0 {
+			ry = 1
+		}
+		d += s * s * ((3 * rx) ^ ry)
+		if ry == 0 {
+			if rx == 1 {
+				x = s - 1 - x
+				y = s - 1 - y
+			}
+			x, y = y, x
+		}
+	}
+	return d
+}
+
+// tileDeque is the queue of tiles owned by one worker. The owner
+// takes tiles from the front, idle workers steal from the back.
+type tileDeque struct {
+	mtx   sync.Mutex
+	tiles []image.Rectangle
+}
+
+func (q *tileDeque) popFront() (image.Rectangle, bool) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if len(q.tiles) == 0 {
+		return image.Rectangle{}, false
+	}
+	tile := q.tiles[0]
+	q.tiles = q.tiles[1:]
+	return tile, true
+}
+
+func (q *tileDeque) popBack() (image.Rectangle, bool) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if len(q.tiles) == 0 {
+		return image.Rectangle{}, false
+	}
+	tile := q.tiles[len(q.tiles)-1]
+	q.tiles = q.tiles[:len(q.tiles)-1]
+	return tile, true
+}
+
+// tileScheduler deals the tiles of a frame out to the workers
+// round robin, so every worker starts on the most important tiles,
+// and lets workers that run out steal from the others
+type tileScheduler struct {
+	queues []*tileDeque
+}
+
+func newTileScheduler(tiles []image.Rectangle, workers int) *tileScheduler {
+	s := &tileScheduler{queues: make([]*tileDeque, max(workers, 1))}
+	for i := range s.queues {
+		s.queues[i] = &tileDeque{}
+	}
+	for i, tile := range tiles {
+		q := s.queues[i%len(s.queues)]
+		q.tiles = append(q.tiles, tile)
+	}
+	return s
+}
+
+// next returns the next tile for the given worker,
+// or false once every queue is empty
+func (s *tileScheduler) next(id int) (image.Rectangle, bool) {
+	if tile, ok := s.queues[id].popFront(); ok {
+		return tile, true
+	}
+	for i := 1; i < len(s.queues); i++ {
+		victim := s.queues[(id+i)%len(s.queues)]
+		if tile, ok := victim.popBack(); ok {
+			return tile, true
+		}
+	}
+	return image.Rectangle{}, false
+}
+
+// runTiles splits the frame into tiles shared by workers goroutines and
+// calls renderTile for each of them. onTile, if not nil, is called with
+// every finished tile. No new tiles are started once ctx is cancelled.
+func (r *Renderer) runTiles(ctx context.Context, workers int, renderTile func(tile image.Rectangle), onTile func(tile image.Rectangle)) {
+	workers = max(workers, 1)
+	tiles := r.windowTiles(MakeTiles(r.camera.SizeX, r.camera.SizeY, r.opts.Tiles))
+	if r.checkpoint != nil {
+		tiles = slices.DeleteFunc(tiles, r.checkpoint.isRestored)
+	}
+	sched := newTileScheduler(tiles, workers)
+
+	var wg sync.WaitGroup
+	for id := range workers {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for {
+				tile, ok := sched.next(id)
+				if !ok || ctx.Err() != nil {
+					return
+				}
+				renderTile(tile)
+				if onTile != nil && ctx.Err() == nil {
+					onTile(tile)
+				}
+			}
+		}(id)
+	}
+	wg.Wait()
+}
+
+// renderTiles renders every pixel of the frame with the given shader.
+// Workers stop between rows once ctx is cancelled.
+func (r *Renderer) renderTiles(ctx context.Context, workers int, shade pixelShader, onTile func(tile image.Rectangle)) {
+	r.runTiles(ctx, workers, func(tile image.Rectangle) {
+		for y := tile.Min.Y; y < tile.Max.Y; y++ {
+			if ctx.Err() != nil {
+				return
+			}
+			for x := tile.Min.X; x < tile.Max.X; x++ {
+				r.renderPixel(Point{x, y}, shade)
+			}
+		}
+	}, onTile)
+}
@@ -0,0 +1,64 @@
+package renderer
+
+import (
+	"image"
+	"testing"
+)
+
+func TestMakeTilesCoversFrame(t *testing.T) {
+	for order := range tileOrderNames {
+		tiles := MakeTiles(100, 70, TileOpts{Size: 16, Order: order})
+		covered := make([]int, 100*70)
+		for _, tile := range tiles {
+			for y := tile.Min.Y; y < tile.Max.Y; y++ {
+				for x := tile.Min.X; x < tile.Max.X; x++ {
+					covered[y*100+x]++
+				}
+			}
+		}
+		for i, n := range covered {
+			if n != 1 {
+				t.Fatalf("%s: expected pixel %d to be covered once. Got %d", order, i, n)
+			}
+		}
+	}
+}
+
+func TestMakeTilesSpiralStartsInCenter(t *testing.T) {
+	tiles := MakeTiles(90, 90, TileOpts{Size: 30, Order: TileSpiral})
+	if want := image.Rect(30, 30, 60, 60); tiles[0] != want {
+		t.Errorf("Expected first tile %v. Got %v", want, tiles[0])
+	}
+}
+
+func TestMakeTilesHilbertIsContinuous(t *testing.T) {
+	tiles := MakeTiles(128, 128, TileOpts{Size: 16, Order: TileHilbert})
+	for i := 1; i < len(tiles); i++ {
+		d := tiles[i].Min.Sub(tiles[i-1].Min)
+		if abs(d.X)+abs(d.Y) != 16 {
+			t.Fatalf("Expected tile %d to be next to the one before it. Got %v after %v", i, tiles[i], tiles[i-1])
+		}
+	}
+}
+
+func TestTileSchedulerSteals(t *testing.T) {
+	tiles := MakeTiles(64, 64, TileOpts{Size: 16, Order: TileScanline})
+	sched := newTileScheduler(tiles, 4)
+	count := 0
+	for {
+		if _, ok := sched.next(0); !ok {
+			break
+		}
+		count++
+	}
+	if count != len(tiles) {
+		t.Errorf("Expected a single worker to take all %d tiles. Got %d", len(tiles), count)
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,316 @@
+package renderer
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Solidsilver/go-ray-march/pkg/drawables"
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+// HeatmapMode selects what the diagnostic heatmap shows
+type HeatmapMode int
+
+const (
+	HeatmapNone HeatmapMode = iota
+	// HeatmapSteps shows the march steps of each pixel's primary rays
+	HeatmapSteps
+	// HeatmapCost shows the time spent rendering each pixel
+	HeatmapCost
+)
+
+var heatmapModeNames = map[HeatmapMode]string{
+	HeatmapNone:  "none",
+	HeatmapSteps: "steps",
+	HeatmapCost:  "cost",
+}
+
+func (m HeatmapMode) String() string {
+	if name, ok := heatmapModeNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("HeatmapMode(%d)", int(m))
+}
+
+// ParseHeatmapMode converts a mode name (none, steps, cost)
+// into a HeatmapMode
+func ParseHeatmapMode(name string) (HeatmapMode, error) {
+	for mode, modeName := range heatmapModeNames {
+		if strings.EqualFold(name, modeName) {
+			return mode, nil
+		}
+	}
+	return HeatmapNone, fmt.Errorf("unknown heatmap mode: %q", name)
+}
+
+type StatsOpts struct {
+	// Enabled collects ray counts, march steps and drawable timings.
+	// Timing every distance evaluation slows rendering down noticeably.
+	Enabled bool
+	Heatmap HeatmapMode
+}
+
+func DefaultStatsOpts() StatsOpts {
+	return StatsOpts{
+		Enabled: false,
+		Heatmap: HeatmapNone,
+	}
+}
+
+func (so StatsOpts) String() string {
+	return fmt.Sprintf("stats: {enabled: %t, heatmap: %s}", so.Enabled, so.Heatmap)
+}
+
+// DrawableStats is the time spent evaluating the distance to a drawable
+type DrawableStats struct {
+	Name        string  `json:"name"`
+	Evaluations int64   `json:"evaluations"`
+	Seconds     float64 `json:"seconds"`
+}
+
+// RenderStats summarizes the work done for a single render
+type RenderStats struct {
+	Seconds       float64 `json:"seconds"`
+	Pixels        int64   `json:"pixels"`
+	PrimaryRays   int64   `json:"primary_rays"`
+	ShadowRays    int64   `json:"shadow_rays"`
+	RaysPerSecond float64 `json:"rays_per_second"`
+	MeanSteps     float64 `json:"mean_steps"`
+	MaxSteps      int64   `json:"max_steps"`
+	// MaxStepShare is the fraction of rays that gave up after
+	// taking the maximum number of steps
+	MaxStepShare float64 `json:"max_step_share"`
+	// ReusedPixels and SeededPixels count the pixels temporal
+	// reprojection copied from the last frame and started
+	// marching near the reprojected surface
+	ReusedPixels int64           `json:"reused_pixels"`
+	SeededPixels int64           `json:"seeded_pixels"`
+	Drawables    []DrawableStats `json:"drawables"`
+}
+
+func (rs RenderStats) String() string {
+	sb := strings.Builder{}
+	fmt.Fprintf(&sb, "Rendered %d pixels in %0.3fs\n", rs.Pixels, rs.Seconds)
+	fmt.Fprintf(&sb, "Rays: %d primary, %d shadow, %0.0f per second\n", rs.PrimaryRays, rs.ShadowRays, rs.RaysPerSecond)
+	fmt.Fprintf(&sb, "Steps: %0.2f mean, %d max, %0.2f%% of rays ran out of steps\n", rs.MeanSteps, rs.MaxSteps, rs.MaxStepShare*100)
+	if rs.ReusedPixels > 0 || rs.SeededPixels > 0 {
+		fmt.Fprintf(&sb, "Reprojected: %d pixels reused, %d seeded\n", rs.ReusedPixels, rs.SeededPixels)
+	}
+	for _, ds := range rs.Drawables {
+		fmt.Fprintf(&sb, "  %s: %d evaluations in %0.3fs\n", ds.Name, ds.Evaluations, ds.Seconds)
+	}
+	return sb.String()
+}
+
+// merge combines the stats of two renders, such as the eyes of a stereo pair
+func (rs RenderStats) merge(other RenderStats) RenderStats {
+	merged := RenderStats{
+		Seconds:      rs.Seconds + other.Seconds,
+		Pixels:       rs.Pixels + other.Pixels,
+		PrimaryRays:  rs.PrimaryRays + other.PrimaryRays,
+		ShadowRays:   rs.ShadowRays + other.ShadowRays,
+		MaxSteps:     max(rs.MaxSteps, other.MaxSteps),
+		ReusedPixels: rs.ReusedPixels + other.ReusedPixels,
+		SeededPixels: rs.SeededPixels + other.SeededPixels,
+		Drawables:    slices.Clone(rs.Drawables),
+	}
+	rays := float64(rs.PrimaryRays + rs.ShadowRays)
+	otherRays := float64(other.PrimaryRays + other.ShadowRays)
+	if merged.Seconds > 0 {
+		merged.RaysPerSecond = (rays + otherRays) / merged.Seconds
+	}
+	if rays+otherRays > 0 {
+		merged.MeanSteps = (rs.MeanSteps*rays + other.MeanSteps*otherRays) / (rays + otherRays)
+		merged.MaxStepShare = (rs.MaxStepShare*rays + other.MaxStepShare*otherRays) / (rays + otherRays)
+	}
+	for i, ds := range other.Drawables {
+		if i < len(merged.Drawables) {
+			merged.Drawables[i].Evaluations += ds.Evaluations
+			merged.Drawables[i].Seconds += ds.Seconds
+		}
+	}
+	return merged
+}
+
+// statsCollector counts the work of a render from every worker at once
+type statsCollector struct {
+	start       time.Time
+	primaryRays atomic.Int64
+	shadowRays  atomic.Int64
+	totalSteps  atomic.Int64
+	maxSteps    atomic.Int64
+	maxStepRays atomic.Int64
+	reused      atomic.Int64
+	seeded      atomic.Int64
+	// evals and nanos are indexed by drawable, then light
+	evals []atomic.Int64
+	nanos []atomic.Int64
+	// heatmap holds the per pixel steps or cost, if enabled
+	heatmap *framebuffer.Buffer
+}
+
+func (r *Renderer) beginStats() {
+	r.stats = nil
+	if !r.opts.Stats.Enabled && r.opts.Stats.Heatmap == HeatmapNone {
+		return
+	}
+	count := len(r.scene.Drawables) + len(r.scene.Lights)
+	r.stats = &statsCollector{
+		start: time.Now(),
+		evals: make([]atomic.Int64, count),
+		nanos: make([]atomic.Int64, count),
+	}
+	if r.opts.Stats.Heatmap != HeatmapNone {
+		r.stats.heatmap = framebuffer.New(r.camera.SizeX, r.camera.SizeY)
+	}
+}
+
+// finishStats stops collecting and keeps the summary of the render
+func (r *Renderer) finishStats() {
+	if r.stats == nil {
+		return
+	}
+	r.lastStats = r.stats.summarize(r)
+	r.lastHeatmap = nil
+	if r.stats.heatmap != nil {
+		r.lastHeatmap = Heatmap(r.stats.heatmap)
+	}
+	r.stats = nil
+}
+
+// Stats returns the statistics of the last render
+// that had stats or a heatmap enabled
+func (r *Renderer) Stats() RenderStats {
+	return r.lastStats
+}
+
+// HeatmapImage returns the heatmap of the last render, or nil if it had none
+func (r *Renderer) HeatmapImage() image.Image {
+	return r.lastHeatmap
+}
+
+func (s *statsCollector) addRay(shadow bool, rslt MarchResult, maxSteps int) {
+	if shadow {
+		s.shadowRays.Add(1)
+	} else {
+		s.primaryRays.Add(1)
+	}
+	steps := int64(rslt.Steps)
+	s.totalSteps.Add(steps)
+	for {
+		cur := s.maxSteps.Load()
+		if steps <= cur || s.maxSteps.CompareAndSwap(cur, steps) {
+			break
+		}
+	}
+	if rslt.Steps >= maxSteps {
+		s.maxStepRays.Add(1)
+	}
+}
+
+// timedDist returns the distance from p to obj, timing the evaluation
+// under the index of the drawable (lights following the drawables)
+func (r *Renderer) timedDist(idx int, obj drawables.Drawable, p vec3.Vec3) float64 {
+	start := time.Now()
+	var dist float64
+	if r.scene.options.trace.fastMath {
+		dist = obj.FastDist(p)
+	} else {
+		dist = obj.Dist(p)
+	}
+	if idx < len(r.stats.evals) {
+		r.stats.evals[idx].Add(1)
+		r.stats.nanos[idx].Add(int64(time.Since(start)))
+	}
+	return dist
+}
+
+// recordHeatmap stores the steps or cost of a pixel in the heatmap.
+// The cost of anti-aliasing refinement adds to the first pass.
+func (r *Renderer) recordHeatmap(pt Point, sample pixelSample, cost time.Duration) {
+	if r.stats == nil || r.stats.heatmap == nil {
+		return
+	}
+	value := sample.steps
+	if r.opts.Stats.Heatmap == HeatmapCost {
+		value = r.stats.heatmap.At(pt.X, pt.Y).X + cost.Seconds()
+	}
+	r.stats.heatmap.Set(pt.X, pt.Y, vec3.OfSize(value))
+}
+
+func (s *statsCollector) summarize(r *Renderer) RenderStats {
+	elapsed := time.Since(s.start).Seconds()
+	rays := s.primaryRays.Load() + s.shadowRays.Load()
+	rs := RenderStats{
+		Seconds:      elapsed,
+		Pixels:       int64(area(r.window())),
+		PrimaryRays:  s.primaryRays.Load(),
+		ShadowRays:   s.shadowRays.Load(),
+		MaxSteps:     s.maxSteps.Load(),
+		ReusedPixels: s.reused.Load(),
+		SeededPixels: s.seeded.Load(),
+		Drawables:    []DrawableStats{},
+	}
+	if elapsed > 0 {
+		rs.RaysPerSecond = float64(rays) / elapsed
+	}
+	if rays > 0 {
+		rs.MeanSteps = float64(s.totalSteps.Load()) / float64(rays)
+		rs.MaxStepShare = float64(s.maxStepRays.Load()) / float64(rays)
+	}
+	all := slices.Concat(r.scene.Drawables, r.scene.Lights)
+	for i := range s.evals {
+		kind := "drawable"
+		if i >= len(r.scene.Drawables) {
+			kind = "light"
+		}
+		rs.Drawables = append(rs.Drawables, DrawableStats{
+			Name:        fmt.Sprintf("%s %d (%T)", kind, r.scene.ObjectID(all[i]), all[i]),
+			Evaluations: s.evals[i].Load(),
+			Seconds:     time.Duration(s.nanos[i].Load()).Seconds(),
+		})
+	}
+	return rs
+}
+
+// heatRamp runs from black through blue, green and yellow to red
+var heatRamp = []vec3.Vec3{
+	vec3.New(0, 0, 0),
+	vec3.New(0, 0, 1),
+	vec3.New(0, 1, 0),
+	vec3.New(1, 1, 0),
+	vec3.New(1, 0, 0),
+}
+
+// Heatmap colors a buffer of values from black (zero)
+// to red (the largest value in the buffer)
+func Heatmap(buf *framebuffer.Buffer) image.Image {
+	maxVal := 0.0
+	for _, px := range buf.Pix {
+		maxVal = math.Max(maxVal, px.X)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, buf.Width, buf.Height))
+	for y := 0; y < buf.Height; y++ {
+		for x := 0; x < buf.Width; x++ {
+			t := 0.0
+			if maxVal > 0 {
+				t = buf.At(x, y).X / maxVal
+			}
+			img.SetRGBA(x, y, vec3.Vec3ToRGBA(rampColor(t), 255))
+		}
+	}
+	return img
+}
+
+func rampColor(t float64) vec3.Vec3 {
+	t = vec3.Clamp(t, 0, 1) * float64(len(heatRamp)-1)
+	i := min(int(t), len(heatRamp)-2)
+	frac := t - float64(i)
+	return heatRamp[i].Mult(1 - frac).Add(heatRamp[i+1].Mult(frac))
+}
@@ -0,0 +1,46 @@
+package renderer
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRenderStats(t *testing.T) {
+	opts := testOpts()
+	opts.Stats = StatsOpts{Enabled: true, Heatmap: HeatmapSteps}
+	r := newTestRenderer(opts)
+	if _, err := r.Render(context.Background(), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := r.Stats()
+	if stats.Pixels != int64(opts.DimX*opts.DimY) {
+		t.Errorf("Expected %d pixels. Got %d", opts.DimX*opts.DimY, stats.Pixels)
+	}
+	if stats.PrimaryRays < stats.Pixels {
+		t.Errorf("Expected at least a primary ray for each of the %d pixels. Got %d", stats.Pixels, stats.PrimaryRays)
+	}
+	if stats.ShadowRays == 0 || stats.MeanSteps <= 0 {
+		t.Errorf("Expected shadow rays and steps. Got %+v", stats)
+	}
+	if len(stats.Drawables) != len(r.scene.Drawables)+len(r.scene.Lights) {
+		t.Fatalf("Expected a timing for every drawable and light. Got %d", len(stats.Drawables))
+	}
+	if stats.Drawables[0].Evaluations == 0 {
+		t.Errorf("Expected %s to be evaluated", stats.Drawables[0].Name)
+	}
+
+	heatmap := r.HeatmapImage()
+	if heatmap == nil || heatmap.Bounds().Dx() != opts.DimX || heatmap.Bounds().Dy() != opts.DimY {
+		t.Fatalf("Expected a %dx%d heatmap. Got %v", opts.DimX, opts.DimY, heatmap)
+	}
+}
+
+func TestRampColor(t *testing.T) {
+	if c := rampColor(0); c.Norm() != 0 {
+		t.Errorf("Expected black at 0. Got %v", c)
+	}
+	if c := rampColor(1); c.X != 1 || c.Y != 0 || c.Z != 0 {
+		t.Errorf("Expected red at 1. Got %v", c)
+	}
+}
@@ -0,0 +1,261 @@
+package renderer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+)
+
+// StereoLayout is how the views of the two eyes are combined into one image
+type StereoLayout int
+
+const (
+	// StereoNone renders a single view
+	StereoNone StereoLayout = iota
+	// StereoSideBySide puts the left eye on the left and the right eye on
+	// the right, in an image twice as wide as the frame
+	StereoSideBySide
+	// StereoOverUnder puts the left eye above the right eye, in an image
+	// twice as high as the frame
+	StereoOverUnder
+	// StereoAnaglyph takes red from the left eye and green and blue from
+	// the right eye, for red-cyan glasses
+	StereoAnaglyph
+)
+
+var stereoLayoutNames = map[StereoLayout]string{
+	StereoNone:       "none",
+	StereoSideBySide: "sbs",
+	StereoOverUnder:  "over-under",
+	StereoAnaglyph:   "anaglyph",
+}
+
+func (l StereoLayout) String() string {
+	if name, ok := stereoLayoutNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("StereoLayout(%d)", int(l))
+}
+
+// ParseStereoLayout converts a layout name (none, sbs, over-under,
+// anaglyph) into a StereoLayout
+func ParseStereoLayout(name string) (StereoLayout, error) {
+	for l, lName := range stereoLayoutNames {
+		if strings.EqualFold(name, lName) {
+			return l, nil
+		}
+	}
+	return StereoNone, fmt.Errorf("unknown stereo layout: %q", name)
+}
+
+type StereoOpts struct {
+	Layout StereoLayout
+	// Interocular is the distance between the eyes in world units
+	Interocular float64
+	// Convergence is the distance along the view direction at which
+	// both eyes see the same image, so it appears at the screen
+	Convergence float64
+}
+
+func DefaultStereoOpts() StereoOpts {
+	return StereoOpts{
+		Layout:      StereoNone,
+		Interocular: 0.5,
+		Convergence: 15,
+	}
+}
+
+func (so StereoOpts) String() string {
+	return fmt.Sprintf("stereo: {layout: %s, interocular: %f, convergence: %f}", so.Layout, so.Interocular, so.Convergence)
+}
+
+// validateStereo reports the options a stereo pair can't be rendered with
+func (opts RenderOpts) validateStereo() error {
+	var errs []error
+	stereo := opts.Stereo
+	if _, ok := stereoLayoutNames[stereo.Layout]; !ok || stereo.Layout == StereoNone {
+		errs = append(errs, fmt.Errorf("stereo needs a layout, got %s", stereo.Layout))
+	}
+	if stereo.Interocular <= 0 {
+		errs = append(errs, fmt.Errorf("interocular distance must be positive, got %f", stereo.Interocular))
+	}
+	if stereo.Convergence <= stereo.Interocular/2 {
+		errs = append(errs, fmt.Errorf("convergence distance must be more than half the interocular distance, got %f", stereo.Convergence))
+	}
+	if opts.Projection.Mode != ProjectPerspective {
+		errs = append(errs, fmt.Errorf("stereo needs the perspective projection, got %s", opts.Projection.Mode))
+	}
+	if opts.Temporal.Enabled {
+		errs = append(errs, errors.New("temporal reprojection can't be used with stereo"))
+	}
+	if !opts.Crop.Window.IsZero() {
+		errs = append(errs, errors.New("a crop window can't be used with stereo"))
+	}
+	if len(opts.AOVs) > 0 {
+		errs = append(errs, errors.New("AOV passes aren't written for stereo"))
+	}
+	return errors.Join(errs...)
+}
+
+// eye returns a copy of the camera moved sideways by half the
+// interocular distance, to the left for a side of -1 and to the right
+// for 1. The eyes look in parallel and their images are shifted so
+// points at the convergence distance line up.
+func (c *Camera) eye(side float64, stereo StereoOpts) *Camera {
+	eye := *c
+	half := side * stereo.Interocular / 2
+	_, right, _ := c.Basis()
+	eye.Pos = c.Pos.Add(right.Mult(half))
+	if c.motionEnd != nil {
+		end := *c.motionEnd
+		endCam := *c
+		endCam.Dir = end.Dir
+		_, endRight, _ := endCam.Basis()
+		end.Pos = end.Pos.Add(endRight.Mult(half))
+		eye.motionEnd = &end
+	}
+	// the pixel whose ray has this sine to the view direction
+	// sees the point straight ahead at the convergence distance
+	sin := -half / stereo.Convergence
+	adjX := float64(c.centerOffset.X) / math.Tan(c.fov_hRad/2)
+	eye.shift = sin * adjX / math.Sqrt(1-sin*sin)
+	eye.Reset()
+	return &eye
+}
+
+// RenderStereo renders the view of each eye of a stereo rig built on
+// the camera and combines them with the layout of opts.Stereo. The
+// camera's image is replaced by the combined image, so FlushToDisk
+// writes it out. Auto exposure meters both eyes together so they are
+// exposed alike, and stats and the heatmap cover both eyes. Otherwise
+// each eye is post processed and denoised on its own.
+func (r *Renderer) RenderStereo(ctx context.Context, opts RenderOpts) (image.Image, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.validateStereo(); err != nil {
+		return nil, fmt.Errorf("invalid stereo options: %w", err)
+	}
+	if r.checkpoint != nil {
+		return nil, errors.New("can't render stereo while checkpointing")
+	}
+
+	full := r.camera
+	observer := r.observer
+	defer func() {
+		r.camera = full
+		r.observer = observer
+		r.meteredScale = 0
+	}()
+	if full.SizeX != opts.DimX || full.SizeY != opts.DimY {
+		full.Resize(opts.DimX, opts.DimY)
+	}
+
+	events := &renderEvents{observer: observer, start: time.Now(), total: 2 * int64(opts.DimX) * int64(opts.DimY)}
+	events.passStart = events.start
+	events.send(Event{Kind: EventStarted})
+	// both eyes report their tiles as part of the combined image
+	var tileOffset image.Point
+	if observer != nil {
+		r.observer = ObserverFunc(func(e Event) {
+			if e.Kind == EventTileDone {
+				events.tileDone(e.Tile.Add(tileOffset))
+			}
+		})
+	}
+
+	eyeOpts := opts
+	eyeOpts.Stereo.Layout = StereoNone
+	eyeOpts.Progressive.Enabled = false
+	collectsStats := opts.Stats.Enabled || opts.Stats.Heatmap != HeatmapNone
+	var eyes [2]*Camera
+	var views [2]*image.RGBA
+	var stats [2]RenderStats
+	var heatmaps [2]image.Image
+	for i, side := range []float64{-1, 1} {
+		if i == 1 {
+			tileOffset = stereoOffset(opts.Stereo.Layout, opts.DimX, opts.DimY)
+		}
+		eyes[i] = full.eye(side, opts.Stereo)
+		r.camera = eyes[i]
+		img, err := r.Render(ctx, eyeOpts)
+		if err != nil {
+			events.finished(err)
+			return nil, err
+		}
+		views[i] = img.(*image.RGBA)
+		stats[i], heatmaps[i] = r.lastStats, r.lastHeatmap
+	}
+
+	if opts.ToneMap.AutoExposure {
+		// resolve both eyes again with the exposure metered over the pair
+		both := &framebuffer.Buffer{
+			Width:  opts.DimX,
+			Height: 2 * opts.DimY,
+			Pix:    slices.Concat(eyes[0].HDR.Pix, eyes[1].HDR.Pix),
+		}
+		r.meteredScale = AutoExposureScale(both, opts.ToneMap.Key)
+		for _, eye := range eyes {
+			r.camera = eye
+			r.Resolve()
+		}
+	}
+	if collectsStats {
+		r.lastStats = stats[0].merge(stats[1])
+		r.lastHeatmap = nil
+		if heatmaps[0] != nil {
+			layout := opts.Stereo.Layout
+			if layout == StereoAnaglyph {
+				layout = StereoSideBySide
+			}
+			r.lastHeatmap = combineStereo(layout, heatmaps[0].(*image.RGBA), heatmaps[1].(*image.RGBA))
+		}
+	}
+
+	full.Image = combineStereo(opts.Stereo.Layout, views[0], views[1])
+	full.output = image.Rectangle{}
+	events.passDone(PassTiles)
+	events.finished(nil)
+	return full.Image, nil
+}
+
+// stereoOffset returns where the right eye's view starts in the combined image
+func stereoOffset(layout StereoLayout, dimX, dimY int) image.Point {
+	switch layout {
+	case StereoSideBySide:
+		return image.Pt(dimX, 0)
+	case StereoOverUnder:
+		return image.Pt(0, dimY)
+	}
+	return image.Point{}
+}
+
+// combineStereo combines the views of the left and right eye into one image
+func combineStereo(layout StereoLayout, left, right *image.RGBA) *image.RGBA {
+	size := left.Bounds().Size()
+	if layout == StereoAnaglyph {
+		out := image.NewRGBA(image.Rectangle{Max: size})
+		for y := range size.Y {
+			for x := range size.X {
+				l := left.RGBAAt(left.Rect.Min.X+x, left.Rect.Min.Y+y)
+				px := right.RGBAAt(right.Rect.Min.X+x, right.Rect.Min.Y+y)
+				px.R = l.R
+				out.SetRGBA(x, y, px)
+			}
+		}
+		return out
+	}
+	offset := stereoOffset(layout, size.X, size.Y)
+	out := image.NewRGBA(image.Rectangle{Max: size.Add(offset)})
+	draw.Draw(out, image.Rectangle{Max: size}, left, left.Rect.Min, draw.Src)
+	draw.Draw(out, image.Rectangle{Min: offset, Max: offset.Add(size)}, right, right.Rect.Min, draw.Src)
+	return out
+}
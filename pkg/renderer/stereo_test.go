@@ -0,0 +1,137 @@
+package renderer
+
+import (
+	"context"
+	"image"
+	"math"
+	"testing"
+
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+func TestStereoEyesConverge(t *testing.T) {
+	cam := NewCameraFOV(vec3.New(-5, 0, 0), 64, 48, 30, "./rend_test")
+	stereo := DefaultStereoOpts()
+	stereo.Convergence = 4
+	target := vec3.New(-1, 0, 0)
+	var xs []float64
+	for _, side := range []float64{-1, 1} {
+		eye := cam.eye(side, stereo)
+		x, y, ok := eye.Project(target)
+		if !ok || math.Abs(y-24) > 1e-9 {
+			t.Fatalf("Expected the target on the middle row. Got %f, %f, %t", x, y, ok)
+		}
+		xs = append(xs, x)
+		ray := eye.RayForSubPixel(x, y, nil)
+		if d := ray.dir.ToUnit().Sub(vec3.DirFromPos(target, eye.Pos)).Norm(); d > 1e-9 {
+			t.Errorf("Expected the ray back through the target. Got %v", ray.dir)
+		}
+	}
+	if math.Abs(xs[0]-32) > 1e-9 || math.Abs(xs[1]-32) > 1e-9 {
+		t.Errorf("Expected the converged point at the center of both eyes. Got %v", xs)
+	}
+}
+
+func TestRenderStereoLayouts(t *testing.T) {
+	opts := testOpts()
+	opts.Stereo.Layout = StereoSideBySide
+	r := newTestRenderer(opts)
+	img, err := r.RenderStereo(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbs := img.(*image.RGBA)
+	if sbs.Bounds() != image.Rect(0, 0, 2*opts.DimX, opts.DimY) {
+		t.Fatalf("Expected a %dx%d image. Got %v", 2*opts.DimX, opts.DimY, sbs.Bounds())
+	}
+	left := sbs.SubImage(image.Rect(0, 0, opts.DimX, opts.DimY)).(*image.RGBA)
+	right := sbs.SubImage(image.Rect(opts.DimX, 0, 2*opts.DimX, opts.DimY)).(*image.RGBA)
+	if imagesEqual(left, right) {
+		t.Error("Expected the eyes to see different views")
+	}
+
+	opts.Stereo.Layout = StereoAnaglyph
+	img, err = r.RenderStereo(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anaglyph := img.(*image.RGBA)
+	want := combineStereo(StereoAnaglyph, left, right)
+	if !imagesEqual(anaglyph, want) {
+		t.Error("Expected the anaglyph to combine the same views")
+	}
+
+	// the camera image was replaced, so a plain render has to start over
+	mono, err := r.Render(context.Background(), testOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mono.Bounds() != image.Rect(0, 0, opts.DimX, opts.DimY) {
+		t.Errorf("Expected a %dx%d image. Got %v", opts.DimX, opts.DimY, mono.Bounds())
+	}
+}
+
+func TestRenderStereoSharesExposure(t *testing.T) {
+	opts := testOpts()
+	opts.Stereo.Layout = StereoSideBySide
+	opts.Stereo.Interocular = 4
+	opts.Stats.Enabled = true
+	r := newTestRenderer(opts)
+
+	// meter the HDR views of both eyes together
+	eyeOpts := opts
+	eyeOpts.Stereo.Layout = StereoNone
+	var hdr []vec3.Vec3
+	for _, side := range []float64{-1, 1} {
+		eye := newTestRenderer(eyeOpts)
+		eye.camera = r.camera.eye(side, opts.Stereo)
+		if _, err := eye.Render(context.Background(), eyeOpts); err != nil {
+			t.Fatal(err)
+		}
+		hdr = append(hdr, eye.camera.HDR.Pix...)
+	}
+	scale := AutoExposureScale(&framebuffer.Buffer{Width: opts.DimX, Height: 2 * opts.DimY, Pix: hdr}, opts.ToneMap.Key)
+
+	opts.ToneMap.AutoExposure = true
+	img, err := r.RenderStereo(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbs := img.(*image.RGBA)
+	for i, px := range hdr {
+		eye, y, x := i/(opts.DimX*opts.DimY), i/opts.DimX%opts.DimY, i%opts.DimX
+		want := vec3.Vec3ToRGBA(opts.ToneMap.Apply(px, scale), 255)
+		if got := sbs.RGBAAt(eye*opts.DimX+x, y); got != want {
+			t.Fatalf("Expected eye %d exposed by the pair's scale %f at (%d, %d). Got %v, want %v", eye, scale, x, y, got, want)
+		}
+	}
+
+	if stats := r.Stats(); stats.Pixels != int64(2*opts.DimX*opts.DimY) {
+		t.Errorf("Expected stats for the pixels of both eyes. Got %d", stats.Pixels)
+	}
+}
+
+func TestRenderStereoValidates(t *testing.T) {
+	opts := testOpts()
+	opts.Stereo.Layout = StereoOverUnder
+	opts.Projection.Mode = ProjectEquirectangular
+	r := newTestRenderer(opts)
+	if _, err := r.RenderStereo(context.Background(), opts); err == nil {
+		t.Error("Expected an error for stereo with a non-perspective projection")
+	}
+}
+
+func imagesEqual(a, b *image.RGBA) bool {
+	if a.Bounds().Size() != b.Bounds().Size() {
+		return false
+	}
+	for y := range a.Bounds().Dy() {
+		for x := range a.Bounds().Dx() {
+			if a.RGBAAt(a.Rect.Min.X+x, a.Rect.Min.Y+y) != b.RGBAAt(b.Rect.Min.X+x, b.Rect.Min.Y+y) {
+				return false
+			}
+		}
+	}
+	return true
+}
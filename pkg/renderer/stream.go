@@ -0,0 +1,98 @@
+package renderer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"time"
+)
+
+// validateBands reports the options that need the whole
+// frame at once and so can't be rendered band by band
+func (opts RenderOpts) validateBands() error {
+	var errs []error
+	if opts.ToneMap.AutoExposure {
+		errs = append(errs, fmt.Errorf("auto exposure: %w", ErrNeedsWholeFrame))
+	}
+	if len(opts.Post) > 0 {
+		errs = append(errs, fmt.Errorf("post processing: %w", ErrNeedsWholeFrame))
+	}
+	if opts.Denoise.Enabled {
+		errs = append(errs, fmt.Errorf("denoising: %w", ErrNeedsWholeFrame))
+	}
+	if opts.Temporal.Enabled {
+		errs = append(errs, fmt.Errorf("temporal reprojection: %w", ErrNeedsWholeFrame))
+	}
+	if !opts.Crop.Window.IsZero() {
+		errs = append(errs, fmt.Errorf("crop window: %w", ErrNeedsWholeFrame))
+	}
+	return errors.Join(errs...)
+}
+
+// BandFunc receives the finished image of a band of rows. The image
+// is only valid until the function returns.
+type BandFunc func(band image.Rectangle, img *image.RGBA) error
+
+// RenderBands renders the frame a band of rows at a time and hands every
+// finished band to emit, top to bottom, so only one band is ever held in
+// memory. Bands always span the whole width of the frame, as PNG and
+// similar formats write whole rows, so the memory a band takes grows with
+// DimX and bandHeight is the only way to bound it. The bands are exactly
+// the rows of a full render, except that adaptive anti-aliasing doesn't
+// refine edges lying on the border between two bands. Options that need
+// the whole frame, like auto exposure, post processing and denoising, are
+// rejected, as is checkpointing. Stats only describe the last band. The
+// camera's own image isn't used, so it can be created at any size.
+func (r *Renderer) RenderBands(ctx context.Context, opts RenderOpts, bandHeight int, emit BandFunc) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if err := opts.validateBands(); err != nil {
+		return fmt.Errorf("can't render in bands: %w", err)
+	}
+	if r.checkpoint != nil {
+		return errors.New("can't render in bands while checkpointing")
+	}
+	if bandHeight < 1 {
+		return fmt.Errorf("bands must be at least 1 row high, got %d", bandHeight)
+	}
+
+	full := r.camera
+	observer := r.observer
+	defer func() {
+		r.camera = full
+		r.observer = observer
+	}()
+
+	events := &renderEvents{observer: observer, start: time.Now(), total: int64(opts.DimX) * int64(opts.DimY)}
+	events.passStart = events.start
+	events.send(Event{Kind: EventStarted})
+	// the bands report their tiles as part of the whole frame
+	if observer != nil {
+		r.observer = ObserverFunc(func(e Event) {
+			if e.Kind == EventTileDone {
+				events.tileDone(e.Tile.Add(image.Pt(0, r.camera.offset.Y)))
+			}
+		})
+	}
+
+	bandOpts := opts
+	bandOpts.Progressive.Enabled = false
+	for y := 0; y < opts.DimY; y += bandHeight {
+		rect := image.Rect(0, y, opts.DimX, min(y+bandHeight, opts.DimY))
+		r.camera = full.band(rect, opts.DimX, opts.DimY)
+		bandOpts.DimX, bandOpts.DimY = rect.Dx(), rect.Dy()
+		img, err := r.Render(ctx, bandOpts)
+		if err == nil {
+			err = emit(rect, img.(*image.RGBA))
+		}
+		if err != nil {
+			events.finished(err)
+			return err
+		}
+	}
+	events.passDone(PassTiles)
+	events.finished(nil)
+	return nil
+}
@@ -0,0 +1,66 @@
+package renderer
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"testing"
+)
+
+func TestRenderBandsMatchesFullRender(t *testing.T) {
+	opts := testOpts()
+	opts.AA.Mode = AAJitter
+	opts.AA.Samples = 2
+	full := newTestRenderer(opts)
+	full.camera.SetLens(LensOpts{Aperture: 0.1, FocusDist: 4})
+	want, err := full.Render(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the camera's size doesn't matter when rendering in bands
+	small := opts
+	small.DimX, small.DimY = 4, 4
+	r := newTestRenderer(small)
+	r.camera.SetLens(LensOpts{Aperture: 0.1, FocusDist: 4})
+	var done int64
+	r.SetObserver(ObserverFunc(func(e Event) {
+		if e.Kind == EventFinished {
+			done = e.Done
+		}
+	}))
+	got := image.NewRGBA(image.Rect(0, 0, opts.DimX, opts.DimY))
+	next := 0
+	err = r.RenderBands(context.Background(), opts, 5, func(band image.Rectangle, img *image.RGBA) error {
+		if band.Min.Y != next || band.Dy() != img.Bounds().Dy() {
+			t.Fatalf("Expected a band starting at row %d. Got %v", next, band)
+		}
+		next = band.Max.Y
+		for y := 0; y < band.Dy(); y++ {
+			copy(got.Pix[got.PixOffset(0, band.Min.Y+y):], img.Pix[img.PixOffset(0, y):img.PixOffset(0, y+1)])
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != opts.DimY {
+		t.Fatalf("Expected the bands to cover every row. Got them stopping at row %d", next)
+	}
+	if !bytes.Equal(got.Pix, want.(*image.RGBA).Pix) {
+		t.Error("Expected the banded render to match the full render")
+	}
+	if done != int64(opts.DimX*opts.DimY) {
+		t.Errorf("Expected the observer to see %d pixels done. Got %d", opts.DimX*opts.DimY, done)
+	}
+}
+
+func TestRenderBandsRejectsWholeFrameOptions(t *testing.T) {
+	opts := testOpts()
+	opts.ToneMap.AutoExposure = true
+	r := newTestRenderer(opts)
+	err := r.RenderBands(context.Background(), opts, 8, func(image.Rectangle, *image.RGBA) error { return nil })
+	if err == nil {
+		t.Error("Expected auto exposure to be rejected")
+	}
+}
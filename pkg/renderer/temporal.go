@@ -0,0 +1,230 @@
+package renderer
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+// reprojectMargin is how far before the reprojected surface a
+// seeded ray starts, and how far past it the hit may land,
+// relative to the distance along the ray
+const reprojectMargin = 0.05
+
+// reprojectBorder is how many pixels from the edge of the frame are
+// always marched in full. Geometry coming into view from outside the
+// last frame was never recorded, so reprojection can't see it.
+const reprojectBorder = 2
+
+type TemporalOpts struct {
+	// Enabled keeps every finished frame and reprojects it into the
+	// next camera to speed up marching
+	Enabled bool
+	// Reuse copies the color of reprojected pixels that still lie on
+	// the surface instead of marching and shading them again. A reused
+	// color may come from up to half a pixel away. Pixels are never
+	// reused while AOVs or the denoiser are enabled.
+	Reuse bool
+	// Tolerance is how far, relative to its distance from the camera,
+	// a reprojected point may be off the surface and still be reused
+	Tolerance float64
+}
+
+func DefaultTemporalOpts() TemporalOpts {
+	return TemporalOpts{
+		Enabled:   false,
+		Reuse:     true,
+		Tolerance: 0.001,
+	}
+}
+
+func (to TemporalOpts) String() string {
+	return fmt.Sprintf("temporal: {enabled: %t, reuse: %t, tolerance: %f}", to.Enabled, to.Reuse, to.Tolerance)
+}
+
+// historySample is what a finished frame remembers about a pixel
+type historySample struct {
+	hit      bool
+	objID    int64
+	position vec3.Vec3
+	steps    float64
+}
+
+// frameHistory is a finished frame along with the camera it was seen from
+type frameHistory struct {
+	camera  Camera
+	color   []vec3.Vec3
+	samples []historySample
+}
+
+// reprojected is a pixel of the previous frame moved into the current camera
+type reprojected struct {
+	valid bool
+	// dist is the distance of the point from the current camera
+	dist   float64
+	color  vec3.Vec3
+	sample historySample
+}
+
+// beginTemporal reprojects the last finished frame into the current
+// camera and starts recording the frame about to be rendered.
+// Lens and motion blur sample many rays per pixel, so they disable
+// the reprojection but not the recording.
+func (r *Renderer) beginTemporal() {
+	r.reproj = nil
+	r.historyNext = nil
+	if !r.opts.Temporal.Enabled {
+		r.history = nil
+		return
+	}
+	r.historyNext = &frameHistory{samples: make([]historySample, r.camera.Size())}
+
+	prev := r.history
+	if prev == nil || prev.camera.SizeX != r.camera.SizeX || prev.camera.SizeY != r.camera.SizeY {
+		return
+	}
+	if r.camera.lens.Aperture > 0 || r.motionEnabled() {
+		return
+	}
+
+	reproj := make([]reprojected, r.camera.Size())
+	for i, s := range prev.samples {
+		if !s.hit {
+			continue
+		}
+		fx, fy, ok := r.camera.Project(s.position)
+		if !ok {
+			continue
+		}
+		x, y := int(math.Round(fx)), int(math.Round(fy))
+		if x < 0 || y < 0 || x >= r.camera.SizeX || y >= r.camera.SizeY {
+			continue
+		}
+		// keep the nearest point landing on each pixel
+		dist := s.position.Sub(r.camera.Pos).Norm()
+		entry := &reproj[y*r.camera.SizeX+x]
+		if !entry.valid || dist < entry.dist {
+			*entry = reprojected{valid: true, dist: dist, color: prev.color[i], sample: s}
+		}
+	}
+	r.reproj = reproj
+}
+
+// InvalidateHistory forgets the last finished frame, so the next one
+// is rendered without reprojection. It has to be called whenever the
+// scene is edited between frames, as the history only follows the camera.
+func (r *Renderer) InvalidateHistory() {
+	r.history = nil
+}
+
+// recordHistory remembers a sample of the frame being rendered
+func (r *Renderer) recordHistory(pt Point, sample pixelSample) {
+	if r.historyNext == nil {
+		return
+	}
+	r.historyNext.samples[pt.Y*r.camera.SizeX+pt.X] = historySample{
+		hit:      sample.hit,
+		objID:    sample.objID,
+		position: sample.position,
+		steps:    sample.steps,
+	}
+}
+
+// finishTemporal keeps the finished frame for the next one. It has to
+// run before the denoiser so filtered colors aren't reused.
+func (r *Renderer) finishTemporal() {
+	r.reproj = nil
+	if r.historyNext == nil {
+		return
+	}
+	r.historyNext.camera = *r.camera
+	r.historyNext.color = make([]vec3.Vec3, len(r.camera.HDR.Pix))
+	copy(r.historyNext.color, r.camera.HDR.Pix)
+	r.history = r.historyNext
+	r.historyNext = nil
+}
+
+// reprojectPixel shades the pixel at pt using the previous frame. A point
+// that still lies on the surface and on the pixel's ray is reused as is,
+// otherwise its distance seeds where marching starts. It returns false
+// when there is nothing to reproject, the pixel's neighbors don't agree
+// on the surface or the reprojection is inconsistent, in which case the
+// pixel has to be marched in full.
+func (r *Renderer) reprojectPixel(pt Point, shade pixelShader) (pixelSample, bool) {
+	entry := r.reproj[pt.Y*r.camera.SizeX+pt.X]
+	if !entry.valid || r.reprojDiscontinuous(pt, entry) {
+		return pixelSample{}, false
+	}
+
+	// reprojection is off with a lens, so the pinhole ray is the pixel's ray
+	ray := r.camera.RayForPixel(pt, nil)
+	dirLen2 := vec3.Dot(ray.dir, ray.dir)
+	t := vec3.Dot(entry.sample.position.Sub(ray.origin), ray.dir) / dirLen2
+	if t <= 0 {
+		return pixelSample{}, false
+	}
+
+	temporal := r.opts.Temporal
+	if temporal.Reuse && !r.opts.recordsSurface() {
+		offRay := entry.sample.position.Sub(ray.origin.Add(ray.dir.Mult(t))).Norm()
+		footprint := 0.5 * entry.dist * r.camera.fov_hRad / float64(r.camera.SizeX)
+		if offRay <= footprint && math.Abs(r.sceneDist(entry.sample.position)) <= temporal.Tolerance*entry.dist {
+			if r.stats != nil {
+				r.stats.reused.Add(1)
+			}
+			return pixelSample{
+				color:    entry.color,
+				depth:    t,
+				objID:    entry.sample.objID,
+				hit:      true,
+				position: entry.sample.position,
+				steps:    entry.sample.steps,
+			}, true
+		}
+	}
+
+	ray.start = t * (1 - reprojectMargin)
+	ray.minSteps = int(entry.sample.steps)
+	sample := shade(ray, r)
+	if !sample.hit || math.Abs(sample.depth-t) > t*reprojectMargin {
+		return pixelSample{}, false
+	}
+	if r.stats != nil {
+		r.stats.seeded.Add(1)
+	}
+	return sample, true
+}
+
+// reprojDiscontinuous reports whether the reprojected pixel lies near the
+// edge of the frame, or whether a neighbor has nothing reprojected onto it,
+// belongs to another object or lies at a very different depth. In each case
+// something could have come into view in front of the old surface, so the
+// pixel's ray has to be marched from the camera.
+func (r *Renderer) reprojDiscontinuous(pt Point, entry reprojected) bool {
+	if pt.X < reprojectBorder || pt.Y < reprojectBorder || pt.X >= r.camera.SizeX-reprojectBorder || pt.Y >= r.camera.SizeY-reprojectBorder {
+		return true
+	}
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			n := r.reproj[(pt.Y+dy)*r.camera.SizeX+pt.X+dx]
+			if !n.valid || n.sample.objID != entry.sample.objID || math.Abs(n.dist-entry.dist) > reprojectMargin*entry.dist {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sceneDist returns the signed distance from p to the nearest drawable
+func (r *Renderer) sceneDist(p vec3.Vec3) float64 {
+	minDist := math.Inf(1)
+	for _, obj := range r.scene.Drawables {
+		if r.scene.options.trace.fastMath {
+			minDist = math.Min(minDist, obj.FastDist(p))
+		} else {
+			minDist = math.Min(minDist, obj.Dist(p))
+		}
+	}
+	return minDist
+}
@@ -0,0 +1,230 @@
+package renderer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+	"github.com/Solidsilver/go-ray-march/pkg/postfx"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+// ToneMapOperator compresses linear radiance into the displayable [0, 1] range
+type ToneMapOperator int
+
+const (
+	// ToneMapClamp clips every channel to [0, 1]
+	ToneMapClamp ToneMapOperator = iota
+	// ToneMapReinhard applies c / (1 + c) to each channel
+	ToneMapReinhard
+	// ToneMapACES applies Narkowicz' fit of the ACES filmic curve
+	ToneMapACES
+	// ToneMapHable applies John Hable's Uncharted 2 filmic curve
+	ToneMapHable
+)
+
+var toneMapNames = map[ToneMapOperator]string{
+	ToneMapClamp:    "clamp",
+	ToneMapReinhard: "reinhard",
+	ToneMapACES:     "aces",
+	ToneMapHable:    "hable",
+}
+
+func (op ToneMapOperator) String() string {
+	if name, ok := toneMapNames[op]; ok {
+		return name
+	}
+	return fmt.Sprintf("ToneMapOperator(%d)", int(op))
+}
+
+// ParseToneMapOperator converts an operator name (clamp, reinhard, aces, hable)
+// into a ToneMapOperator
+func ParseToneMapOperator(name string) (ToneMapOperator, error) {
+	for op, opName := range toneMapNames {
+		if strings.EqualFold(name, opName) {
+			return op, nil
+		}
+	}
+	return ToneMapClamp, fmt.Errorf("unknown tone mapping operator: %q", name)
+}
+
+// Map applies the operator to a single channel value
+func (op ToneMapOperator) Map(x float64) float64 {
+	x = math.Max(x, 0)
+	switch op {
+	case ToneMapReinhard:
+		return x / (1 + x)
+	case ToneMapACES:
+		return (x * (2.51*x + 0.03)) / (x*(2.43*x+0.59) + 0.14)
+	case ToneMapHable:
+		const whitePoint = 11.2
+		const exposureBias = 2.0
+		return hableCurve(x*exposureBias) / hableCurve(whitePoint)
+	default:
+		return x
+	}
+}
+
+func hableCurve(x float64) float64 {
+	const a = 0.15 // shoulder strength
+	const b = 0.50 // linear strength
+	const c = 0.10 // linear angle
+	const d = 0.20 // toe strength
+	const e = 0.02 // toe numerator
+	const f = 0.30 // toe denominator
+	return ((x*(a*x+c*b) + d*e) / (x*(a*x+b) + d*f)) - e/f
+}
+
+// EncodeSRGB applies the sRGB transfer function to a linear value in [0, 1]
+func EncodeSRGB(x float64) float64 {
+	if x <= 0.0031308 {
+		return 12.92 * x
+	}
+	return 1.055*math.Pow(x, 1/2.4) - 0.055
+}
+
+type ToneMapOpts struct {
+	// Exposure is in stops, so radiance is scaled by 2^Exposure.
+	// With AutoExposure it is applied as exposure compensation.
+	Exposure float64
+	Operator ToneMapOperator
+	// SRGB encodes the tone mapped values with the sRGB transfer
+	// function instead of writing them out linearly
+	SRGB bool
+	// AutoExposure meters the finished frame and scales it so the
+	// average luminance maps to Key
+	AutoExposure bool
+	Key          float64
+}
+
+func DefaultToneMapOpts() ToneMapOpts {
+	return ToneMapOpts{
+		Exposure:     0,
+		Operator:     ToneMapClamp,
+		SRGB:         false,
+		AutoExposure: false,
+		Key:          0.18,
+	}
+}
+
+func (to ToneMapOpts) String() string {
+	return fmt.Sprintf("tonemap: {exposure: %0.2f, operator: %s, sRGB: %t, autoExposure: %t, key: %0.2f}", to.Exposure, to.Operator, to.SRGB, to.AutoExposure, to.Key)
+}
+
+// Scale returns the linear multiplier for the manual exposure
+func (to ToneMapOpts) Scale() float64 {
+	return math.Exp2(to.Exposure)
+}
+
+// Apply exposes the radiance by scale, tone maps it and
+// encodes it for display. The result is in [0, 1].
+func (to ToneMapOpts) Apply(radiance vec3.Vec3, scale float64) vec3.Vec3 {
+	radiance = radiance.Mult(scale)
+	radiance.Op(to.Operator.Map)
+	radiance.ClampSet(0, 1)
+	if to.SRGB {
+		radiance.Op(EncodeSRGB)
+	}
+	return radiance
+}
+
+const (
+	histogramBins   = 128
+	histogramMinEV  = -16.0
+	histogramMaxEV  = 16.0
+	meterLowCutoff  = 0.1
+	meterHighCutoff = 0.9
+)
+
+// AutoExposureScale meters the buffer and returns the multiplier that maps
+// its average luminance to key. The average is taken over a histogram of
+// log luminance, ignoring black pixels and the darkest and brightest 10%.
+func AutoExposureScale(buf *framebuffer.Buffer, key float64) float64 {
+	// each bin keeps the sum of its log luminances so the
+	// average isn't quantized to the bin centers
+	counts := make([]int, histogramBins)
+	evSums := make([]float64, histogramBins)
+	binWidth := (histogramMaxEV - histogramMinEV) / histogramBins
+	total := 0
+	for _, px := range buf.Pix {
+		lum := framebuffer.Luminance(px)
+		if lum <= 0 {
+			continue
+		}
+		ev := vec3.Clamp(math.Log2(lum), histogramMinEV, histogramMaxEV)
+		bin := min(int((ev-histogramMinEV)/binWidth), histogramBins-1)
+		counts[bin]++
+		evSums[bin] += ev
+		total++
+	}
+	if total == 0 {
+		return 1
+	}
+
+	low := float64(total) * meterLowCutoff
+	high := float64(total) * meterHighCutoff
+	seen := 0.0
+	evSum := 0.0
+	weight := 0.0
+	for i, count := range counts {
+		// only count the part of this bin that falls between the cutoffs
+		inRange := math.Min(seen+float64(count), high) - math.Max(seen, low)
+		seen += float64(count)
+		if inRange <= 0 {
+			continue
+		}
+		evSum += evSums[i] / float64(count) * inRange
+		weight += inRange
+	}
+	if weight == 0 {
+		return 1
+	}
+	avgLum := math.Exp2(evSum / weight)
+	return key / avgLum
+}
+
+// Resolve tone maps the HDR buffer of the camera into its image,
+// metering the whole frame first if auto exposure is enabled.
+// Scene referred post effects run on the exposed radiance and
+// display referred ones on the tone mapped result.
+func (r *Renderer) Resolve() {
+	tm := r.opts.ToneMap
+	scale := tm.Scale()
+	if tm.AutoExposure {
+		if r.meteredScale > 0 {
+			scale *= r.meteredScale
+		} else {
+			scale *= AutoExposureScale(r.camera.HDR, tm.Key)
+		}
+	}
+	alpha := r.scene.options.bg.color.A
+	hdr := r.camera.HDR
+
+	if len(r.opts.Post) == 0 {
+		for y := 0; y < hdr.Height; y++ {
+			for x := 0; x < hdr.Width; x++ {
+				display := tm.Apply(hdr.At(x, y), scale)
+				r.camera.Image.SetRGBA(x, y, vec3.Vec3ToRGBA(display, alpha))
+			}
+		}
+		return
+	}
+
+	buf := hdr.Copy()
+	for i, px := range buf.Pix {
+		buf.Pix[i] = px.Mult(scale)
+	}
+	r.opts.Post.Apply(postfx.SceneReferred, buf)
+	for i, px := range buf.Pix {
+		buf.Pix[i] = tm.Apply(px, 1)
+	}
+	r.opts.Post.Apply(postfx.DisplayReferred, buf)
+	for y := 0; y < buf.Height; y++ {
+		for x := 0; x < buf.Width; x++ {
+			display := buf.At(x, y)
+			display.ClampSet(0, 1)
+			r.camera.Image.SetRGBA(x, y, vec3.Vec3ToRGBA(display, alpha))
+		}
+	}
+}
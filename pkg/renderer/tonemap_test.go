@@ -0,0 +1,38 @@
+package renderer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Solidsilver/go-ray-march/pkg/framebuffer"
+	"github.com/Solidsilver/go-ray-march/pkg/vec3"
+)
+
+func TestToneMapRange(t *testing.T) {
+	for op := range toneMapNames {
+		prev := -1.0
+		for _, x := range []float64{0, 0.01, 0.5, 1, 4, 100} {
+			mapped := op.Map(x)
+			if mapped < prev {
+				t.Errorf("Expected %v to be non-decreasing. Got %f after %f", op, mapped, prev)
+			}
+			prev = mapped
+		}
+		opts := ToneMapOpts{Operator: op, SRGB: true}
+		out := opts.Apply(vec3.OfSize(1000), 1)
+		if out.X > 1 || out.X < 0 {
+			t.Errorf("Expected %v output in [0, 1]. Got %f", op, out.X)
+		}
+	}
+}
+
+func TestAutoExposureScale(t *testing.T) {
+	buf := framebuffer.New(4, 4)
+	for i := range buf.Pix {
+		buf.Pix[i] = vec3.OfSize(2)
+	}
+	scale := AutoExposureScale(buf, 0.18)
+	if math.Abs(scale*2-0.18) > 0.01 {
+		t.Errorf("Expected auto exposure to map luminance 2 to 0.18. Got %f", scale*2)
+	}
+}
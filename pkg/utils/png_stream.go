@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"io"
+)
+
+// pngChunkSize is the most image data written in a single IDAT chunk
+const pngChunkSize = 1 << 16
+
+var pngSignature = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}
+
+// PNGStreamWriter encodes an 8 bit RGBA PNG a few rows at a time, so an
+// image never has to be held in memory whole. Rows have to be written
+// top to bottom and Close has to be called once all of them are.
+type PNGStreamWriter struct {
+	w      *bufio.Writer
+	width  int
+	height int
+	row    int
+	idat   *pngChunkWriter
+	zw     *zlib.Writer
+	// prev and cur are the previous and current row, filtered
+	// against the one above
+	prev []byte
+	cur  []byte
+	err  error
+}
+
+// NewPNGStreamWriter writes the header of a width x height PNG to w
+func NewPNGStreamWriter(w io.Writer, width, height int) (*PNGStreamWriter, error) {
+	if width < 1 || height < 1 || width > 1<<31-1 || height > 1<<31-1 {
+		return nil, fmt.Errorf("can't encode a %dx%d PNG", width, height)
+	}
+	p := &PNGStreamWriter{
+		w:      bufio.NewWriter(w),
+		width:  width,
+		height: height,
+		prev:   make([]byte, 4*width),
+		cur:    make([]byte, 1+4*width),
+	}
+	if _, err := p.w.Write(pngSignature); err != nil {
+		return nil, err
+	}
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:4], uint32(width))
+	binary.BigEndian.PutUint32(ihdr[4:8], uint32(height))
+	ihdr[8] = 8  // bit depth
+	ihdr[9] = 6  // truecolor with alpha
+	ihdr[10] = 0 // deflate
+	ihdr[11] = 0 // adaptive filtering
+	ihdr[12] = 0 // no interlacing
+	if err := writePNGChunk(p.w, "IHDR", ihdr); err != nil {
+		return nil, err
+	}
+	p.idat = &pngChunkWriter{w: p.w}
+	p.zw = zlib.NewWriter(p.idat)
+	return p, nil
+}
+
+// WriteRows encodes every row of img, which follow the rows written so
+// far. Only the width of img matters, not where its bounds start. The
+// pixels are written as they are, so partly transparent ones are
+// taken as not premultiplied.
+func (p *PNGStreamWriter) WriteRows(img *image.RGBA) error {
+	if p.err != nil {
+		return p.err
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() != p.width {
+		return fmt.Errorf("rows are %d pixels wide, expected %d", bounds.Dx(), p.width)
+	}
+	if p.row+bounds.Dy() > p.height {
+		return fmt.Errorf("%d rows would overflow the %d rows of the image", p.row+bounds.Dy(), p.height)
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		start := img.PixOffset(bounds.Min.X, y)
+		line := img.Pix[start : start+4*p.width]
+		// the Up filter stores the difference to the row above
+		p.cur[0] = 2
+		for i, b := range line {
+			p.cur[1+i] = b - p.prev[i]
+		}
+		copy(p.prev, line)
+		if _, err := p.zw.Write(p.cur); err != nil {
+			p.err = err
+			return err
+		}
+		p.row++
+	}
+	return nil
+}
+
+// Close finishes the image data and writes the end of the PNG.
+// It fails if fewer rows than the height of the image were written.
+func (p *PNGStreamWriter) Close() error {
+	if p.err != nil {
+		return p.err
+	}
+	if p.row != p.height {
+		return fmt.Errorf("only %d of %d rows were written", p.row, p.height)
+	}
+	if err := p.zw.Close(); err != nil {
+		return err
+	}
+	if err := p.idat.flush(); err != nil {
+		return err
+	}
+	if err := writePNGChunk(p.w, "IEND", nil); err != nil {
+		return err
+	}
+	p.err = errors.New("png stream is closed")
+	return p.w.Flush()
+}
+
+// pngChunkWriter splits compressed image data into IDAT chunks
+type pngChunkWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (c *pngChunkWriter) Write(b []byte) (int, error) {
+	n := len(b)
+	for len(b) > 0 {
+		take := min(len(b), pngChunkSize-len(c.buf))
+		c.buf = append(c.buf, b[:take]...)
+		b = b[take:]
+		if len(c.buf) == pngChunkSize {
+			if err := c.flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (c *pngChunkWriter) flush() error {
+	if len(c.buf) == 0 {
+		return nil
+	}
+	err := writePNGChunk(c.w, "IDAT", c.buf)
+	c.buf = c.buf[:0]
+	return err
+}
+
+func writePNGChunk(w io.Writer, kind string, data []byte) error {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header[:4], uint32(len(data)))
+	copy(header[4:], kind)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	footer := binary.BigEndian.AppendUint32(nil, crc.Sum32())
+	for _, part := range [][]byte{header, data, footer} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
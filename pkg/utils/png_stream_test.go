@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestPNGStreamWriter(t *testing.T) {
+	want := image.NewRGBA(image.Rect(0, 0, 37, 23))
+	for y := 0; y < 23; y++ {
+		for x := 0; x < 37; x++ {
+			want.SetRGBA(x, y, color.RGBA{uint8(x * 7), uint8(y * 11), uint8(x * y), uint8(255 - x)})
+		}
+	}
+
+	buf := bytes.Buffer{}
+	p, err := NewPNGStreamWriter(&buf, 37, 23)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 23; y += 5 {
+		band := want.SubImage(image.Rect(0, y, 37, min(y+5, 23))).(*image.RGBA)
+		if err := p.WriteRows(band); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("got bounds %v, want %v", got.Bounds(), want.Bounds())
+	}
+	for y := 0; y < 23; y++ {
+		for x := 0; x < 37; x++ {
+			if c := color.NRGBAModel.Convert(got.At(x, y)); c != color.NRGBAModel.Convert(color.NRGBA(want.RGBAAt(x, y))) {
+				t.Fatalf("pixel (%d, %d) is %v, want %v", x, y, c, want.RGBAAt(x, y))
+			}
+		}
+	}
+}
+
+func TestPNGStreamWriterMissingRows(t *testing.T) {
+	p, err := NewPNGStreamWriter(&bytes.Buffer{}, 4, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.WriteRows(image.NewRGBA(image.Rect(0, 0, 4, 2))); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err == nil {
+		t.Error("expected closing a PNG with missing rows to fail")
+	}
+}
@@ -30,3 +30,14 @@ func TestPlus(t *testing.T) {
 	}
 
 }
+
+func TestRotate(t *testing.T) {
+	v := Rotate(UnitX, UnitZ, 90)
+	if v.Sub(UnitY).Norm() > 1e-12 {
+		t.Errorf("Expected %v. Got %v", UnitY, v)
+	}
+	v = Rotate(Vec3{1, 2, 3}, Vec3{0, 0, 5}, 180)
+	if v.Sub(Vec3{-1, -2, 3}).Norm() > 1e-12 {
+		t.Errorf("Expected %v. Got %v", Vec3{-1, -2, 3}, v)
+	}
+}
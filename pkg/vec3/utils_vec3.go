@@ -48,6 +48,15 @@ func AngleFromUnit_fast(v1 Vec3, v2 Vec3) float64 {
 	return val
 }
 
+// Rotate rotates v around axis by an angle in degrees, counterclockwise
+// when looking down the axis towards the origin
+func Rotate(v Vec3, axis Vec3, angle float64) Vec3 {
+	k := axis.ToUnit()
+	rad := utils.DegToRad(angle)
+	cos, sin := math.Cos(rad), math.Sin(rad)
+	return v.Mult(cos).Add(k.Cross(v).Mult(sin)).Add(k.Mult(Dot(k, v) * (1 - cos)))
+}
+
 // DirFromPos returns the direction vector pointing from
 // one point to another
 func DirFromPos(to Vec3, from Vec3) Vec3 {